@@ -6,17 +6,27 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
-	"github.com/adriankopytko/ShimiBot/internal/appcore"
 	"github.com/adriankopytko/ShimiBot/internal/agent"
+	"github.com/adriankopytko/ShimiBot/internal/appcore"
+	"github.com/adriankopytko/ShimiBot/internal/catalog"
 	"github.com/adriankopytko/ShimiBot/internal/cli"
+	"github.com/adriankopytko/ShimiBot/internal/jsonschema"
 	"github.com/adriankopytko/ShimiBot/internal/llm"
 	"github.com/adriankopytko/ShimiBot/internal/session"
 	"github.com/adriankopytko/ShimiBot/internal/tools"
 )
 
+// exitInvalidOutput is the -p exit code when the answer never matched
+// -output-schema.
+const exitInvalidOutput = 3
+
+// catalogTimeout bounds fetching the provider's model list.
+const catalogTimeout = 15 * time.Second
+
 func main() {
 	appcore.LoadEnvFilesIfPresent([]string{".env", "app/.env"}, appcore.Logger{})
 
@@ -39,7 +49,7 @@ func main() {
 	}
 	appLogger.Infof("startup complete (log_enabled=%t, log_level=%s, log_sink=%s)", cliConfig.LogEnabled, strings.ToLower(cliConfig.LogLevel), strings.ToLower(cliConfig.LogSink))
 
-	if strings.TrimSpace(cliConfig.Prompt) == "" && !cliConfig.Interactive {
+	if strings.TrimSpace(cliConfig.Prompt) == "" && !cliConfig.Interactive && !cliConfig.Resume {
 		cliConfig.Interactive = true
 	}
 
@@ -50,12 +60,94 @@ func main() {
 
 	sessionStore := session.NewJSONFileStore()
 
-	llmConfig, err := appcore.ResolveLLMConfig(appLogger)
-	if err != nil {
-		appLogger.Errorf("failed resolving llm config: %v", err)
-		panic(err.Error())
+	var llmConfig appcore.LLMConfig
+	var llmClient llm.Client
+	var replayClient *llm.ReplayClient
+	var modelInfo llm.ModelInfo
+	var modelCatalog *catalog.Catalog
+	if replayPath := strings.TrimSpace(cliConfig.ReplayCassette); replayPath != "" {
+		replayClient, err = llm.NewReplayClient(replayPath)
+		if err != nil {
+			appLogger.Errorf("failed loading cassette: %v", err)
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		llmConfig = appcore.LLMConfig{Provider: "replay", Model: replayClient.Model()}
+		llmClient = replayClient
+		appLogger.Infof("replaying cassette path=%s", replayPath)
+	} else {
+		llmConfig, err = appcore.ResolveLLMConfig(cliConfig.Provider, appLogger)
+		if err != nil {
+			appLogger.Errorf("failed resolving llm config: %v", err)
+			panic(err.Error())
+		}
+
+		if cliConfig.Command == "models" {
+			os.Exit(runModelsCommand(llmConfig, cliConfig.CommandArgs))
+		}
+		if cliConfig.ValidateModel {
+			catalogCtx, cancel := context.WithTimeout(context.Background(), catalogTimeout)
+			modelCatalog, err = appcore.LoadModelCatalog(catalogCtx, llmConfig, false)
+			cancel()
+			if err != nil {
+				appLogger.Warnf("event=model_catalog_unavailable provider=%s err=%q", llmConfig.Provider, err.Error())
+				modelCatalog = nil
+			} else {
+				if modelCatalog.Stale {
+					appLogger.Warnf("event=model_catalog_stale provider=%s fetched_at=%s", llmConfig.Provider, modelCatalog.FetchedAt.Format(time.RFC3339))
+				}
+				modelInfo, err = modelCatalog.Validate(llmConfig.Model)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v; use -validate-model=false to skip this check\n", err)
+					os.Exit(2)
+				}
+				if modelInfo.SupportsTools != nil && !*modelInfo.SupportsTools && !appcore.MatchesModel(cliConfig.TextToolModels, llmConfig.Model) {
+					cliConfig.TextToolModels = append(cliConfig.TextToolModels, llmConfig.Model)
+				}
+			}
+		}
+
+		llmClient, err = appcore.NewRoutedLLMClient(llmConfig, appcore.RoutingConfig{
+			Fallbacks:      cliConfig.Fallbacks,
+			ToolResults:    cliConfig.ToolResultModel,
+			TextToolModels: cliConfig.TextToolModels,
+		}, llm.RetryPolicy{MaxRetries: cliConfig.LLMRetries}, appLogger)
+		if err != nil {
+			appLogger.Errorf("failed creating llm client: %v", err)
+			panic(err.Error())
+		}
+
+		if recordPath := strings.TrimSpace(cliConfig.RecordCassette); recordPath != "" {
+			llmClient = llm.NewRecordingClient(llmClient, recordPath)
+			appLogger.Infof("recording cassette path=%s", recordPath)
+		}
 	}
 	toolRegistry := tools.DefaultRegistry()
+	todoList := &tools.TodoList{}
+	toolRegistry.Register(tools.TodoWriteTool{List: todoList})
+	var subAgent *appcore.SubAgent
+	if len(cliConfig.TaskTools) > 0 {
+		taskRegistry, err := toolRegistry.Subset(cliConfig.TaskTools...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid value for -task-tools: %v\n", err)
+			os.Exit(2)
+		}
+		subAgent = &appcore.SubAgent{
+			Registry: taskRegistry,
+			Policy: agent.Policy{
+				MaxTurns:       cliConfig.TaskPolicy.MaxTurns,
+				MaxToolCalls:   cliConfig.TaskPolicy.MaxToolCalls,
+				MaxRepetitions: cliConfig.MaxRepetitions,
+				MaxPromptCost:  cliConfig.TaskPolicy.MaxCost,
+			},
+			Logger: appLogger,
+		}
+		toolRegistry.Register(tools.TaskTool{Runner: subAgent, Tools: taskRegistry.Names()})
+	}
+	if toolChoice := cliConfig.RequestOptions.ToolChoice; toolChoice != nil && toolChoice.Mode == llm.ToolChoiceTool && !hasToolDefinition(toolRegistry.Definitions(), toolChoice.Name) {
+		fmt.Fprintf(os.Stderr, "error: invalid value for -tool-choice: unknown tool %q\n", toolChoice.Name)
+		os.Exit(2)
+	}
 	appLogger.Infof("using provider=%s model=%s base_url=%s", llmConfig.Provider, llmConfig.Model, llmConfig.BaseURL)
 
 	workingDir, wdErr := os.Getwd()
@@ -70,22 +162,139 @@ func main() {
 		Logger:      appLogger,
 	}
 
-	llmClient := llm.NewOpenAIClient(llmConfig.APIKey, llmConfig.BaseURL)
+	priceTable, err := appcore.LoadPriceTable(cliConfig.PriceTable)
+	if err != nil {
+		appLogger.Errorf("failed loading price table: %v", err)
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	// Reported catalog prices fill in models the price table leaves out.
+	if priceTable == nil {
+		priceTable = llm.PriceTable{}
+	}
+	for model, price := range modelCatalog.Prices() {
+		if _, ok := priceTable[model]; !ok {
+			priceTable[model] = price
+		}
+	}
+	contextWindow := cliConfig.ContextWindow
+	if !cliConfig.ContextWindowSet && modelInfo.ContextLength > 0 {
+		contextWindow = modelInfo.ContextLength
+	}
+
+	var outputSchema *jsonschema.Schema
+	if strings.TrimSpace(cliConfig.OutputSchema) != "" {
+		outputSchema, err = jsonschema.Load(cliConfig.OutputSchema)
+		if err != nil {
+			appLogger.Errorf("failed loading output schema: %v", err)
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	sessionMetadata, err := sessionStore.LoadMetadata(cliConfig.SessionID)
+	if err != nil {
+		appLogger.Errorf("failed loading session metadata: %v", err)
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	usageTracker := agent.NewUsageTracker(sessionMetadata.Usage)
+	todoList.Set(sessionMetadata.Todos)
+	planMode := &agent.PlanMode{ReadOnly: toolRegistry.ReadOnly}
+	if cliConfig.Plan || sessionMetadata.PlanMode {
+		planMode.Enter()
+	}
+
+	compaction, err := agent.ParseCompactionStrategy(cliConfig.Compaction)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	approvalPolicy := agent.ApprovalAskMutating
+	if strings.TrimSpace(cliConfig.Approval) != "" {
+		approvalPolicy, err = agent.ParseApprovalPolicy(cliConfig.Approval)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	approver := &agent.PolicyApprover{
+		Policy:   approvalPolicy,
+		ReadOnly: toolRegistry.ReadOnly,
+	}
+	if approvalPolicy.Prompts() {
+		approver.Ask = cli.NewTerminalApprover(func(toolCall llm.ToolCall) (string, bool) {
+			return toolRegistry.Preview(toolCall, toolContext)
+		})
+	}
+
 	agentRunner := agent.Runner{
 		LLMClient:       llmClient,
+		Provider:        llmConfig.Provider,
 		Model:           llmConfig.Model,
 		ToolDefinitions: toolRegistry.Definitions(),
-		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+		ExecuteToolWithParts: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) (string, []llm.ContentPart) {
 			turnToolContext := toolContext
 			turnToolContext.Context = ctx
 			turnToolContext.CorrelationID = correlationID
-			return appcore.DispatchToolCall(appLogger, toolRegistry, turnToolContext, toolCall)
+			return appcore.DispatchToolCallWithParts(appLogger, toolRegistry, turnToolContext, toolCall)
 		},
-		Logger: appLogger,
+		MaxConcurrentTools: cliConfig.ToolConcurrency,
+		ConcurrencySafe:    toolRegistry.ConcurrencySafe,
+		Approver:           approver,
+		Plan:               planMode,
+		WrapUp:             cliConfig.WrapUp,
+		Logger:             appLogger,
+		Observer:           appLogger,
 		Policy: agent.Policy{
-			MaxTurns:     cliConfig.MaxTurns,
-			MaxToolCalls: cliConfig.MaxToolCalls,
+			MaxTurns:         cliConfig.MaxTurns,
+			MaxToolCalls:     cliConfig.MaxToolCalls,
+			MaxRepetitions:   cliConfig.MaxRepetitions,
+			MaxPromptTokens:  cliConfig.MaxPromptTokens,
+			MaxSessionTokens: cliConfig.MaxSessionTokens,
+			MaxPromptCost:    cliConfig.MaxPromptCost,
+			MaxSessionCost:   cliConfig.MaxSessionCost,
 		},
+		Usage:            usageTracker,
+		Prices:           priceTable,
+		Options:          cliConfig.RequestOptions,
+		OutputSchema:     outputSchema,
+		MaxOutputRepairs: cliConfig.OutputRepairs,
+	}
+	newCompactor := func() agent.ContextManager {
+		return &agent.Compactor{
+			Strategy:      compaction,
+			ContextWindow: contextWindow,
+			Threshold:     cliConfig.CompactionThreshold,
+			Summarizer:    llmClient,
+			Model:         llmConfig.Model,
+			Logger:        appLogger,
+			Observer:      appLogger,
+		}
+	}
+	agentRunner.Context = newCompactor()
+
+	// sessionState is the metadata saved with the history; interrupted marks
+	// a run that is still in progress.
+	sessionState := func(interrupted bool) session.Metadata {
+		metadata := sessionMetadata
+		metadata.Usage = usageTracker.Session()
+		metadata.Todos = todoList.Items()
+		metadata.PlanMode = planMode.Active()
+		metadata.Interrupted = interrupted
+		if provider, model := usageTracker.LastRoute(); model != "" {
+			metadata.Provider, metadata.Model = provider, model
+		}
+		return metadata
+	}
+	if strings.TrimSpace(cliConfig.SessionID) != "" {
+		agentRunner.Checkpointer = agent.CheckpointFunc(func(history []llm.Message) error {
+			return sessionStore.SaveSession(cliConfig.SessionID, history, sessionState(true))
+		})
+	}
+	if subAgent != nil {
+		subAgent.Parent = agentRunner
+		subAgent.NewContext = newCompactor
 	}
 
 	messageHistory, err := sessionStore.Load(cliConfig.SessionID)
@@ -95,70 +304,225 @@ func main() {
 		os.Exit(1)
 	}
 
+	if sessionMetadata.Interrupted {
+		var repairedCalls int
+		messageHistory, repairedCalls = agent.RepairToolCalls(messageHistory)
+		appLogger.Warnf("event=run_interrupted session=%s repaired_tool_calls=%d", cliConfig.SessionID, repairedCalls)
+	}
+
 	if len(messageHistory) == 0 {
 		systemPrompt := appcore.BuildSystemPrompt(time.Now())
+		if replayClient != nil {
+			// The recorded prompt embeds the recording date; reuse it so
+			// requests hash the same as when they were recorded.
+			if recordedPrompt, ok := replayClient.SystemPrompt(); ok {
+				systemPrompt = recordedPrompt
+			}
+		}
 		messageHistory = append(messageHistory, llm.Message{
 			Role:    llm.RoleSystem,
 			Content: systemPrompt,
 		})
 		appLogger.Debugf("system prompt initialized with current date")
+	} else if len(todoList.Items()) > 0 {
+		// The TodoWrite calls that built the list may have been compacted
+		// away, so requests in a resumed session end with the current list.
+		agentRunner.Context = agent.Reminder{Next: agentRunner.Context, Text: func() string {
+			if todos := tools.FormatTodos(todoList.Items()); todos != "" {
+				return "your current todo list:\n" + todos
+			}
+			return ""
+		}}
 	}
 
-	runAgentTurn := func(prompt string) (string, error) {
+	// startTurn runs one prompt or resumed run with the turn timeout,
+	// streaming to observer when it is set.
+	startTurn := func(ctx context.Context, observer agent.Observer, run func(ctx context.Context, turnRunner agent.Runner, correlationID string) (string, error)) (string, error) {
 		correlationID := appcore.NewCorrelationID()
-		appLogger.Infof("event=turn_request correlation_id=%s prompt_chars=%d", correlationID, len(prompt))
 
-		turnCtx, cancel := context.WithTimeout(context.Background(), cliConfig.TurnTimeout)
+		turnCtx, cancel := context.WithTimeout(ctx, cliConfig.TurnTimeout)
 		defer cancel()
 
-		responseText, runErr := agentRunner.RunPrompt(turnCtx, &messageHistory, prompt, correlationID)
-		if runErr != nil {
-			appLogger.Errorf("event=turn_error correlation_id=%s err=%v", correlationID, runErr)
-			return "", runErr
+		turnRunner := agentRunner
+		if observer != nil {
+			turnRunner.Stream = true
+			turnRunner.Observer = agent.MultiObserver(appLogger, agent.ObserverFunc(func(event agent.Event) {
+				if delta, ok := event.(agent.AssistantDeltaEvent); ok && !cliConfig.ShowReasoning {
+					delta.Delta.Reasoning = ""
+					event = delta
+				}
+				observer.Observe(event)
+			}))
 		}
 
-		appLogger.Infof("event=turn_complete correlation_id=%s response_chars=%d", correlationID, len(responseText))
-		return responseText, nil
+		return run(turnCtx, turnRunner, correlationID)
+	}
+	runAgentTurn := func(ctx context.Context, prompt string, observer agent.Observer) (string, error) {
+		return startTurn(ctx, observer, func(ctx context.Context, turnRunner agent.Runner, correlationID string) (string, error) {
+			return turnRunner.RunPrompt(ctx, &messageHistory, prompt, correlationID)
+		})
+	}
+	resumeAgentTurn := func(ctx context.Context, _ string, observer agent.Observer) (string, error) {
+		return startTurn(ctx, observer, func(ctx context.Context, turnRunner agent.Runner, correlationID string) (string, error) {
+			return turnRunner.Resume(ctx, &messageHistory, correlationID)
+		})
 	}
 
-	if strings.TrimSpace(cliConfig.Prompt) != "" {
-		appLogger.Debugf("received prompt with %d characters", len(cliConfig.Prompt))
-		responseText, runErr := runAgentTurn(cliConfig.Prompt)
+	saveSession := func() {
+		if strings.TrimSpace(cliConfig.SessionID) == "" {
+			return
+		}
+		sessionMetadata = sessionState(false)
+		if saveErr := sessionStore.SaveSession(cliConfig.SessionID, messageHistory, sessionMetadata); saveErr != nil {
+			appLogger.Errorf("failed saving session: %v", saveErr)
+			fmt.Fprintf(os.Stderr, "warning: failed saving session: %v\n", saveErr)
+		}
+	}
+
+	// saveCancelled saves a run cancelled by Ctrl-C, answering the tool
+	// calls it left in flight so the session can be continued.
+	saveCancelled := func() {
+		var repairedCalls int
+		messageHistory, repairedCalls = agent.RepairToolCalls(messageHistory)
+		appLogger.Warnf("event=run_cancelled session=%s repaired_tool_calls=%d", cliConfig.SessionID, repairedCalls)
+		saveSession()
+	}
+
+	// finishRun saves and prints a run outside the shell, exiting when it
+	// failed.
+	finishRun := func(responseText string, runErr error) {
+		if errors.Is(runErr, context.Canceled) {
+			saveCancelled()
+			fmt.Fprintln(os.Stderr, "run cancelled")
+			os.Exit(cli.ExitInterrupted)
+		}
+		var budgetErr *agent.BudgetError
+		if errors.As(runErr, &budgetErr) {
+			// The history stays valid, so the session can be continued
+			// with a larger budget.
+			saveSession()
+			if budgetErr.Summary != "" {
+				fmt.Println(budgetErr.Summary)
+			}
+		}
 		if runErr != nil {
 			appLogger.Errorf("prompt run failed: %v", runErr)
-			fmt.Fprintf(os.Stderr, "error: %v\n", runErr)
-			os.Exit(1)
-		}
-		if strings.TrimSpace(cliConfig.SessionID) != "" {
-			if saveErr := sessionStore.Save(cliConfig.SessionID, messageHistory); saveErr != nil {
-				appLogger.Errorf("failed saving session history: %v", saveErr)
-				fmt.Fprintf(os.Stderr, "warning: failed saving session history: %v\n", saveErr)
+			fmt.Fprintf(os.Stderr, "error: %s\n", cli.DescribeError(runErr))
+			if errors.Is(runErr, agent.ErrInvalidOutput) {
+				os.Exit(exitInvalidOutput)
 			}
+			os.Exit(1)
 		}
+		saveSession()
 		fmt.Print(responseText)
+	}
+
+	// Ctrl-C cancels a run outside the shell. Once it has, the signal is
+	// released, so pressing it again kills a run that is slow to stop.
+	runCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-runCtx.Done()
+		stopSignals()
+	}()
+
+	if cliConfig.Resume {
+		appLogger.Infof("resuming run session=%s interrupted=%t", cliConfig.SessionID, sessionMetadata.Interrupted)
+		finishRun(resumeAgentTurn(runCtx, "", nil))
+		if !cliConfig.Interactive && strings.TrimSpace(cliConfig.Prompt) == "" {
+			os.Exit(0)
+		}
+		fmt.Println()
+	}
+
+	if strings.TrimSpace(cliConfig.Prompt) != "" {
+		appLogger.Debugf("received prompt with %d characters", len(cliConfig.Prompt))
+		finishRun(runAgentTurn(runCtx, cliConfig.Prompt, nil))
 		if !cliConfig.Interactive {
 			os.Exit(0)
 		}
 		fmt.Println()
 	}
 
-	if cliConfig.Interactive {
-		runErr := cli.RunInteractive(cliConfig.SessionID, func(input string) (string, error) {
-			responseText, promptErr := runAgentTurn(input)
-			if promptErr != nil {
-				appLogger.Errorf("interactive prompt failed: %v", promptErr)
-				return "", promptErr
-			}
+	stopSignals()
 
-			if strings.TrimSpace(cliConfig.SessionID) != "" {
-				if saveErr := sessionStore.Save(cliConfig.SessionID, messageHistory); saveErr != nil {
-					appLogger.Errorf("failed saving session history: %v", saveErr)
-					fmt.Fprintf(os.Stderr, "warning: failed saving session history: %v\n", saveErr)
+	if cliConfig.Interactive {
+		// interactiveTurn saves the session after each turn the shell runs.
+		interactiveTurn := func(runTurn cli.TurnRunner) cli.TurnRunner {
+			return func(ctx context.Context, input string, observer agent.Observer) (string, error) {
+				responseText, promptErr := runTurn(ctx, input, observer)
+				if promptErr != nil {
+					if errors.Is(promptErr, context.Canceled) {
+						saveCancelled()
+						return "", promptErr
+					}
+					appLogger.Errorf("interactive prompt failed: %v", promptErr)
+					if errors.As(promptErr, new(*agent.BudgetError)) {
+						saveSession()
+						return responseText, promptErr
+					}
+					return "", promptErr
 				}
-			}
 
-			return responseText, nil
+				saveSession()
+				return responseText, nil
+			}
+		}
+		if sessionMetadata.Interrupted {
+			fmt.Fprintln(os.Stderr, "the last run in this session was interrupted; :resume continues it")
+		}
+		runErr := cli.RunInteractive(cliConfig.SessionID, interactiveTurn(runAgentTurn), func() string {
+			return cli.FormatStatus(todoList.Items(), planMode.Active())
+		}, cli.LocalCommand{
+			Name:        "usage",
+			Description: "show token usage and estimated cost",
+			Run: func(args string) {
+				fmt.Printf("last prompt: %s\n", cli.FormatUsage(usageTracker.Prompt()))
+				fmt.Printf("session:     %s\n", cli.FormatUsage(usageTracker.Session()))
+			},
+		}, cli.LocalCommand{
+			Name:        "resume",
+			Description: "continue the interrupted run of this session",
+			Turn:        interactiveTurn(resumeAgentTurn),
+		}, cli.LocalCommand{
+			Name:        "todos",
+			Description: "show the agent's todo list",
+			Run: func(args string) {
+				if todos := tools.FormatTodos(todoList.Items()); todos != "" {
+					fmt.Println(todos)
+					return
+				}
+				fmt.Println("the todo list is empty")
+			},
+		}, cli.LocalCommand{
+			Name:        "plan",
+			Description: "enter plan mode: only read-only tools until you accept the plan",
+			Run: func(args string) {
+				planMode.Enter()
+				saveSession()
+				fmt.Println("plan mode is on; ask for a plan, then :accept it")
+			},
+		}, cli.LocalCommand{
+			Name:        "accept",
+			Description: "accept the proposed plan and let the agent make changes",
+			Run: func(args string) {
+				if !planMode.Active() {
+					fmt.Println("plan mode is not on")
+					return
+				}
+				planMode.Accept()
+				saveSession()
+				fmt.Println("plan accepted; tools that change the workspace are available again")
+			},
+		}, cli.LocalCommand{
+			Name:        "models",
+			Description: "list the provider's models ([-tools] [-min-context=N] [-max-price=USD] [-refresh] [query])",
+			Run: func(args string) {
+				runModelsCommand(llmConfig, strings.Fields(args))
+			},
 		})
+		if errors.Is(runErr, cli.ErrInterrupted) {
+			os.Exit(cli.ExitInterrupted)
+		}
 		if runErr != nil {
 			appLogger.Errorf("interactive input failed: %v", runErr)
 			fmt.Fprintf(os.Stderr, "error: %v\n", runErr)
@@ -168,3 +532,35 @@ func main() {
 
 	os.Exit(0)
 }
+
+// runModelsCommand prints the provider's models matching args and returns
+// the exit code.
+func runModelsCommand(llmConfig appcore.LLMConfig, args []string) int {
+	options, err := cli.ParseModelsArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), catalogTimeout)
+	defer cancel()
+	modelCatalog, err := appcore.LoadModelCatalog(ctx, llmConfig, options.Refresh)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", cli.DescribeError(err))
+		return 1
+	}
+	if modelCatalog.Stale {
+		fmt.Fprintf(os.Stderr, "warning: %s is unreachable; showing the model list cached at %s\n", llmConfig.Provider, modelCatalog.FetchedAt.Format(time.RFC3339))
+	}
+	fmt.Print(cli.FormatModels(modelCatalog.Select(options.Filter)))
+	return 0
+}
+
+func hasToolDefinition(definitions []llm.ToolDefinition, name string) bool {
+	for _, definition := range definitions {
+		if definition.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// ApprovalPolicy decides which tool calls run without asking the user.
+type ApprovalPolicy string
+
+const (
+	// ApprovalAsk asks about every tool call.
+	ApprovalAsk ApprovalPolicy = "ask"
+	// ApprovalAskMutating runs read-only tools and asks about the rest.
+	ApprovalAskMutating ApprovalPolicy = "ask-mutating"
+	// ApprovalReadOnly runs read-only tools and denies the rest.
+	ApprovalReadOnly ApprovalPolicy = "read-only"
+	// ApprovalAuto runs every tool call.
+	ApprovalAuto ApprovalPolicy = "auto"
+)
+
+// ParseApprovalPolicy accepts ask, ask-mutating, read-only or auto.
+func ParseApprovalPolicy(value string) (ApprovalPolicy, error) {
+	policy := ApprovalPolicy(strings.ToLower(strings.TrimSpace(value)))
+	switch policy {
+	case ApprovalAsk, ApprovalAskMutating, ApprovalReadOnly, ApprovalAuto:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown approval policy %q (use: ask, ask-mutating, read-only, auto)", value)
+	}
+}
+
+// Prompts reports whether the policy needs someone to answer approval
+// prompts.
+func (policy ApprovalPolicy) Prompts() bool {
+	return policy == ApprovalAsk || policy == ApprovalAskMutating
+}
+
+// ApprovalDecision is the answer to one tool call.
+type ApprovalDecision struct {
+	Approved bool
+	// Always approves later calls of the same tool without asking.
+	Always bool
+	// Reason is sent back to the model when the call is denied.
+	Reason string
+	// Arguments, when set, replace the arguments the model gave.
+	Arguments string
+}
+
+// Approver decides whether a tool call may run. The runner asks about one
+// call at a time, so an Approver may prompt the user.
+type Approver interface {
+	Approve(ctx context.Context, toolCall llm.ToolCall) (ApprovalDecision, error)
+}
+
+// PolicyApprover applies Policy and asks Ask about the calls the policy
+// leaves to the user. Tools approved with Always are not asked about again.
+type PolicyApprover struct {
+	Policy ApprovalPolicy
+	// ReadOnly reports whether a tool never changes the workspace; when it
+	// is nil every tool is treated as mutating.
+	ReadOnly func(toolName string) bool
+	Ask      Approver
+
+	mu     sync.Mutex
+	always map[string]bool
+}
+
+func (approver *PolicyApprover) Approve(ctx context.Context, toolCall llm.ToolCall) (ApprovalDecision, error) {
+	readOnly := approver.ReadOnly != nil && approver.ReadOnly(toolCall.Name)
+	switch approver.Policy {
+	case ApprovalAuto:
+		return ApprovalDecision{Approved: true}, nil
+	case ApprovalReadOnly:
+		if readOnly {
+			return ApprovalDecision{Approved: true}, nil
+		}
+		return ApprovalDecision{Reason: fmt.Sprintf("%s changes the workspace and the read-only approval policy does not allow it", toolCall.Name)}, nil
+	case ApprovalAskMutating:
+		if readOnly {
+			return ApprovalDecision{Approved: true}, nil
+		}
+	case ApprovalAsk:
+	default:
+		return ApprovalDecision{}, fmt.Errorf("unknown approval policy %q", approver.Policy)
+	}
+
+	approver.mu.Lock()
+	defer approver.mu.Unlock()
+	if approver.always[toolCall.Name] {
+		return ApprovalDecision{Approved: true}, nil
+	}
+	if approver.Ask == nil {
+		return ApprovalDecision{Reason: "the call needs approval and nobody is available to approve it"}, nil
+	}
+	decision, err := approver.Ask.Approve(ctx, toolCall)
+	if err != nil {
+		return ApprovalDecision{}, err
+	}
+	if decision.Approved && decision.Always {
+		if approver.always == nil {
+			approver.always = map[string]bool{}
+		}
+		approver.always[toolCall.Name] = true
+	}
+	return decision, nil
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+type scriptedApprover struct {
+	decisions []ApprovalDecision
+	asked     []string
+}
+
+func (approver *scriptedApprover) Approve(ctx context.Context, toolCall llm.ToolCall) (ApprovalDecision, error) {
+	approver.asked = append(approver.asked, toolCall.Name)
+	decision := approver.decisions[0]
+	approver.decisions = approver.decisions[1:]
+	return decision, nil
+}
+
+func readOnlyTools(toolName string) bool {
+	return toolName == "Read"
+}
+
+func TestPolicyApprover_AppliesPolicies(t *testing.T) {
+	read := llm.ToolCall{Name: "Read"}
+	write := llm.ToolCall{Name: "Write"}
+
+	readOnly := &PolicyApprover{Policy: ApprovalReadOnly, ReadOnly: readOnlyTools}
+	if decision, _ := readOnly.Approve(context.Background(), read); !decision.Approved {
+		t.Fatal("expected read-only policy to allow Read")
+	}
+	if decision, _ := readOnly.Approve(context.Background(), write); decision.Approved || !strings.Contains(decision.Reason, "read-only") {
+		t.Fatalf("expected read-only policy to deny Write, got %+v", decision)
+	}
+
+	ask := &scriptedApprover{decisions: []ApprovalDecision{{Approved: true, Always: true}}}
+	askMutating := &PolicyApprover{Policy: ApprovalAskMutating, ReadOnly: readOnlyTools, Ask: ask}
+	for _, toolCall := range []llm.ToolCall{read, write, write} {
+		if decision, err := askMutating.Approve(context.Background(), toolCall); err != nil || !decision.Approved {
+			t.Fatalf("expected %s approved, got %+v %v", toolCall.Name, decision, err)
+		}
+	}
+	if len(ask.asked) != 1 || ask.asked[0] != "Write" {
+		t.Fatalf("expected to be asked about the first Write only, got %v", ask.asked)
+	}
+
+	if _, err := ParseApprovalPolicy("sometimes"); err == nil {
+		t.Fatal("expected unknown policy to be rejected")
+	}
+}
+
+func TestRunPrompt_AppliesApprovalDecisions(t *testing.T) {
+	history := []llm.Message{}
+	executed := []string{}
+	recorder := &eventRecorder{}
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{
+			responseWithToolCalls(
+				sampleToolCall("call_1", "Bash", `{"command":"rm -rf build"}`),
+				sampleToolCall("call_2", "Write", `{"file_path":"a.txt","content":"x"}`),
+			),
+			responseWithText("stop", "done"),
+		}},
+		Model: "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			executed = append(executed, toolCall.Arguments)
+			return "{}"
+		},
+		Approver: &scriptedApprover{decisions: []ApprovalDecision{
+			{Reason: "do not delete the build directory"},
+			{Approved: true, Arguments: `{"file_path":"b.txt","content":"x"}`},
+		}},
+		Observer: recorder,
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "clean up", "corr-approval"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if len(executed) != 1 || executed[0] != `{"file_path":"b.txt","content":"x"}` {
+		t.Fatalf("expected only the edited Write to run, got %v", executed)
+	}
+	if denied := history[2]; denied.ToolCallID != "call_1" || !strings.Contains(denied.Content, "tool call denied: do not delete the build directory") {
+		t.Fatalf("expected denial reason sent to the model, got %+v", denied)
+	}
+	if arguments := history[1].ToolCalls[1].Arguments; arguments != `{"file_path":"b.txt","content":"x"}` {
+		t.Fatalf("expected history to show the edited arguments, got %s", arguments)
+	}
+	approvals := 0
+	for _, event := range recorder.events {
+		if approval, ok := event.(ToolApprovalEvent); ok {
+			approvals++
+			if approval.ToolCall.ID == "call_2" && !approval.Edited {
+				t.Fatalf("expected edited approval event, got %+v", approval)
+			}
+		}
+	}
+	if approvals != 2 {
+		t.Fatalf("expected two approval events, got %d", approvals)
+	}
+}
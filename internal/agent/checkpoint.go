@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"slices"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+// Checkpointer saves the history while a prompt runs, after the prompt,
+// each assistant message and each tool result, so a crash or kill loses at
+// most the tool calls in flight. The runner calls it from one goroutine at a
+// time.
+type Checkpointer interface {
+	Checkpoint(history []llm.Message) error
+}
+
+// CheckpointFunc adapts a function to Checkpointer.
+type CheckpointFunc func(history []llm.Message) error
+
+func (checkpoint CheckpointFunc) Checkpoint(history []llm.Message) error {
+	return checkpoint(history)
+}
+
+func (runner Runner) checkpoint(history []llm.Message) {
+	if runner.Checkpointer == nil {
+		return
+	}
+	if err := runner.Checkpointer.Checkpoint(history); err != nil {
+		runner.warnf("checkpoint failed: %v", err)
+	}
+}
+
+// resultCheckpoint returns the callback executeToolCalls uses to checkpoint
+// history with the tool results finished so far, or nil without a
+// Checkpointer.
+func (runner Runner) resultCheckpoint(history []llm.Message) func(finished []llm.Message) {
+	if runner.Checkpointer == nil {
+		return nil
+	}
+	return func(finished []llm.Message) {
+		runner.checkpoint(append(slices.Clip(history), finished...))
+	}
+}
+
+// RepairToolCalls answers tool calls left without a result, as a run that
+// was interrupted leaves them, with an "interrupted" error result placed
+// after the results they do have. Providers reject a history with
+// unanswered tool calls. It returns the repaired history and how many calls
+// it answered; history itself is not modified.
+func RepairToolCalls(history []llm.Message) ([]llm.Message, int) {
+	var repaired []llm.Message
+	answered := 0
+	for index := 0; index < len(history); index++ {
+		message := history[index]
+		if message.Role != llm.RoleAssistant || len(message.ToolCalls) == 0 {
+			if repaired != nil {
+				repaired = append(repaired, message)
+			}
+			continue
+		}
+
+		end := index + 1
+		results := map[string]bool{}
+		for end < len(history) && history[end].Role == llm.RoleTool {
+			results[history[end].ToolCallID] = true
+			end++
+		}
+		missing := make([]llm.Message, 0)
+		for _, toolCall := range message.ToolCalls {
+			if !results[toolCall.ID] {
+				missing = append(missing, interruptedToolResult(toolCall))
+			}
+		}
+		if len(missing) > 0 && repaired == nil {
+			repaired = append(make([]llm.Message, 0, len(history)+len(missing)), history[:index]...)
+		}
+		if repaired != nil {
+			repaired = append(repaired, history[index:end]...)
+			repaired = append(repaired, missing...)
+		}
+		answered += len(missing)
+		index = end - 1
+	}
+	if repaired == nil {
+		return history, 0
+	}
+	return repaired, answered
+}
+
+func interruptedToolResult(toolCall llm.ToolCall) llm.Message {
+	return llm.Message{
+		Role:       llm.RoleTool,
+		Content:    tools.ErrorEnvelope("tool call interrupted: the run stopped before it finished; call it again if it is still needed", map[string]any{"tool": toolCall.Name}),
+		ToolCallID: toolCall.ID,
+	}
+}
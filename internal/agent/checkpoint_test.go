@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+func TestRepairToolCalls_AnswersDanglingCalls(t *testing.T) {
+	history := []llm.Message{
+		{Role: llm.RoleUser, Content: "fix it"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{sampleToolCall("call_1", "Read", "{}"), sampleToolCall("call_2", "Bash", "{}")}},
+		{Role: llm.RoleTool, ToolCallID: "call_2", Content: "{}"},
+		{Role: llm.RoleAssistant, Content: "next"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{sampleToolCall("call_3", "Write", "{}")}},
+	}
+
+	repaired, answered := RepairToolCalls(history)
+	if answered != 2 || len(repaired) != 7 {
+		t.Fatalf("expected two calls answered in 7 messages, got %d in %d", answered, len(repaired))
+	}
+	if repaired[3].ToolCallID != "call_1" || !strings.Contains(repaired[3].Content, "tool call interrupted") {
+		t.Fatalf("expected call_1 answered after the existing result, got %+v", repaired[3])
+	}
+	if repaired[4].Content != "next" || repaired[6].ToolCallID != "call_3" {
+		t.Fatalf("unexpected repaired history %+v", repaired)
+	}
+	if len(history) != 5 {
+		t.Fatal("expected the original history left alone")
+	}
+
+	if same, answered := RepairToolCalls(repaired); answered != 0 || len(same) != 7 {
+		t.Fatalf("expected a valid history unchanged, got %d answered", answered)
+	}
+}
+
+func TestRunPrompt_CheckpointsEachMessageAndToolResult(t *testing.T) {
+	history := []llm.Message{{Role: llm.RoleSystem, Content: "system"}}
+	checkpoints := [][]llm.Message{}
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{
+			responseWithToolCalls(sampleToolCall("call_1", "Read", "{}"), sampleToolCall("call_2", "Read", `{"file_path":"b"}`)),
+			responseWithText("stop", "done"),
+		}},
+		Model: "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		MaxConcurrentTools: 1,
+		Checkpointer: CheckpointFunc(func(history []llm.Message) error {
+			checkpoints = append(checkpoints, append([]llm.Message(nil), history...))
+			return nil
+		}),
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "read both", "corr-checkpoint"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	lengths := []int{}
+	for _, checkpoint := range checkpoints {
+		lengths = append(lengths, len(checkpoint))
+	}
+	// prompt, assistant with calls, first result, both results, the batch,
+	// final answer
+	expected := []int{2, 3, 4, 5, 5, 6}
+	if len(lengths) != len(expected) {
+		t.Fatalf("expected checkpoint lengths %v, got %v", expected, lengths)
+	}
+	for index := range expected {
+		if lengths[index] != expected[index] {
+			t.Fatalf("expected checkpoint lengths %v, got %v", expected, lengths)
+		}
+	}
+	if partial := checkpoints[2]; partial[3].ToolCallID != "call_1" {
+		t.Fatalf("expected the first result checkpointed on its own, got %+v", partial[3])
+	}
+}
+
+func TestResume_ContinuesInterruptedRun(t *testing.T) {
+	history := []llm.Message{
+		{Role: llm.RoleSystem, Content: "system"},
+		{Role: llm.RoleUser, Content: "run the tests"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{sampleToolCall("call_1", "Bash", `{"command":"go test ./..."}`)}},
+	}
+	llmClient := &queuedClient{responses: []llm.CompletionResponse{responseWithText("stop", "the tests were interrupted; rerun them")}}
+	runner := Runner{
+		LLMClient: llmClient,
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+	}
+
+	text, err := runner.Resume(context.Background(), &history, "corr-resume")
+	if err != nil {
+		t.Fatalf("Resume returned error: %v", err)
+	}
+	if text != "the tests were interrupted; rerun them" || len(history) != 5 {
+		t.Fatalf("expected the run continued, got %q with %d messages", text, len(history))
+	}
+	request := llmClient.requests[0]
+	if last := request.Messages[len(request.Messages)-1]; last.Role != llm.RoleTool || !strings.Contains(last.Content, "interrupted") {
+		t.Fatalf("expected the repaired result last and no new prompt, got %+v", last)
+	}
+
+	text, err = runner.Resume(context.Background(), &history, "corr-resume-2")
+	if err != nil || text != "the tests were interrupted; rerun them" || len(llmClient.requests) != 1 {
+		t.Fatalf("expected a finished run returned as is, got %q (%v) after %d requests", text, err, len(llmClient.requests))
+	}
+}
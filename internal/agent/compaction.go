@@ -0,0 +1,369 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// ContextManager decides which messages are sent to the LLM each turn. It
+// returns a new slice and must not modify messages, which the runner keeps
+// as the full history.
+type ContextManager interface {
+	Prepare(ctx context.Context, messages []llm.Message) ([]llm.Message, error)
+}
+
+type CompactionStrategy string
+
+const (
+	CompactionNone CompactionStrategy = "none"
+	// CompactionElide replaces older tool outputs with a short placeholder.
+	CompactionElide CompactionStrategy = "elide"
+	// CompactionWindow drops the oldest turns, cutting only where no tool
+	// call is separated from its results.
+	CompactionWindow CompactionStrategy = "window"
+	// CompactionSummarize drops turns like CompactionWindow and replaces them
+	// with an LLM-written summary.
+	CompactionSummarize CompactionStrategy = "summarize"
+)
+
+const (
+	DefaultCompactionThreshold = 0.8
+	DefaultCompactionTarget    = 0.5
+
+	// estimatedImageTokens is a rough cost for one image or file part.
+	estimatedImageTokens = 1000
+	// elideMinBytes keeps short tool outputs, which save little when elided.
+	elideMinBytes = 256
+	// summaryMessageChars bounds each message in the summarization transcript.
+	summaryMessageChars = 4000
+)
+
+const summaryInstruction = "You compress conversations for an AI coding agent. Summarize the transcript below so the agent can continue without it: " +
+	"keep the user's goals, decisions made, files and commands involved, important tool results and open tasks. Be concise and factual."
+
+// ParseCompactionStrategy accepts none, elide, window or summarize.
+func ParseCompactionStrategy(value string) (CompactionStrategy, error) {
+	strategy := CompactionStrategy(strings.ToLower(strings.TrimSpace(value)))
+	switch strategy {
+	case CompactionNone, CompactionElide, CompactionWindow, CompactionSummarize:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown compaction strategy %q (use: none, elide, window, summarize)", value)
+	}
+}
+
+// Compactor is a ContextManager that compacts the messages once their
+// estimated size passes Threshold of ContextWindow, bringing them down to
+// Target of it. A strategy that cannot reach the target falls back to the
+// others: eliding then windowing, or windowing then eliding.
+type Compactor struct {
+	Strategy      CompactionStrategy
+	ContextWindow int
+	// Threshold and Target are fractions of ContextWindow; zero uses the
+	// defaults.
+	Threshold float64
+	Target    float64
+	// Summarizer and Model write summaries for CompactionSummarize.
+	Summarizer llm.Client
+	Model      string
+	Logger     Logger
+	// Observer, when set, receives a ContextCompactedEvent for each
+	// compaction.
+	Observer Observer
+
+	mu      sync.Mutex
+	summary cachedSummary
+}
+
+// cachedSummary lets later turns extend a summary instead of summarizing
+// the same messages again.
+type cachedSummary struct {
+	count int
+	hash  string
+	text  string
+}
+
+func (compactor *Compactor) Prepare(ctx context.Context, messages []llm.Message) ([]llm.Message, error) {
+	if compactor == nil || compactor.Strategy == CompactionNone || compactor.Strategy == "" || compactor.ContextWindow <= 0 {
+		return messages, nil
+	}
+
+	before := EstimateTokens(messages)
+	if float64(before) <= compactor.ratio(compactor.Threshold, DefaultCompactionThreshold) {
+		return messages, nil
+	}
+	target := int(compactor.ratio(compactor.Target, DefaultCompactionTarget))
+
+	var compacted []llm.Message
+	switch compactor.Strategy {
+	case CompactionElide:
+		compacted = elideToolOutputs(messages, target)
+		if EstimateTokens(compacted) > target {
+			compacted, _ = slidingWindow(compacted, target)
+		}
+	case CompactionWindow:
+		compacted, _ = slidingWindow(messages, target)
+		if EstimateTokens(compacted) > target {
+			compacted = elideToolOutputs(compacted, target)
+		}
+	case CompactionSummarize:
+		kept, dropped := slidingWindow(messages, target)
+		compacted = kept
+		if len(dropped) > 0 {
+			summary, err := compactor.summarize(ctx, dropped)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				compactor.warnf("event=context_summary_failed err=%q", err.Error())
+			} else {
+				compacted = insertSummary(kept, summary)
+			}
+		}
+		if EstimateTokens(compacted) > target {
+			compacted = elideToolOutputs(compacted, target)
+		}
+	default:
+		return nil, fmt.Errorf("unknown compaction strategy %q", compactor.Strategy)
+	}
+
+	if compactor.Observer != nil {
+		compactor.Observer.Observe(ContextCompactedEvent{
+			Strategy:       compactor.Strategy,
+			ContextWindow:  compactor.ContextWindow,
+			TokensBefore:   before,
+			TokensAfter:    EstimateTokens(compacted),
+			MessagesBefore: len(messages),
+			MessagesAfter:  len(compacted),
+		})
+	}
+	return compacted, nil
+}
+
+func (compactor *Compactor) ratio(value, fallback float64) float64 {
+	if value <= 0 || value > 1 {
+		value = fallback
+	}
+	return value * float64(compactor.ContextWindow)
+}
+
+func (compactor *Compactor) warnf(format string, args ...interface{}) {
+	if compactor.Logger != nil {
+		compactor.Logger.Warnf(format, args...)
+	}
+}
+
+// EstimateTokens approximates the prompt size of messages at four
+// characters per token plus a small per-message overhead. It errs on the
+// high side for code and non-English text.
+func EstimateTokens(messages []llm.Message) int {
+	total := 0
+	for _, message := range messages {
+		total += estimateMessageTokens(message)
+	}
+	return total
+}
+
+func estimateMessageTokens(message llm.Message) int {
+	chars := len(message.Content)
+	for _, toolCall := range message.ToolCalls {
+		chars += len(toolCall.Name) + len(toolCall.Arguments)
+	}
+	tokens := 4 + (chars+3)/4
+	for _, part := range message.Parts {
+		if part.Type == llm.ContentPartText {
+			tokens += (len(part.Text) + 3) / 4
+			continue
+		}
+		tokens += estimatedImageTokens
+	}
+	return tokens
+}
+
+// elideToolOutputs replaces tool outputs, oldest first, with a placeholder
+// until the messages fit target. Results of the latest tool calls are kept,
+// since the model has not seen them yet.
+func elideToolOutputs(messages []llm.Message, target int) []llm.Message {
+	lastAssistant := -1
+	for index := len(messages) - 1; index >= 0; index-- {
+		if messages[index].Role == llm.RoleAssistant {
+			lastAssistant = index
+			break
+		}
+	}
+
+	result := append([]llm.Message(nil), messages...)
+	total := EstimateTokens(result)
+	for index := 0; index < lastAssistant && total > target; index++ {
+		message := result[index]
+		if message.Role != llm.RoleTool || (len(message.Content) < elideMinBytes && len(message.Parts) == 0) {
+			continue
+		}
+		elided := message
+		elided.Content = fmt.Sprintf("[tool output elided to save context: %d bytes, %d attachment(s)]", len(message.Content), len(message.Parts))
+		elided.Parts = nil
+		total += estimateMessageTokens(elided) - estimateMessageTokens(message)
+		result[index] = elided
+	}
+	return result
+}
+
+// slidingWindow drops the oldest messages until the rest fit target and
+// returns the kept and dropped messages. Leading system messages and the
+// latest user message are always kept. Older turns are dropped whole from
+// the front, so the first kept message is a user message; after that, whole
+// assistant steps with their tool results are dropped, keeping the latest
+// step.
+func slidingWindow(messages []llm.Message, target int) ([]llm.Message, []llm.Message) {
+	head := 0
+	for head < len(messages) && messages[head].Role == llm.RoleSystem {
+		head++
+	}
+	userIndexes := make([]int, 0)
+	for index := head; index < len(messages); index++ {
+		if messages[index].Role == llm.RoleUser {
+			userIndexes = append(userIndexes, index)
+		}
+	}
+	if len(userIndexes) == 0 {
+		return messages, nil
+	}
+
+	headTokens := EstimateTokens(messages[:head])
+	cut := userIndexes[len(userIndexes)-1]
+	for _, index := range userIndexes {
+		if headTokens+EstimateTokens(messages[index:]) <= target {
+			cut = index
+			break
+		}
+	}
+
+	kept := append(append([]llm.Message(nil), messages[:head]...), messages[cut:]...)
+	dropped := append([]llm.Message(nil), messages[head:cut]...)
+	total := EstimateTokens(kept)
+	if total <= target {
+		return kept, dropped
+	}
+
+	// Group the steps after the latest user message: each assistant
+	// message with the tool results that follow it.
+	firstStep := head + userIndexes[len(userIndexes)-1] - cut + 1
+	steps := make([][2]int, 0)
+	for index := firstStep; index < len(kept); index++ {
+		if kept[index].Role != llm.RoleAssistant {
+			continue
+		}
+		end := index + 1
+		for end < len(kept) && kept[end].Role == llm.RoleTool {
+			end++
+		}
+		steps = append(steps, [2]int{index, end})
+	}
+
+	dropUntil := firstStep
+	for _, step := range steps[:max(len(steps)-1, 0)] {
+		if total <= target {
+			break
+		}
+		total -= EstimateTokens(kept[step[0]:step[1]])
+		dropped = append(dropped, kept[step[0]:step[1]]...)
+		dropUntil = step[1]
+	}
+	if dropUntil == firstStep {
+		return kept, dropped
+	}
+	return append(append([]llm.Message(nil), kept[:firstStep]...), kept[dropUntil:]...), dropped
+}
+
+// insertSummary places the summary after the leading system messages.
+func insertSummary(messages []llm.Message, summary string) []llm.Message {
+	head := 0
+	for head < len(messages) && messages[head].Role == llm.RoleSystem {
+		head++
+	}
+	result := make([]llm.Message, 0, len(messages)+1)
+	result = append(result, messages[:head]...)
+	result = append(result, llm.Message{
+		Role:    llm.RoleSystem,
+		Content: "Summary of earlier messages that were removed to save context:\n" + summary,
+	})
+	return append(result, messages[head:]...)
+}
+
+func (compactor *Compactor) summarize(ctx context.Context, dropped []llm.Message) (string, error) {
+	if compactor.Summarizer == nil {
+		return "", fmt.Errorf("no summarizer configured")
+	}
+
+	compactor.mu.Lock()
+	defer compactor.mu.Unlock()
+
+	previous := ""
+	pending := dropped
+	cached := compactor.summary
+	if cached.count > 0 && cached.count <= len(dropped) && hashMessages(dropped[:cached.count]) == cached.hash {
+		if cached.count == len(dropped) {
+			return cached.text, nil
+		}
+		previous = cached.text
+		pending = dropped[cached.count:]
+	}
+
+	transcript := renderTranscript(pending)
+	if previous != "" {
+		transcript = "Summary so far:\n" + previous + "\n\nNew messages:\n" + transcript
+	}
+	response, err := compactor.Summarizer.Complete(ctx, llm.CompletionRequest{
+		Model: compactor.Model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: summaryInstruction},
+			{Role: llm.RoleUser, Content: transcript},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("summarize history: %w", err)
+	}
+	if len(response.Choices) == 0 || strings.TrimSpace(response.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("summarize history: empty response")
+	}
+
+	text := strings.TrimSpace(response.Choices[0].Message.Content)
+	compactor.summary = cachedSummary{count: len(dropped), hash: hashMessages(dropped), text: text}
+	return text, nil
+}
+
+func renderTranscript(messages []llm.Message) string {
+	lines := make([]string, 0, len(messages))
+	for _, message := range messages {
+		content := message.Content
+		if len(content) > summaryMessageChars {
+			content = strings.ToValidUTF8(content[:summaryMessageChars], "") + "…"
+		}
+		label := string(message.Role)
+		if message.Role == llm.RoleTool {
+			label = "tool result " + message.ToolCallID
+		}
+		line := label + ": " + content
+		for _, toolCall := range message.ToolCalls {
+			line += fmt.Sprintf("\n[calls %s %s with %s]", toolCall.Name, toolCall.ID, toolCall.Arguments)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+func hashMessages(messages []llm.Message) string {
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// longHistory returns a system prompt followed by turns user prompt, one
+// tool call with a large result, and an answer.
+func longHistory(turns int) []llm.Message {
+	history := []llm.Message{{Role: llm.RoleSystem, Content: "system"}}
+	for turn := 0; turn < turns; turn++ {
+		id := "call_" + string(rune('a'+turn))
+		history = append(history,
+			llm.Message{Role: llm.RoleUser, Content: "question"},
+			llm.Message{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{sampleToolCall(id, "Read", "{}")}},
+			llm.Message{Role: llm.RoleTool, ToolCallID: id, Content: strings.Repeat("x", 4000)},
+			llm.Message{Role: llm.RoleAssistant, Content: "answer"},
+		)
+	}
+	return history
+}
+
+func assertToolPairsConsistent(t *testing.T, messages []llm.Message) {
+	t.Helper()
+	pending := map[string]bool{}
+	for index, message := range messages {
+		for _, toolCall := range message.ToolCalls {
+			pending[toolCall.ID] = true
+		}
+		if message.Role == llm.RoleTool {
+			if !pending[message.ToolCallID] {
+				t.Fatalf("tool result %s at %d has no preceding tool call", message.ToolCallID, index)
+			}
+			delete(pending, message.ToolCallID)
+		}
+	}
+	if len(pending) > 0 {
+		t.Fatalf("tool calls without results: %v", pending)
+	}
+}
+
+func TestCompactor_LeavesSmallHistoryAlone(t *testing.T) {
+	history := longHistory(1)
+	compactor := &Compactor{Strategy: CompactionWindow, ContextWindow: 100000}
+
+	prepared, err := compactor.Prepare(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Prepare returned error: %v", err)
+	}
+	if len(prepared) != len(history) {
+		t.Fatalf("expected history unchanged, got %d of %d messages", len(prepared), len(history))
+	}
+}
+
+func TestCompactor_ElidesOldToolOutputs(t *testing.T) {
+	history := longHistory(4)
+	compactor := &Compactor{Strategy: CompactionElide, ContextWindow: 3000}
+
+	prepared, err := compactor.Prepare(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Prepare returned error: %v", err)
+	}
+	if len(prepared) != len(history) {
+		t.Fatalf("expected eliding to keep every message, got %d of %d", len(prepared), len(history))
+	}
+	if !strings.HasPrefix(prepared[3].Content, "[tool output elided") {
+		t.Fatalf("expected oldest tool output elided, got %q", prepared[3].Content[:20])
+	}
+	if EstimateTokens(prepared) > 1500 {
+		t.Fatalf("expected history below target, got %d tokens", EstimateTokens(prepared))
+	}
+	if len(history[3].Content) != 4000 {
+		t.Fatal("expected full history left untouched")
+	}
+}
+
+func TestCompactor_WindowKeepsToolPairsAndLatestPrompt(t *testing.T) {
+	history := longHistory(4)
+	history = append(history,
+		llm.Message{Role: llm.RoleUser, Content: "latest"},
+		llm.Message{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{sampleToolCall("call_y", "Read", "{}")}},
+		llm.Message{Role: llm.RoleTool, ToolCallID: "call_y", Content: strings.Repeat("y", 4000)},
+		llm.Message{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{sampleToolCall("call_z", "Read", "{}")}},
+		llm.Message{Role: llm.RoleTool, ToolCallID: "call_z", Content: "short"},
+	)
+	compactor := &Compactor{Strategy: CompactionWindow, ContextWindow: 1000}
+
+	prepared, err := compactor.Prepare(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Prepare returned error: %v", err)
+	}
+	assertToolPairsConsistent(t, prepared)
+	if prepared[0].Role != llm.RoleSystem || prepared[1].Content != "latest" {
+		t.Fatalf("expected system prompt then latest user prompt, got %+v", prepared[:2])
+	}
+	if last := prepared[len(prepared)-1]; last.ToolCallID != "call_z" {
+		t.Fatalf("expected latest tool result kept, got %+v", last)
+	}
+	if len(prepared) != 4 {
+		t.Fatalf("expected older steps of the latest prompt dropped, got %d messages", len(prepared))
+	}
+}
+
+func TestCompactor_SummarizesDroppedTurnsOnce(t *testing.T) {
+	history := longHistory(4)
+	summarizer := &queuedClient{responses: []llm.CompletionResponse{
+		responseWithText("stop", "user asked four questions about files"),
+	}}
+	compactor := &Compactor{Strategy: CompactionSummarize, ContextWindow: 4000, Summarizer: summarizer, Model: "summary-model"}
+
+	prepared, err := compactor.Prepare(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Prepare returned error: %v", err)
+	}
+	assertToolPairsConsistent(t, prepared)
+	if prepared[1].Role != llm.RoleSystem || !strings.Contains(prepared[1].Content, "four questions") {
+		t.Fatalf("expected summary after the system prompt, got %+v", prepared[1])
+	}
+	if prepared[2].Role != llm.RoleUser {
+		t.Fatalf("expected a user message after the summary, got %+v", prepared[2])
+	}
+	request := summarizer.requests[0]
+	if request.Model != "summary-model" || len(request.Tools) != 0 || !strings.Contains(request.Messages[1].Content, "question") {
+		t.Fatalf("unexpected summarization request %+v", request)
+	}
+
+	if _, err := compactor.Prepare(context.Background(), history); err != nil {
+		t.Fatalf("second Prepare returned error: %v", err)
+	}
+	if len(summarizer.requests) != 1 {
+		t.Fatalf("expected cached summary reused, got %d summarization calls", len(summarizer.requests))
+	}
+}
+
+func TestCompactor_SummaryFailureFallsBackToWindow(t *testing.T) {
+	history := longHistory(4)
+	compactor := &Compactor{Strategy: CompactionSummarize, ContextWindow: 4000, Summarizer: &queuedClient{}}
+
+	prepared, err := compactor.Prepare(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Prepare returned error: %v", err)
+	}
+	if len(prepared) >= len(history) || prepared[1].Role != llm.RoleUser {
+		t.Fatalf("expected windowed history without summary, got %d messages", len(prepared))
+	}
+}
+
+func TestParseCompactionStrategy(t *testing.T) {
+	if strategy, err := ParseCompactionStrategy(" Summarize "); err != nil || strategy != CompactionSummarize {
+		t.Fatalf("expected summarize, got %q %v", strategy, err)
+	}
+	if _, err := ParseCompactionStrategy("truncate"); err == nil {
+		t.Fatal("expected error for unknown strategy")
+	}
+}
+
+type staticContext struct {
+	keep int
+	err  error
+}
+
+func (manager staticContext) Prepare(ctx context.Context, messages []llm.Message) ([]llm.Message, error) {
+	if manager.err != nil {
+		return nil, manager.err
+	}
+	return messages[len(messages)-manager.keep:], nil
+}
+
+func TestRunPrompt_SendsPreparedContextButKeepsFullHistory(t *testing.T) {
+	history := longHistory(2)
+	client := &queuedClient{responses: []llm.CompletionResponse{responseWithText("stop", "done")}}
+	runner := Runner{
+		LLMClient: client,
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		Context: staticContext{keep: 1},
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "next", "corr-context"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if sent := client.requests[0].Messages; len(sent) != 1 || sent[0].Content != "next" {
+		t.Fatalf("expected only the prepared message sent, got %+v", sent)
+	}
+	if len(history) != 11 {
+		t.Fatalf("expected full history kept, got %d messages", len(history))
+	}
+
+	runner.Context = staticContext{err: errors.New("boom")}
+	if _, err := runner.RunPrompt(context.Background(), &history, "again", "corr-context-2"); err == nil || !strings.Contains(err.Error(), "prepare context") {
+		t.Fatalf("expected prepare context error, got %v", err)
+	}
+}
+
+func TestReminder_EndsRequestsWithoutChangingHistory(t *testing.T) {
+	history := []llm.Message{{Role: llm.RoleSystem, Content: "system"}}
+	todos := "0/1 done"
+	llmClient := &queuedClient{responses: []llm.CompletionResponse{
+		responseWithToolCalls(sampleToolCall("call_1", "Read", "{}")),
+		responseWithText("stop", "done"),
+	}}
+	runner := Runner{
+		LLMClient: llmClient,
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			todos = "1/1 done"
+			return "{}"
+		},
+		Context: Reminder{Text: func() string { return todos }},
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "continue", "corr-reminder"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	for index, expected := range []string{"System note: 0/1 done", "System note: 1/1 done"} {
+		messages := llmClient.requests[index].Messages
+		if last := messages[len(messages)-1]; last.Role != llm.RoleUser || last.Content != expected {
+			t.Fatalf("expected request %d to end with %q, got %+v", index, expected, last)
+		}
+	}
+	for _, message := range history {
+		if strings.Contains(message.Content, "System note") {
+			t.Fatalf("expected the reminder kept out of the history, got %+v", history)
+		}
+	}
+	if last := history[len(history)-1]; last.Role != llm.RoleAssistant || last.Content != "done" {
+		t.Fatalf("expected the history to end with the answer, got %+v", last)
+	}
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// Event is something that happened while running a prompt. Consumers switch
+// on the concrete type to read its payload.
+type Event interface {
+	// EventName is a stable snake_case name, for example for log records.
+	EventName() string
+}
+
+// Observer receives the events of a run. Tool events of one turn may arrive
+// from several goroutines at once, so implementations must be safe for
+// concurrent use.
+type Observer interface {
+	Observe(event Event)
+}
+
+// ObserverFunc adapts a function to an Observer.
+type ObserverFunc func(event Event)
+
+func (observe ObserverFunc) Observe(event Event) {
+	observe(event)
+}
+
+type multiObserver []Observer
+
+// MultiObserver delivers every event to each of observers in order. Nil
+// observers are skipped.
+func MultiObserver(observers ...Observer) Observer {
+	combined := make(multiObserver, 0, len(observers))
+	for _, observer := range observers {
+		if observer != nil {
+			combined = append(combined, observer)
+		}
+	}
+	return combined
+}
+
+func (observers multiObserver) Observe(event Event) {
+	for _, observer := range observers {
+		observer.Observe(event)
+	}
+}
+
+// PromptStartEvent is sent when RunPrompt accepts a prompt.
+type PromptStartEvent struct {
+	CorrelationID string
+	Prompt        string
+}
+
+// PromptEndEvent is sent when RunPrompt returns an answer. Provider and
+// Model name the route that served the last turn, and Usage covers every
+// turn of the prompt.
+type PromptEndEvent struct {
+	CorrelationID string
+	Response      string
+	Provider      string
+	Model         string
+	Turns         int
+	Usage         llm.Usage
+}
+
+// TurnStartEvent is sent before each LLM call.
+type TurnStartEvent struct {
+	CorrelationID string
+	Turn          int
+	Messages      int
+}
+
+// TurnEndEvent is sent once a turn's response has been added to the history.
+type TurnEndEvent struct {
+	CorrelationID string
+	Turn          int
+	Provider      string
+	Model         string
+	FinishReason  string
+	ToolCalls     int
+	Usage         llm.Usage
+}
+
+// AssistantDeltaEvent carries partial output while a turn is streaming.
+type AssistantDeltaEvent struct {
+	CorrelationID string
+	Turn          int
+	Delta         llm.StreamDelta
+}
+
+// ToolApprovalEvent is sent once an Approver has decided on a tool call.
+// ToolCall carries the arguments that will run, which differ from the
+// model's when Edited is set.
+type ToolApprovalEvent struct {
+	CorrelationID string
+	Turn          int
+	ToolCall      llm.ToolCall
+	Approved      bool
+	Edited        bool
+	Reason        string
+}
+
+// ToolStartEvent is sent before a tool call runs.
+type ToolStartEvent struct {
+	CorrelationID string
+	Turn          int
+	ToolCall      llm.ToolCall
+}
+
+// ToolEndEvent is sent after a tool call ran, with the result sent back to
+// the model.
+type ToolEndEvent struct {
+	CorrelationID string
+	Turn          int
+	ToolCall      llm.ToolCall
+	Result        string
+	Parts         []llm.ContentPart
+	Duration      time.Duration
+}
+
+// RepetitionEvent is sent when a tool call repeats a call or an error, see
+// RepetitionKind. Provider and Model served the turn that made the call, and
+// Aborted is set when the repetition stopped the prompt.
+type RepetitionEvent struct {
+	CorrelationID string
+	Turn          int
+	Provider      string
+	Model         string
+	ToolCall      llm.ToolCall
+	Kind          RepetitionKind
+	Repeats       int
+	Aborted       bool
+}
+
+// BudgetExceededEvent is sent when a token or cost budget stops a prompt.
+// PromptUsage is what the prompt had used so far.
+type BudgetExceededEvent struct {
+	CorrelationID string
+	Turn          int
+	PromptUsage   llm.Usage
+	Err           error
+}
+
+// OutputInvalidEvent is sent when a final answer fails the output schema.
+// Repair counts from one; once it passes MaxRepairs the prompt fails.
+type OutputInvalidEvent struct {
+	CorrelationID string
+	Turn          int
+	Repair        int
+	MaxRepairs    int
+	Err           error
+}
+
+// ContextCompactedEvent is sent when a Compactor shrinks the messages of a
+// request.
+type ContextCompactedEvent struct {
+	Strategy       CompactionStrategy
+	ContextWindow  int
+	TokensBefore   int
+	TokensAfter    int
+	MessagesBefore int
+	MessagesAfter  int
+}
+
+// ErrorEvent is sent when RunPrompt fails.
+type ErrorEvent struct {
+	CorrelationID string
+	Err           error
+}
+
+func (PromptStartEvent) EventName() string      { return "turn_request" }
+func (PromptEndEvent) EventName() string        { return "turn_complete" }
+func (TurnStartEvent) EventName() string        { return "turn_start" }
+func (TurnEndEvent) EventName() string          { return "turn_end" }
+func (AssistantDeltaEvent) EventName() string   { return "assistant_delta" }
+func (ToolApprovalEvent) EventName() string     { return "tool_approval" }
+func (ToolStartEvent) EventName() string        { return "tool_start" }
+func (ToolEndEvent) EventName() string          { return "tool_end" }
+func (RepetitionEvent) EventName() string       { return "tool_repetition" }
+func (BudgetExceededEvent) EventName() string   { return "budget_exceeded" }
+func (OutputInvalidEvent) EventName() string    { return "output_invalid" }
+func (ContextCompactedEvent) EventName() string { return "context_compacted" }
+func (ErrorEvent) EventName() string            { return "turn_error" }
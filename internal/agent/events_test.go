@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (recorder *eventRecorder) Observe(event Event) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.events = append(recorder.events, event)
+}
+
+func (recorder *eventRecorder) names() []string {
+	names := make([]string, 0, len(recorder.events))
+	for _, event := range recorder.events {
+		names = append(names, event.EventName())
+	}
+	return names
+}
+
+func TestRunPrompt_EmitsTypedEvents(t *testing.T) {
+	history := []llm.Message{}
+	finalTurn := responseWithText("stop", "all done")
+	finalTurn.Usage = llm.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}
+	recorder := &eventRecorder{}
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{
+			responseWithToolCalls(sampleToolCall("call_1", "Read", `{"path": "a b.txt"}`)),
+			finalTurn,
+		}},
+		Provider: "openrouter",
+		Model:    "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "file contents"
+		},
+		Observer: recorder,
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "read a b.txt", "corr-events"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+
+	expected := []string{"turn_request", "turn_start", "turn_end", "tool_start", "tool_end", "turn_start", "turn_end", "turn_complete"}
+	if names := recorder.names(); !slices.Equal(names, expected) {
+		t.Fatalf("expected events %v, got %v", expected, names)
+	}
+	if start := recorder.events[0].(PromptStartEvent); start.Prompt != "read a b.txt" || start.CorrelationID != "corr-events" {
+		t.Fatalf("unexpected prompt start %+v", start)
+	}
+	if toolStart := recorder.events[3].(ToolStartEvent); toolStart.ToolCall.Arguments != `{"path": "a b.txt"}` || toolStart.Turn != 1 {
+		t.Fatalf("expected tool arguments intact, got %+v", toolStart)
+	}
+	if toolEnd := recorder.events[4].(ToolEndEvent); toolEnd.Result != "file contents" || toolEnd.ToolCall.ID != "call_1" {
+		t.Fatalf("unexpected tool end %+v", toolEnd)
+	}
+	end := recorder.events[7].(PromptEndEvent)
+	if end.Response != "all done" || end.Turns != 2 || end.Usage.TotalTokens != 12 || end.Provider != "openrouter" {
+		t.Fatalf("unexpected prompt end %+v", end)
+	}
+}
+
+func TestRunPrompt_EmitsBudgetAndErrorEvents(t *testing.T) {
+	history := []llm.Message{}
+	recorder := &eventRecorder{}
+	runner := Runner{
+		LLMClient: &queuedClient{},
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		Usage:    NewUsageTracker(llm.Usage{Cost: 2}),
+		Policy:   Policy{MaxSessionCost: 1},
+		Observer: MultiObserver(nil, recorder),
+	}
+
+	_, err := runner.RunPrompt(context.Background(), &history, "spend", "corr-budget")
+	if !errors.Is(err, ErrUsageBudgetExceeded) {
+		t.Fatalf("expected ErrUsageBudgetExceeded, got %v", err)
+	}
+	if names := recorder.names(); !slices.Equal(names, []string{"turn_request", "budget_exceeded", "turn_error"}) {
+		t.Fatalf("unexpected events %v", names)
+	}
+	if failed := recorder.events[2].(ErrorEvent); !errors.Is(failed.Err, ErrUsageBudgetExceeded) {
+		t.Fatalf("expected error event to carry the budget error, got %+v", failed)
+	}
+}
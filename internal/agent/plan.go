@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+const planModeInstruction = "Plan mode is on: only read-only tools are available. Investigate as much as you need, " +
+	"then propose a concise step-by-step plan (record the steps in your todo list if you have one) and stop. " +
+	"Do not try to make changes; the user will accept the plan before you carry it out."
+
+// PlanMode keeps a run to read-only tools until the user accepts the
+// proposed plan. While it is active the model only sees read-only tool
+// definitions, is told it is planning, and any other tool call is denied. It
+// is shared by pointer so it outlasts the copies of a Runner made per turn;
+// a nil PlanMode is never active.
+type PlanMode struct {
+	// ReadOnly reports whether a tool never changes the workspace; when it
+	// is nil no tool is available while planning.
+	ReadOnly func(toolName string) bool
+
+	mu     sync.Mutex
+	active bool
+}
+
+// Active reports whether the run is still planning.
+func (plan *PlanMode) Active() bool {
+	if plan == nil {
+		return false
+	}
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+	return plan.active
+}
+
+// Enter starts planning.
+func (plan *PlanMode) Enter() {
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+	plan.active = true
+}
+
+// Accept ends planning, making every tool available again.
+func (plan *PlanMode) Accept() {
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+	plan.active = false
+}
+
+func (plan *PlanMode) allows(toolName string) bool {
+	return plan.ReadOnly != nil && plan.ReadOnly(toolName)
+}
+
+// toolDefinitions drops the definitions the model may not call while
+// planning.
+func (plan *PlanMode) toolDefinitions(definitions []llm.ToolDefinition) []llm.ToolDefinition {
+	allowed := make([]llm.ToolDefinition, 0, len(definitions))
+	for _, definition := range definitions {
+		if plan.allows(definition.Name) {
+			allowed = append(allowed, definition)
+		}
+	}
+	return allowed
+}
+
+// deny returns the reason a tool call may not run while planning, or "".
+func (plan *PlanMode) deny(toolName string) string {
+	if plan.allows(toolName) {
+		return ""
+	}
+	return fmt.Sprintf("%s is not available in plan mode; propose the plan and wait for the user to accept it", toolName)
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+func TestRunPrompt_PlanModeAllowsOnlyReadOnlyTools(t *testing.T) {
+	history := []llm.Message{{Role: llm.RoleSystem, Content: "system"}}
+	llmClient := &queuedClient{responses: []llm.CompletionResponse{
+		responseWithToolCalls(
+			sampleToolCall("call_1", "Read", `{"file_path":"main.go"}`),
+			sampleToolCall("call_2", "Bash", `{"command":"go test ./..."}`),
+		),
+		responseWithText("stop", "1. rename the field\n2. run the tests"),
+		responseWithToolCalls(sampleToolCall("call_3", "Bash", `{"command":"go test ./..."}`)),
+		responseWithText("stop", "done"),
+	}}
+	executed := []string{}
+	plan := &PlanMode{ReadOnly: readOnlyTools}
+	plan.Enter()
+	runner := Runner{
+		LLMClient: llmClient,
+		Model:     "test-model",
+		ToolDefinitions: []llm.ToolDefinition{
+			{Name: "Bash"},
+			{Name: "Read"},
+		},
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			executed = append(executed, toolCall.Name)
+			return "{}"
+		},
+		Plan: plan,
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "plan the rename", "corr-plan"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if len(executed) != 1 || executed[0] != "Read" {
+		t.Fatalf("expected only the read-only tool to run while planning, got %v", executed)
+	}
+	if denied := history[4]; denied.ToolCallID != "call_2" || !strings.Contains(denied.Content, "not available in plan mode") {
+		t.Fatalf("expected Bash denied in plan mode, got %+v", denied)
+	}
+	request := llmClient.requests[0]
+	if len(request.Tools) != 1 || request.Tools[0].Name != "Read" {
+		t.Fatalf("expected only read-only tool definitions while planning, got %+v", request.Tools)
+	}
+	if last := request.Messages[len(request.Messages)-1]; last.Role != llm.RoleSystem || !strings.Contains(last.Content, "Plan mode is on") {
+		t.Fatalf("expected plan mode instruction in the request, got %+v", last)
+	}
+	for _, message := range history {
+		if strings.Contains(message.Content, "Plan mode is on") {
+			t.Fatal("expected the plan mode instruction to stay out of the history")
+		}
+	}
+
+	plan.Accept()
+	if _, err := runner.RunPrompt(context.Background(), &history, "go ahead", "corr-plan-2"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if len(executed) != 2 || executed[1] != "Bash" {
+		t.Fatalf("expected Bash to run once the plan was accepted, got %v", executed)
+	}
+	if tools := llmClient.requests[2].Tools; len(tools) != 2 {
+		t.Fatalf("expected every tool after accepting the plan, got %+v", tools)
+	}
+}
+
+func TestRunPrompt_NotesKeepToolResultTurnsRouted(t *testing.T) {
+	history := []llm.Message{{Role: llm.RoleSystem, Content: "system"}}
+	primary := &queuedClient{responses: []llm.CompletionResponse{responseWithToolCalls(sampleToolCall("call_1", "Read", "{}"))}}
+	toolResults := &queuedClient{responses: []llm.CompletionResponse{responseWithText("stop", "planned")}}
+	plan := &PlanMode{ReadOnly: readOnlyTools}
+	plan.Enter()
+	runner := Runner{
+		LLMClient:       llm.NewRouter(primary, map[llm.TurnKind]llm.Client{llm.TurnKindToolResults: toolResults}),
+		Model:           "test-model",
+		ToolDefinitions: []llm.ToolDefinition{{Name: "Read"}},
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		Plan:    plan,
+		Context: Reminder{Text: func() string { return "0/1 done" }},
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "plan it", "corr-notes"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if len(primary.requests) != 1 || len(toolResults.requests) != 1 {
+		t.Fatalf("expected the tool result turn routed despite the notes, got main=%d tool_results=%d", len(primary.requests), len(toolResults.requests))
+	}
+	messages := toolResults.requests[0].Messages
+	if count := len(messages); !messages[count-1].Note || !messages[count-2].Note || messages[count-3].Role != llm.RoleTool {
+		t.Fatalf("expected the plan and todo notes after the tool result, got %+v", messages)
+	}
+}
@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// Reminder is a ContextManager that ends each request with a note from
+// Text, such as the todo list of a resumed session, after Next prepares the
+// messages. The note is never added to the history, so it stays current and
+// is not saved with the session. It is sent as a user message, leaving the
+// system prompt and with it the provider's cached prefix unchanged.
+type Reminder struct {
+	Next ContextManager
+	Text func() string
+}
+
+func (reminder Reminder) Prepare(ctx context.Context, messages []llm.Message) ([]llm.Message, error) {
+	if reminder.Next != nil {
+		prepared, err := reminder.Next.Prepare(ctx, messages)
+		if err != nil {
+			return nil, err
+		}
+		messages = prepared
+	}
+	if reminder.Text == nil {
+		return messages, nil
+	}
+	text := strings.TrimSpace(reminder.Text())
+	if text == "" {
+		return messages, nil
+	}
+	return append(slices.Clip(messages), llm.Message{Role: llm.RoleUser, Content: "System note: " + text, Note: true}), nil
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+var ErrRepeatedToolCalls = errors.New("tool calls keep repeating")
+
+// RepetitionKind says what repeated.
+type RepetitionKind string
+
+const (
+	// RepeatedCall is the same tool call, by name and arguments, returning
+	// the same result as before. Reading a file again after changing it is
+	// not a repetition.
+	RepeatedCall RepetitionKind = "call"
+	// RepeatedError is a tool failing with the same error as its previous
+	// call, whatever the arguments.
+	RepeatedError RepetitionKind = "error"
+)
+
+const (
+	repeatedCallNote = "System note: you already made this exact call and got the same result. " +
+		"Repeating it will not change anything; use the result you have or try a different approach."
+	repeatedErrorNote = "System note: this is the same error as your previous attempt. " +
+		"Do not retry the same approach; find the cause or try something different."
+)
+
+type repeatedOutcome struct {
+	result  string
+	repeats int
+}
+
+// repetitionTracker spots a run going in circles. It lives for one prompt
+// run.
+type repetitionTracker struct {
+	calls  map[string]*repeatedOutcome
+	errors map[string]*repeatedOutcome
+}
+
+func newRepetitionTracker() *repetitionTracker {
+	return &repetitionTracker{calls: map[string]*repeatedOutcome{}, errors: map[string]*repeatedOutcome{}}
+}
+
+// observe records a finished call and returns what it repeated and how many
+// times, or zero repeats.
+func (tracker *repetitionTracker) observe(toolCall llm.ToolCall, result string) (RepetitionKind, int) {
+	callRepeats := record(tracker.calls, toolCall.Name+"\x00"+canonicalArguments(toolCall.Arguments), result)
+
+	errorRepeats := 0
+	if message, failed := toolError(result); failed {
+		errorRepeats = record(tracker.errors, toolCall.Name, message)
+	} else {
+		delete(tracker.errors, toolCall.Name)
+	}
+
+	if errorRepeats > callRepeats {
+		return RepeatedError, errorRepeats
+	}
+	return RepeatedCall, callRepeats
+}
+
+// record counts how many times in a row key produced outcome.
+func record(outcomes map[string]*repeatedOutcome, key string, outcome string) int {
+	previous, ok := outcomes[key]
+	if !ok || previous.result != outcome {
+		outcomes[key] = &repeatedOutcome{result: outcome}
+		return 0
+	}
+	previous.repeats++
+	return previous.repeats
+}
+
+func canonicalArguments(arguments string) string {
+	var value any
+	if err := json.Unmarshal([]byte(arguments), &value); err != nil {
+		return arguments
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return arguments
+	}
+	return string(canonical)
+}
+
+func toolError(result string) (string, bool) {
+	var envelope tools.ResponseEnvelope
+	if err := json.Unmarshal([]byte(result), &envelope); err != nil || envelope.OK || envelope.Error == nil {
+		return "", false
+	}
+	return envelope.Error.Message, true
+}
+
+// withNote adds note to a tool result, as a system_note field when the
+// result is a JSON object.
+func withNote(result string, note string) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(result), &fields); err == nil && fields != nil {
+		if encodedNote, err := json.Marshal(note); err == nil {
+			fields["system_note"] = encodedNote
+			if annotated, err := json.Marshal(fields); err == nil {
+				return string(annotated)
+			}
+		}
+	}
+	return result + "\n\n" + note
+}
+
+// checkRepetitions looks for repetitions among one turn's results. The first
+// repetition of a call or error gets a corrective note in its result; once
+// one reaches Policy.MaxRepetitions the run stops with ErrRepeatedToolCalls.
+// Every result is kept either way, so the history stays valid.
+func (runner Runner) checkRepetitions(tracker *repetitionTracker, correlationID string, turnNumber int, provider, model string, toolCalls []llm.ToolCall, results []llm.Message) error {
+	var stopErr error
+	for index, toolCall := range toolCalls[:len(results)] {
+		kind, repeats := tracker.observe(toolCall, results[index].Content)
+		if repeats == 0 {
+			continue
+		}
+		aborted := runner.Policy.MaxRepetitions > 0 && repeats >= runner.Policy.MaxRepetitions
+		runner.emit(RepetitionEvent{
+			CorrelationID: correlationID,
+			Turn:          turnNumber,
+			Provider:      provider,
+			Model:         model,
+			ToolCall:      toolCall,
+			Kind:          kind,
+			Repeats:       repeats,
+			Aborted:       aborted,
+		})
+		if repeats == 1 {
+			note := repeatedCallNote
+			if kind == RepeatedError {
+				note = repeatedErrorNote
+			}
+			results[index].Content = withNote(results[index].Content, note)
+		}
+		if aborted && stopErr == nil {
+			stopErr = fmt.Errorf("%w: %s repeated the same %s %d times", ErrRepeatedToolCalls, toolCall.Name, kind, repeats)
+		}
+	}
+	return stopErr
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+func TestRunPrompt_NotesThenStopsRepeatedToolCalls(t *testing.T) {
+	history := []llm.Message{}
+	readTurn := func(id, arguments string) llm.CompletionResponse {
+		response := responseWithToolCalls(sampleToolCall(id, "Read", arguments))
+		response.Model = "loopy-model"
+		return response
+	}
+	recorder := &eventRecorder{}
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{
+			readTurn("call_1", `{"file_path":"main.go","limit":10}`),
+			readTurn("call_2", `{"limit":10, "file_path":"main.go"}`),
+			readTurn("call_3", `{"file_path":"main.go","limit":10}`),
+			responseWithText("stop", "unused"),
+		}},
+		Model: "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return tools.SuccessEnvelope(map[string]any{"content": "package main"}, nil)
+		},
+		Policy:   Policy{MaxRepetitions: 2},
+		Observer: recorder,
+	}
+
+	_, err := runner.RunPrompt(context.Background(), &history, "read main.go", "corr-loop")
+	if !errors.Is(err, ErrRepeatedToolCalls) {
+		t.Fatalf("expected ErrRepeatedToolCalls, got %v", err)
+	}
+	if first := history[2].Content; strings.Contains(first, "system_note") {
+		t.Fatalf("expected no note on the first call, got %s", first)
+	}
+	if repeated := history[4].Content; !strings.Contains(repeated, `"system_note":"System note: you already made this exact call`) || !strings.Contains(repeated, `"content":"package main"`) {
+		t.Fatalf("expected a note added to the repeated result, got %s", repeated)
+	}
+	if last := history[len(history)-1]; last.ToolCallID != "call_3" || strings.Contains(last.Content, "system_note") {
+		t.Fatalf("expected the aborting call's result kept without another note, got %+v", last)
+	}
+
+	events := []RepetitionEvent{}
+	for _, event := range recorder.events {
+		if repetition, ok := event.(RepetitionEvent); ok {
+			events = append(events, repetition)
+		}
+	}
+	if len(events) != 2 || events[0].Repeats != 1 || events[0].Aborted || !events[1].Aborted || events[1].Model != "loopy-model" || events[1].Kind != RepeatedCall {
+		t.Fatalf("unexpected repetition events %+v", events)
+	}
+}
+
+func TestRepetitionTracker_ChangedResultsAndRepeatedErrors(t *testing.T) {
+	tracker := newRepetitionTracker()
+	read := sampleToolCall("call_1", "Read", `{"file_path":"a.go"}`)
+	if _, repeats := tracker.observe(read, `{"ok":true,"data":"v1"}`); repeats != 0 {
+		t.Fatalf("expected first call not to repeat, got %d", repeats)
+	}
+	if _, repeats := tracker.observe(read, `{"ok":true,"data":"v2"}`); repeats != 0 {
+		t.Fatalf("expected a changed result not to count as a repetition, got %d", repeats)
+	}
+
+	failure := tools.ErrorEnvelope("Bash: error executing bash command: exit status 1", nil)
+	tracker.observe(sampleToolCall("call_2", "Bash", `{"command":"go test ./a"}`), failure)
+	kind, repeats := tracker.observe(sampleToolCall("call_3", "Bash", `{"command":"go test ./a/..."}`), failure)
+	if kind != RepeatedError || repeats != 1 {
+		t.Fatalf("expected the same error from different arguments to repeat, got %s %d", kind, repeats)
+	}
+	tracker.observe(sampleToolCall("call_4", "Bash", `{"command":"ls"}`), `{"ok":true}`)
+	if _, repeats := tracker.observe(sampleToolCall("call_5", "Bash", `{"command":"go vet"}`), failure); repeats != 0 {
+		t.Fatalf("expected a success to reset the error streak, got %d", repeats)
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sort"
-	"strconv"
+	"slices"
 	"strings"
 
+	"github.com/adriankopytko/ShimiBot/internal/jsonschema"
 	"github.com/adriankopytko/ShimiBot/internal/llm"
 	"github.com/adriankopytko/ShimiBot/internal/tools"
 )
@@ -15,44 +15,173 @@ import (
 var (
 	ErrMaxTurnsExceeded       = errors.New("max turns exceeded")
 	ErrToolCallBudgetExceeded = errors.New("tool call budget exceeded")
+	ErrUsageBudgetExceeded    = errors.New("usage budget exceeded")
+	ErrInvalidOutput          = errors.New("final response does not match output schema")
 )
 
+// BudgetError reports a run stopped by its turn or tool call budget. Err is
+// ErrMaxTurnsExceeded or ErrToolCallBudgetExceeded with the limits, so
+// errors.Is matches either. With WrapUp, Summary is the model's account of
+// its progress, which RunPrompt also returns as its text.
+type BudgetError struct {
+	Err     error
+	Summary string
+}
+
+func (budgetErr *BudgetError) Error() string {
+	return budgetErr.Err.Error()
+}
+
+func (budgetErr *BudgetError) Unwrap() error {
+	return budgetErr.Err
+}
+
 type Logger interface {
 	Debugf(format string, args ...interface{})
 	Infof(format string, args ...interface{})
 	Warnf(format string, args ...interface{})
 }
 
+// Policy limits a prompt run. Zero values mean no limit. Token and cost
+// budgets are checked before each LLM call, so a run stops between turns
+// rather than in the middle of executing tool calls.
 type Policy struct {
 	MaxTurns     int
 	MaxToolCalls int
+	// MaxRepetitions stops a run once a tool call has repeated this many
+	// times, see RepetitionKind. Repetitions are noted to the model either
+	// way.
+	MaxRepetitions int
+
+	MaxPromptTokens  int
+	MaxSessionTokens int
+	MaxPromptCost    float64
+	MaxSessionCost   float64
 }
 
 type Runner struct {
-	LLMClient       llm.Client
+	LLMClient llm.Client
+	// Provider and Model describe the primary route. Responses from composite
+	// clients name the provider and model that actually served them.
+	Provider        string
 	Model           string
 	ToolDefinitions []llm.ToolDefinition
 	ExecuteTool     func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string
 	Logger          Logger
 	Policy          Policy
+	// ExecuteToolWithParts, when set, is used instead of ExecuteTool and may
+	// return content parts, such as images, to attach to the tool result.
+	ExecuteToolWithParts func(ctx context.Context, correlationID string, toolCall llm.ToolCall) (string, []llm.ContentPart)
+	// Observer, when set, receives typed events as the run progresses.
+	Observer Observer
+	// Stream requests streamed responses when LLMClient supports them; the
+	// partial output is sent to Observer as AssistantDeltaEvents.
+	Stream bool
+	// Usage, when set, accumulates token usage per prompt and per session.
+	Usage *UsageTracker
+	// Prices estimates cost for providers that do not report it.
+	Prices llm.PriceTable
+	// Options are sent with every request. A tool choice that forces a tool
+	// call only applies to the first turn of a prompt; later turns use auto
+	// so the model can answer with the tool results.
+	Options llm.RequestOptions
+	// OutputSchema, when set, is sent as the response format and the final
+	// answer must validate against it. An invalid answer is sent back with the
+	// validation problems up to MaxOutputRepairs times before RunPrompt fails
+	// with ErrInvalidOutput. On success RunPrompt returns only the JSON.
+	OutputSchema     *jsonschema.Schema
+	MaxOutputRepairs int
+	// Context, when set, chooses the messages sent each turn, for example to
+	// compact a long history. messageHistory itself always keeps every
+	// message.
+	Context ContextManager
+	// MaxConcurrentTools is how many tool calls of one turn may run at once;
+	// zero or one runs them one after another. ConcurrencySafe reports
+	// whether a tool may run alongside others; when it is nil every tool
+	// may. Results are always appended in call order.
+	MaxConcurrentTools int
+	ConcurrencySafe    func(toolName string) bool
+	// Approver, when set, decides whether each tool call runs. A denied call
+	// gets an error result with the reason so the model can adjust.
+	Approver Approver
+	// Plan, when active, limits the run to read-only tools until the user
+	// accepts the plan.
+	Plan *PlanMode
+	// WrapUp, when the turn or tool call budget runs out, makes one more
+	// completion without tool calls in which the model summarizes its
+	// progress, what remains and the next steps.
+	WrapUp bool
+	// Checkpointer, when set, saves the history as the run progresses.
+	Checkpointer Checkpointer
 }
 
+// RunPrompt appends prompt to messageHistory and runs the agent loop until
+// the model answers. Tool calls an earlier, interrupted run left without a
+// result are answered first, see RepairToolCalls.
 func (runner Runner) RunPrompt(ctx context.Context, messageHistory *[]llm.Message, prompt string, correlationID string) (string, error) {
-	if runner.LLMClient == nil {
-		return "", errors.New("agent runner missing llm client")
-	}
-	if runner.ExecuteTool == nil {
-		return "", errors.New("agent runner missing tool executor")
+	if err := runner.validate(); err != nil {
+		return "", err
 	}
-
+	*messageHistory, _ = RepairToolCalls(*messageHistory)
 	*messageHistory = append(*messageHistory, llm.Message{
 		Role:    llm.RoleUser,
 		Content: prompt,
 	})
+	return runner.run(ctx, messageHistory, prompt, correlationID)
+}
 
+// Resume continues a run that was interrupted, for example by a crash, from
+// its checkpointed history: dangling tool calls are answered as interrupted
+// and the agent loop carries on without a new prompt. A history that
+// already ends with the model's answer is returned as is.
+func (runner Runner) Resume(ctx context.Context, messageHistory *[]llm.Message, correlationID string) (string, error) {
+	if err := runner.validate(); err != nil {
+		return "", err
+	}
+	*messageHistory, _ = RepairToolCalls(*messageHistory)
+	history := *messageHistory
+	if !slices.ContainsFunc(history, func(message llm.Message) bool { return message.Role == llm.RoleUser }) {
+		return "", errors.New("nothing to resume: the history has no prompt")
+	}
+	if last := history[len(history)-1]; last.Role == llm.RoleAssistant && len(last.ToolCalls) == 0 {
+		return last.Content, nil
+	}
+	return runner.run(ctx, messageHistory, "", correlationID)
+}
+
+func (runner Runner) validate() error {
+	if runner.LLMClient == nil {
+		return errors.New("agent runner missing llm client")
+	}
+	if runner.ExecuteTool == nil && runner.ExecuteToolWithParts == nil {
+		return errors.New("agent runner missing tool executor")
+	}
+	return nil
+}
+
+func (runner Runner) run(ctx context.Context, messageHistory *[]llm.Message, prompt string, correlationID string) (string, error) {
+	ctx = llm.WithCorrelationID(ctx, correlationID)
+
+	runner.emit(PromptStartEvent{CorrelationID: correlationID, Prompt: prompt})
+	runner.checkpoint(*messageHistory)
+	responseText, err := runner.runPrompt(ctx, messageHistory, correlationID)
+	if err != nil {
+		runner.emit(ErrorEvent{CorrelationID: correlationID, Err: err})
+	}
+	return responseText, err
+}
+
+func (runner Runner) runPrompt(ctx context.Context, messageHistory *[]llm.Message, correlationID string) (string, error) {
 	turnNumber := 1
 	toolCallsUsed := 0
+	outputRepairs := 0
 	lastAssistantText := ""
+	sessionUsageBefore := runner.Usage.Session()
+	promptUsage := llm.Usage{}
+	lastTurnUsage := llm.Usage{}
+	servedProvider, servedModel := runner.Provider, runner.Model
+	repetitions := newRepetitionTracker()
+	runner.Usage.beginPrompt()
 
 	for {
 		if err := ctx.Err(); err != nil {
@@ -60,23 +189,59 @@ func (runner Runner) RunPrompt(ctx context.Context, messageHistory *[]llm.Messag
 		}
 
 		if runner.Policy.MaxTurns > 0 && turnNumber > runner.Policy.MaxTurns {
-			return lastAssistantText, fmt.Errorf("%w: limit=%d", ErrMaxTurnsExceeded, runner.Policy.MaxTurns)
+			return runner.budgetExhausted(ctx, correlationID, turnNumber, messageHistory, lastAssistantText,
+				fmt.Errorf("%w: limit=%d", ErrMaxTurnsExceeded, runner.Policy.MaxTurns))
 		}
 
-		runner.infoEvent("turn_start", map[string]any{
-			"correlation_id": correlationID,
-			"turn":           turnNumber,
-			"messages":       len(*messageHistory),
-		})
+		usedByPrompt, usedBySession := promptUsage, sessionUsageBefore.Add(promptUsage)
+		if runner.Usage != nil {
+			// The tracker also holds what sub-agents spent on this prompt.
+			usedByPrompt, usedBySession = runner.Usage.Prompt(), runner.Usage.Session()
+		}
+		if err := runner.Policy.checkUsage(usedByPrompt, usedBySession, lastTurnUsage); err != nil {
+			runner.emit(BudgetExceededEvent{CorrelationID: correlationID, Turn: turnNumber, PromptUsage: usedByPrompt, Err: err})
+			return lastAssistantText, err
+		}
+
+		runner.emit(TurnStartEvent{CorrelationID: correlationID, Turn: turnNumber, Messages: len(*messageHistory)})
 		runner.debugf("starting agent turn %d with %d message(s)", turnNumber, len(*messageHistory))
-		resp, err := runner.LLMClient.Complete(ctx, llm.CompletionRequest{
-			Model:    runner.Model,
-			Messages: *messageHistory,
-			Tools:    runner.ToolDefinitions,
+		options := runner.Options
+		if turnNumber > 1 && options.ToolChoice.Forces() {
+			options.ToolChoice = nil
+		}
+		if runner.OutputSchema != nil && options.ResponseFormat == nil {
+			options.ResponseFormat = &llm.ResponseFormat{Name: runner.OutputSchema.Name(), Schema: runner.OutputSchema.Document()}
+		}
+		requestMessages := *messageHistory
+		if runner.Context != nil {
+			prepared, err := runner.Context.Prepare(ctx, requestMessages)
+			if err != nil {
+				return lastAssistantText, fmt.Errorf("prepare context: %w", err)
+			}
+			requestMessages = prepared
+		}
+		toolDefinitions := runner.ToolDefinitions
+		if runner.Plan.Active() {
+			toolDefinitions = runner.Plan.toolDefinitions(toolDefinitions)
+			if options.ToolChoice != nil && options.ToolChoice.Mode == llm.ToolChoiceTool && !runner.Plan.allows(options.ToolChoice.Name) {
+				options.ToolChoice = nil
+			}
+			requestMessages = append(slices.Clip(requestMessages), llm.Message{Role: llm.RoleSystem, Content: planModeInstruction, Note: true})
+		}
+		resp, err := runner.complete(ctx, correlationID, turnNumber, llm.CompletionRequest{
+			Model:          runner.Model,
+			Messages:       requestMessages,
+			Tools:          toolDefinitions,
+			RequestOptions: options,
 		})
 		if err != nil {
 			return "", err
 		}
+		var turnUsage llm.Usage
+		turnUsage, servedProvider, servedModel = runner.recordUsage(resp)
+		promptUsage = promptUsage.Add(turnUsage)
+		lastTurnUsage = turnUsage
+
 		if len(resp.Choices) == 0 {
 			return "", errors.New("no choices in response")
 		}
@@ -85,9 +250,11 @@ func (runner Runner) RunPrompt(ctx context.Context, messageHistory *[]llm.Messag
 		message := choice.Message
 
 		assistantMessage := llm.Message{
-			Role:      llm.RoleAssistant,
-			Content:   message.Content,
-			ToolCalls: make([]llm.ToolCall, 0, len(message.ToolCalls)),
+			Role:            llm.RoleAssistant,
+			Content:         message.Content,
+			Reasoning:       message.Reasoning,
+			ReasoningBlocks: message.ReasoningBlocks,
+			ToolCalls:       make([]llm.ToolCall, 0, len(message.ToolCalls)),
 		}
 		for _, toolCall := range message.ToolCalls {
 			normalizedToolCall := toolCall
@@ -114,6 +281,7 @@ func (runner Runner) RunPrompt(ctx context.Context, messageHistory *[]llm.Messag
 		}
 
 		*messageHistory = append(*messageHistory, assistantMessage)
+		runner.checkpoint(*messageHistory)
 
 		if strings.TrimSpace(assistantMessage.Content) != "" {
 			lastAssistantText = assistantMessage.Content
@@ -122,48 +290,61 @@ func (runner Runner) RunPrompt(ctx context.Context, messageHistory *[]llm.Messag
 		}
 
 		toolCallCount := len(assistantMessage.ToolCalls)
-		runner.infoEvent("turn_end", map[string]any{
-			"correlation_id": correlationID,
-			"turn":           turnNumber,
-			"finish_reason":  choice.FinishReason,
-			"tool_calls":     toolCallCount,
+		runner.emit(TurnEndEvent{
+			CorrelationID: correlationID,
+			Turn:          turnNumber,
+			Provider:      servedProvider,
+			Model:         servedModel,
+			FinishReason:  choice.FinishReason,
+			ToolCalls:     toolCallCount,
+			Usage:         turnUsage,
 		})
 		runner.infof("turn %d finished with reason=%s tool_calls=%d", turnNumber, choice.FinishReason, toolCallCount)
 		if choice.FinishReason == "stop" || toolCallCount == 0 {
-			runner.debugf("agent loop stopping on turn %d", turnNumber)
-			break
+			if runner.OutputSchema == nil {
+				runner.debugf("agent loop stopping on turn %d", turnNumber)
+				break
+			}
+			structured, err := runner.OutputSchema.ValidateText(lastAssistantText)
+			if err == nil {
+				runner.debugf("agent loop stopping on turn %d with valid structured output", turnNumber)
+				lastAssistantText = structured
+				break
+			}
+			runner.emit(OutputInvalidEvent{
+				CorrelationID: correlationID,
+				Turn:          turnNumber,
+				Repair:        outputRepairs + 1,
+				MaxRepairs:    runner.MaxOutputRepairs,
+				Err:           err,
+			})
+			if outputRepairs >= runner.MaxOutputRepairs {
+				return lastAssistantText, fmt.Errorf("%w: %w", ErrInvalidOutput, err)
+			}
+			outputRepairs++
+			*messageHistory = append(*messageHistory, llm.Message{
+				Role:    llm.RoleUser,
+				Content: outputRepairPrompt(err),
+			})
+			turnNumber++
+			continue
 		}
 
 		if runner.Policy.MaxToolCalls > 0 && toolCallsUsed+toolCallCount > runner.Policy.MaxToolCalls {
-			return lastAssistantText, fmt.Errorf("%w: limit=%d used=%d requested=%d", ErrToolCallBudgetExceeded, runner.Policy.MaxToolCalls, toolCallsUsed, toolCallCount)
+			budgetErr := fmt.Errorf("%w: limit=%d used=%d requested=%d", ErrToolCallBudgetExceeded, runner.Policy.MaxToolCalls, toolCallsUsed, toolCallCount)
+			*messageHistory = append(*messageHistory, skippedToolResults(assistantMessage.ToolCalls, budgetErr)...)
+			runner.checkpoint(*messageHistory)
+			return runner.budgetExhausted(ctx, correlationID, turnNumber+1, messageHistory, lastAssistantText, budgetErr)
 		}
 
-		for _, toolCall := range assistantMessage.ToolCalls {
-			if err := ctx.Err(); err != nil {
-				return lastAssistantText, err
-			}
-
-			runner.infoEvent("tool_start", map[string]any{
-				"correlation_id": correlationID,
-				"turn":           turnNumber,
-				"tool_call_id":   toolCall.ID,
-				"tool":           toolCall.Name,
-			})
-			runner.infof("executing tool call id=%s name=%s", toolCall.ID, toolCall.Name)
-			toolResponse := runner.ExecuteTool(ctx, correlationID, toolCall)
-			runner.infoEvent("tool_end", map[string]any{
-				"correlation_id":  correlationID,
-				"turn":            turnNumber,
-				"tool_call_id":    toolCall.ID,
-				"tool":            toolCall.Name,
-				"response_bytes":  len(toolResponse),
-			})
-			runner.debugf("tool call id=%s completed with %d byte(s) response", toolCall.ID, len(toolResponse))
-			*messageHistory = append(*messageHistory, llm.Message{
-				Role:       llm.RoleTool,
-				Content:    toolResponse,
-				ToolCallID: toolCall.ID,
-			})
+		toolResults, err := runner.executeToolCalls(ctx, correlationID, turnNumber, assistantMessage.ToolCalls, runner.resultCheckpoint(*messageHistory))
+		if err == nil {
+			err = runner.checkRepetitions(repetitions, correlationID, turnNumber, servedProvider, servedModel, assistantMessage.ToolCalls, toolResults)
+		}
+		*messageHistory = append(*messageHistory, toolResults...)
+		runner.checkpoint(*messageHistory)
+		if err != nil {
+			return lastAssistantText, err
 		}
 
 		toolCallsUsed += toolCallCount
@@ -171,9 +352,89 @@ func (runner Runner) RunPrompt(ctx context.Context, messageHistory *[]llm.Messag
 	}
 
 	runner.debugf("assistant completed and produced final response")
+	runner.emit(PromptEndEvent{
+		CorrelationID: correlationID,
+		Response:      lastAssistantText,
+		Provider:      servedProvider,
+		Model:         servedModel,
+		Turns:         turnNumber,
+		Usage:         promptUsage,
+	})
 	return lastAssistantText, nil
 }
 
+// recordUsage adds resp's usage, with its cost estimated when the provider
+// did not report one, to the tracker and returns it with the provider and
+// model that served resp.
+func (runner Runner) recordUsage(resp llm.CompletionResponse) (llm.Usage, string, string) {
+	provider, model := runner.Provider, runner.Model
+	if resp.Model != "" {
+		provider, model = resp.Provider, resp.Model
+	}
+	usage := resp.Usage
+	if usage.Cost == 0 {
+		if cost, ok := runner.Prices.Cost(model, usage); ok {
+			usage.Cost = cost
+		}
+	}
+	runner.Usage.add(usage)
+	runner.Usage.recordRoute(provider, model)
+	return usage, provider, model
+}
+
+// outputRepairPrompt asks the model to correct an answer that failed schema
+// validation.
+func outputRepairPrompt(err error) string {
+	problems := []string{err.Error()}
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		problems = validationErr.Problems
+	}
+	return "Your final answer does not match the required JSON Schema:\n- " + strings.Join(problems, "\n- ") +
+		"\nReply with only the corrected JSON document."
+}
+
+// checkUsage reports whether another turn would exceed a budget. The next turn
+// is assumed to cost at least as much as the previous one, since it resends
+// the same history plus the latest tool results.
+func (policy Policy) checkUsage(prompt, session, nextTurn llm.Usage) error {
+	if wouldExceed(prompt.TotalTokens, nextTurn.TotalTokens, policy.MaxPromptTokens) {
+		return fmt.Errorf("%w: prompt token limit=%d used=%d", ErrUsageBudgetExceeded, policy.MaxPromptTokens, prompt.TotalTokens)
+	}
+	if wouldExceed(session.TotalTokens, nextTurn.TotalTokens, policy.MaxSessionTokens) {
+		return fmt.Errorf("%w: session token limit=%d used=%d", ErrUsageBudgetExceeded, policy.MaxSessionTokens, session.TotalTokens)
+	}
+	if wouldExceed(prompt.Cost, nextTurn.Cost, policy.MaxPromptCost) {
+		return fmt.Errorf("%w: prompt cost limit=$%.4f used=$%.4f", ErrUsageBudgetExceeded, policy.MaxPromptCost, prompt.Cost)
+	}
+	if wouldExceed(session.Cost, nextTurn.Cost, policy.MaxSessionCost) {
+		return fmt.Errorf("%w: session cost limit=$%.4f used=$%.4f", ErrUsageBudgetExceeded, policy.MaxSessionCost, session.Cost)
+	}
+	return nil
+}
+
+func wouldExceed[T int | float64](used, next, limit T) bool {
+	return limit > 0 && (used >= limit || used+next > limit)
+}
+
+func (runner Runner) complete(ctx context.Context, correlationID string, turnNumber int, request llm.CompletionRequest) (llm.CompletionResponse, error) {
+	if runner.Stream {
+		if streamingClient, ok := runner.LLMClient.(llm.StreamingClient); ok {
+			return streamingClient.CompleteStream(ctx, request, func(delta llm.StreamDelta) {
+				runner.emit(AssistantDeltaEvent{CorrelationID: correlationID, Turn: turnNumber, Delta: delta})
+			})
+		}
+	}
+	return runner.LLMClient.Complete(ctx, request)
+}
+
+func (runner Runner) executeTool(ctx context.Context, correlationID string, toolCall llm.ToolCall) (string, []llm.ContentPart) {
+	if runner.ExecuteToolWithParts != nil {
+		return runner.ExecuteToolWithParts(ctx, correlationID, toolCall)
+	}
+	return runner.ExecuteTool(ctx, correlationID, toolCall), nil
+}
+
 func (runner Runner) debugf(format string, args ...interface{}) {
 	if runner.Logger == nil {
 		return
@@ -195,44 +456,8 @@ func (runner Runner) warnf(format string, args ...interface{}) {
 	runner.Logger.Warnf(format, args...)
 }
 
-func (runner Runner) infoEvent(event string, fields map[string]any) {
-	if runner.Logger == nil {
-		return
-	}
-	runner.Logger.Infof("event=%s %s", event, formatFields(fields))
-}
-
-func formatFields(fields map[string]any) string {
-	if len(fields) == 0 {
-		return ""
-	}
-	keys := make([]string, 0, len(fields))
-	for key := range fields {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
-
-	parts := make([]string, 0, len(keys))
-	for _, key := range keys {
-		parts = append(parts, key+"="+formatFieldValue(fields[key]))
-	}
-	return strings.Join(parts, " ")
-}
-
-func formatFieldValue(value any) string {
-	switch typed := value.(type) {
-	case string:
-		return strings.ReplaceAll(typed, " ", "_")
-	case int:
-		return strconv.Itoa(typed)
-	case int64:
-		return strconv.FormatInt(typed, 10)
-	case bool:
-		if typed {
-			return "true"
-		}
-		return "false"
-	default:
-		return fmt.Sprintf("%v", typed)
+func (runner Runner) emit(event Event) {
+	if runner.Observer != nil {
+		runner.Observer.Observe(event)
 	}
 }
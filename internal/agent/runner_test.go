@@ -3,8 +3,11 @@ package agent
 import (
 	"context"
 	"errors"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/adriankopytko/ShimiBot/internal/jsonschema"
 	"github.com/adriankopytko/ShimiBot/internal/llm"
 )
 
@@ -134,6 +137,59 @@ func TestRunPrompt_EnforcesMaxTurns(t *testing.T) {
 	}
 }
 
+func TestRunPrompt_StopsBeforeTurnThatWouldExceedTokenBudget(t *testing.T) {
+	history := []llm.Message{}
+	toolTurn := responseWithToolCalls(sampleToolCall("call_1", "ListDir", "{}"))
+	toolTurn.Usage = llm.Usage{PromptTokens: 600, CompletionTokens: 50, TotalTokens: 650}
+	llmClient := &queuedClient{responses: []llm.CompletionResponse{toolTurn, responseWithText("stop", "unused")}}
+	toolExecutions := 0
+	runner := Runner{
+		LLMClient: llmClient,
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			toolExecutions++
+			return "{}"
+		},
+		Policy: Policy{MaxPromptTokens: 1000},
+	}
+
+	_, err := runner.RunPrompt(context.Background(), &history, "budget", "corr-tokens")
+	if !errors.Is(err, ErrUsageBudgetExceeded) {
+		t.Fatalf("expected ErrUsageBudgetExceeded, got %v", err)
+	}
+	if toolExecutions != 1 {
+		t.Fatalf("expected pending tool call to finish before stopping, got %d executions", toolExecutions)
+	}
+	if llmClient.index != 1 {
+		t.Fatalf("expected no second LLM call, got %d calls", llmClient.index)
+	}
+	if last := history[len(history)-1]; last.Role != llm.RoleTool || last.ToolCallID != "call_1" {
+		t.Fatalf("expected history to end with the answered tool call, got %+v", last)
+	}
+}
+
+func TestRunPrompt_SessionCostBudgetAlreadySpent(t *testing.T) {
+	history := []llm.Message{}
+	llmClient := &queuedClient{responses: []llm.CompletionResponse{responseWithText("stop", "unused")}}
+	runner := Runner{
+		LLMClient: llmClient,
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		Usage:  NewUsageTracker(llm.Usage{TotalTokens: 10, Cost: 2.5}),
+		Policy: Policy{MaxSessionCost: 2.5},
+	}
+
+	_, err := runner.RunPrompt(context.Background(), &history, "budget", "corr-cost")
+	if !errors.Is(err, ErrUsageBudgetExceeded) {
+		t.Fatalf("expected ErrUsageBudgetExceeded, got %v", err)
+	}
+	if llmClient.index != 0 {
+		t.Fatalf("expected no LLM call once session budget is spent, got %d", llmClient.index)
+	}
+}
+
 func TestRunPrompt_ContextCancelled(t *testing.T) {
 	history := []llm.Message{}
 	llmClient := &queuedClient{responses: []llm.CompletionResponse{responseWithText("stop", "unused")}}
@@ -154,12 +210,298 @@ func TestRunPrompt_ContextCancelled(t *testing.T) {
 	}
 }
 
+func TestRunPrompt_ForwardsStreamDeltas(t *testing.T) {
+	history := []llm.Message{}
+	llmClient := &streamingQueuedClient{
+		queuedClient: queuedClient{responses: []llm.CompletionResponse{responseWithText("stop", "hello world")}},
+		deltas:       []llm.StreamDelta{{Content: "hello "}, {Content: "world"}},
+	}
+	streamed := ""
+	runner := Runner{
+		LLMClient: llmClient,
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		Stream: true,
+		Observer: ObserverFunc(func(event Event) {
+			if delta, ok := event.(AssistantDeltaEvent); ok {
+				streamed += delta.Delta.Content
+			}
+		}),
+	}
+
+	responseText, err := runner.RunPrompt(context.Background(), &history, "stream", "corr-stream")
+	if err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if streamed != "hello world" {
+		t.Fatalf("expected streamed deltas forwarded, got %q", streamed)
+	}
+	if responseText != "hello world" {
+		t.Fatalf("expected response text hello world, got %q", responseText)
+	}
+	if llmClient.streamCalls != 1 {
+		t.Fatalf("expected streaming path used once, got %d", llmClient.streamCalls)
+	}
+}
+
+func TestRunPrompt_AccumulatesUsageAndEstimatesCost(t *testing.T) {
+	history := []llm.Message{}
+	toolTurn := responseWithToolCalls(sampleToolCall("call_1", "ListDir", "{}"))
+	toolTurn.Usage = llm.Usage{PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100}
+	finalTurn := responseWithText("stop", "done")
+	finalTurn.Usage = llm.Usage{PromptTokens: 2000, CompletionTokens: 50, CachedTokens: 1000, TotalTokens: 2050, Cost: 0.5}
+
+	tracker := NewUsageTracker(llm.Usage{PromptTokens: 7, TotalTokens: 7})
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{toolTurn, finalTurn}},
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		Usage:  tracker,
+		Prices: llm.PriceTable{"test-model": {PromptPerMillion: 1000, CompletionPerMillion: 1000}},
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "usage", "corr-usage"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+
+	promptUsage := tracker.Prompt()
+	if promptUsage.PromptTokens != 3000 || promptUsage.CompletionTokens != 150 || promptUsage.CachedTokens != 1000 {
+		t.Fatalf("expected per-prompt token totals, got %+v", promptUsage)
+	}
+	// First turn is estimated from the price table (1.1), second keeps the provider cost (0.5).
+	if promptUsage.Cost < 1.599 || promptUsage.Cost > 1.601 {
+		t.Fatalf("expected prompt cost 1.6, got %f", promptUsage.Cost)
+	}
+	if tracker.Session().PromptTokens != 3007 {
+		t.Fatalf("expected session usage to include prior usage, got %+v", tracker.Session())
+	}
+}
+
+func TestRunPrompt_RecordsServedRoute(t *testing.T) {
+	history := []llm.Message{}
+	served := responseWithText("stop", "done")
+	served.Provider = "ollama"
+	served.Model = "fallback-model"
+	served.Usage = llm.Usage{PromptTokens: 1000, TotalTokens: 1000}
+
+	tracker := NewUsageTracker(llm.Usage{})
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{served}},
+		Provider:  "openrouter",
+		Model:     "primary-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		Usage:  tracker,
+		Prices: llm.PriceTable{"primary-model": {PromptPerMillion: 1000}, "fallback-model": {PromptPerMillion: 1}},
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "route", "corr-route"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+
+	provider, model := tracker.LastRoute()
+	if provider != "ollama" || model != "fallback-model" {
+		t.Fatalf("expected served route ollama/fallback-model, got %s/%s", provider, model)
+	}
+	if cost := tracker.Prompt().Cost; cost < 0.00099 || cost > 0.00101 {
+		t.Fatalf("expected cost priced for the served model, got %f", cost)
+	}
+}
+
+func TestRunPrompt_KeepsReasoningInHistory(t *testing.T) {
+	history := []llm.Message{}
+	thinking := responseWithToolCalls(sampleToolCall("call_1", "ListDir", "{}"))
+	thinking.Choices[0].Message.Reasoning = "list first"
+	thinking.Choices[0].Message.ReasoningBlocks = []llm.ReasoningBlock{{Type: "thinking", Text: "list first", Signature: "sig"}}
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{thinking, responseWithText("stop", "done")}},
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "list", "corr-reasoning"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if assistant := history[1]; assistant.Reasoning != "list first" || len(assistant.ReasoningBlocks) != 1 || assistant.ReasoningBlocks[0].Signature != "sig" {
+		t.Fatalf("expected reasoning kept on the assistant message, got %+v", assistant)
+	}
+}
+
+func TestRunPrompt_ForcedToolChoiceOnlyAppliesToFirstTurn(t *testing.T) {
+	history := []llm.Message{}
+	maxTokens := 128
+	client := &queuedClient{responses: []llm.CompletionResponse{
+		responseWithToolCalls(sampleToolCall("call_1", "ListDir", "{}")),
+		responseWithText("stop", "done"),
+	}}
+	runner := Runner{
+		LLMClient: client,
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		Options: llm.RequestOptions{MaxTokens: maxTokens, ToolChoice: llm.ParseToolChoice("ListDir")},
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "list", "corr-choice"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if len(client.requests) != 2 {
+		t.Fatalf("expected two requests, got %d", len(client.requests))
+	}
+	first, second := client.requests[0], client.requests[1]
+	if first.ToolChoice == nil || first.ToolChoice.Name != "ListDir" || first.MaxTokens != maxTokens {
+		t.Fatalf("expected forced ListDir and max tokens on first turn, got %+v", first.RequestOptions)
+	}
+	if second.ToolChoice != nil || second.MaxTokens != maxTokens {
+		t.Fatalf("expected tool choice dropped but max tokens kept on second turn, got %+v", second.RequestOptions)
+	}
+}
+
+func TestRunPrompt_RepairsInvalidStructuredOutput(t *testing.T) {
+	schema, err := jsonschema.Parse([]byte(`{"type":"object","required":["answer"],"properties":{"answer":{"type":"integer"}}}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	history := []llm.Message{}
+	client := &queuedClient{responses: []llm.CompletionResponse{
+		responseWithText("stop", `{"answer":"four"}`),
+		responseWithText("stop", "```json\n{\"answer\": 4}\n```"),
+	}}
+	runner := Runner{
+		LLMClient: client,
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		OutputSchema:     schema,
+		MaxOutputRepairs: 1,
+	}
+
+	result, err := runner.RunPrompt(context.Background(), &history, "2+2?", "corr-schema")
+	if err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if result != `{"answer": 4}` {
+		t.Fatalf("expected only the validated JSON, got %q", result)
+	}
+	if format := client.requests[0].ResponseFormat; format == nil || format.Name != "response" || format.Schema["type"] != "object" {
+		t.Fatalf("expected schema sent as response format, got %+v", format)
+	}
+	repair := history[2]
+	if repair.Role != llm.RoleUser || !strings.Contains(repair.Content, `$.answer: expected integer, got string`) {
+		t.Fatalf("expected repair prompt with validation problems, got %+v", repair)
+	}
+}
+
+func TestRunPrompt_FailsWhenStructuredOutputNeverValidates(t *testing.T) {
+	schema, err := jsonschema.Parse([]byte(`{"type":"object"}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	history := []llm.Message{}
+	client := &queuedClient{responses: []llm.CompletionResponse{
+		responseWithText("stop", "not json"),
+		responseWithText("stop", "still not json"),
+	}}
+	runner := Runner{
+		LLMClient: client,
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		OutputSchema:     schema,
+		MaxOutputRepairs: 1,
+	}
+
+	_, err = runner.RunPrompt(context.Background(), &history, "answer", "corr-schema-fail")
+	if !errors.Is(err, ErrInvalidOutput) {
+		t.Fatalf("expected ErrInvalidOutput, got %v", err)
+	}
+	if len(client.requests) != 2 {
+		t.Fatalf("expected one repair attempt, got %d request(s)", len(client.requests))
+	}
+}
+
+func TestRunPrompt_AttachesToolContentParts(t *testing.T) {
+	history := []llm.Message{}
+	image := llm.ImagePart("image/png", []byte("png"))
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{
+			responseWithToolCalls(sampleToolCall("call_1", "Read", `{"file_path":"shot.png"}`)),
+			responseWithText("stop", "a screenshot"),
+		}},
+		Model: "test-model",
+		ExecuteToolWithParts: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) (string, []llm.ContentPart) {
+			return `{"ok":true}`, []llm.ContentPart{image}
+		},
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "what is in shot.png?", "corr-parts"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	toolMessage := history[2]
+	if toolMessage.Role != llm.RoleTool || len(toolMessage.Parts) != 1 || toolMessage.Parts[0].MediaType != "image/png" {
+		t.Fatalf("expected tool message with image part, got %+v", toolMessage)
+	}
+}
+
+func TestRunPrompt_ReplaysRecordedCassette(t *testing.T) {
+	cassettePath := filepath.Join(t.TempDir(), "run.json")
+	executeTool := func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+		return `{"ok":true}`
+	}
+
+	recordHistory := []llm.Message{{Role: llm.RoleSystem, Content: "system"}}
+	recorder := Runner{
+		LLMClient: llm.NewRecordingClient(&queuedClient{responses: []llm.CompletionResponse{
+			responseWithToolCalls(sampleToolCall("call_1", "ListDir", "{}")),
+			responseWithText("stop", "recorded answer"),
+		}}, cassettePath),
+		Model:       "test-model",
+		ExecuteTool: executeTool,
+	}
+	if _, err := recorder.RunPrompt(context.Background(), &recordHistory, "list files", "corr-record"); err != nil {
+		t.Fatalf("recording RunPrompt returned error: %v", err)
+	}
+
+	replayClient, err := llm.NewReplayClient(cassettePath)
+	if err != nil {
+		t.Fatalf("NewReplayClient returned error: %v", err)
+	}
+	replayHistory := []llm.Message{{Role: llm.RoleSystem, Content: "system"}}
+	replayer := Runner{LLMClient: replayClient, Model: "test-model", ExecuteTool: executeTool}
+	text, err := replayer.RunPrompt(context.Background(), &replayHistory, "list files", "corr-replay")
+	if err != nil {
+		t.Fatalf("replaying RunPrompt returned error: %v", err)
+	}
+	if text != "recorded answer" || replayClient.Remaining() != 0 {
+		t.Fatalf("expected full replay, got %q with %d interaction(s) left", text, replayClient.Remaining())
+	}
+
+	divergedHistory := []llm.Message{{Role: llm.RoleSystem, Content: "system"}}
+	replayClient, _ = llm.NewReplayClient(cassettePath)
+	replayer.LLMClient = replayClient
+	if _, err := replayer.RunPrompt(context.Background(), &divergedHistory, "something else", "corr-diverged"); !errors.Is(err, llm.ErrCassetteMismatch) {
+		t.Fatalf("expected cassette mismatch, got %v", err)
+	}
+}
+
 type queuedClient struct {
 	responses []llm.CompletionResponse
 	index     int
+	requests  []llm.CompletionRequest
 }
 
 func (client *queuedClient) Complete(ctx context.Context, request llm.CompletionRequest) (llm.CompletionResponse, error) {
+	client.requests = append(client.requests, request)
 	if client.index >= len(client.responses) {
 		return llm.CompletionResponse{}, errors.New("no queued response")
 	}
@@ -168,6 +510,20 @@ func (client *queuedClient) Complete(ctx context.Context, request llm.Completion
 	return response, nil
 }
 
+type streamingQueuedClient struct {
+	queuedClient
+	deltas      []llm.StreamDelta
+	streamCalls int
+}
+
+func (client *streamingQueuedClient) CompleteStream(ctx context.Context, request llm.CompletionRequest, onDelta llm.StreamHandler) (llm.CompletionResponse, error) {
+	client.streamCalls++
+	for _, delta := range client.deltas {
+		onDelta(delta)
+	}
+	return client.Complete(ctx, request)
+}
+
 func responseWithText(finishReason, content string) llm.CompletionResponse {
 	return llm.CompletionResponse{
 		Choices: []llm.Choice{{
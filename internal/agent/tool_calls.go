@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+// executeToolCalls runs one turn's tool calls and returns their results in
+// call order. Up to MaxConcurrentTools calls run at once. A call to a tool
+// that is not concurrency safe waits for the calls before it and runs alone,
+// so it never overlaps another call. Each call is put to Approver, one at a
+// time, right before it would start; edited arguments are written back to
+// toolCalls so the history shows what ran. Once ctx is done, or approval
+// fails, no further calls start and the results of the calls handled so far
+// are returned with the error. onResult, when set, is called with the
+// results finished so far, in call order, each time another one finishes;
+// calls to it never overlap.
+func (runner Runner) executeToolCalls(ctx context.Context, correlationID string, turnNumber int, toolCalls []llm.ToolCall, onResult func(finished []llm.Message)) ([]llm.Message, error) {
+	results := make([]llm.Message, len(toolCalls))
+	slots := make(chan struct{}, max(runner.MaxConcurrentTools, 1))
+	var running sync.WaitGroup
+
+	var finishedMu sync.Mutex
+	finished := make([]bool, len(toolCalls))
+	finish := func(index int, result llm.Message) {
+		finishedMu.Lock()
+		defer finishedMu.Unlock()
+		results[index] = result
+		finished[index] = true
+		if onResult == nil {
+			return
+		}
+		sofar := make([]llm.Message, 0, len(results))
+		for position, done := range finished {
+			if done {
+				sofar = append(sofar, results[position])
+			}
+		}
+		onResult(sofar)
+	}
+
+	handled := 0
+	var stopErr error
+	for index := range toolCalls {
+		exclusive := !runner.concurrencySafe(toolCalls[index].Name)
+		if exclusive {
+			running.Wait()
+		}
+		if stopErr = ctx.Err(); stopErr != nil {
+			break
+		}
+		toolCall, denied, err := runner.approve(ctx, correlationID, turnNumber, toolCalls[index])
+		if err != nil {
+			stopErr = err
+			break
+		}
+		toolCalls[index] = toolCall
+		if denied != nil {
+			finish(index, *denied)
+			handled++
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if stopErr = ctx.Err(); stopErr != nil {
+			break
+		}
+
+		handled++
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			defer func() { <-slots }()
+			finish(index, runner.executeToolCall(ctx, correlationID, turnNumber, toolCall))
+		}()
+		if exclusive {
+			running.Wait()
+		}
+	}
+	running.Wait()
+
+	return results[:handled], stopErr
+}
+
+// approve denies calls that plan mode does not allow and puts the rest to
+// Approver. It returns the call to run, with any
+// edited arguments, or the result to send back when the call was denied.
+func (runner Runner) approve(ctx context.Context, correlationID string, turnNumber int, toolCall llm.ToolCall) (llm.ToolCall, *llm.Message, error) {
+	var decision ApprovalDecision
+	if reason := runner.planDenial(toolCall.Name); reason != "" {
+		decision = ApprovalDecision{Reason: reason}
+	} else if runner.Approver == nil {
+		return toolCall, nil, nil
+	} else {
+		var err error
+		decision, err = runner.Approver.Approve(ctx, toolCall)
+		if err != nil {
+			return toolCall, nil, fmt.Errorf("approve tool call %s: %w", toolCall.Name, err)
+		}
+	}
+	edited := decision.Approved && decision.Arguments != "" && decision.Arguments != toolCall.Arguments
+	if edited {
+		toolCall.Arguments = decision.Arguments
+	}
+	runner.emit(ToolApprovalEvent{
+		CorrelationID: correlationID,
+		Turn:          turnNumber,
+		ToolCall:      toolCall,
+		Approved:      decision.Approved,
+		Edited:        edited,
+		Reason:        decision.Reason,
+	})
+	if decision.Approved {
+		return toolCall, nil, nil
+	}
+
+	message := "tool call denied"
+	if reason := strings.TrimSpace(decision.Reason); reason != "" {
+		message += ": " + reason
+	}
+	return toolCall, &llm.Message{
+		Role:       llm.RoleTool,
+		Content:    tools.ErrorEnvelope(message, map[string]any{"tool": toolCall.Name}),
+		ToolCallID: toolCall.ID,
+	}, nil
+}
+
+func (runner Runner) planDenial(toolName string) string {
+	if !runner.Plan.Active() {
+		return ""
+	}
+	return runner.Plan.deny(toolName)
+}
+
+func (runner Runner) executeToolCall(ctx context.Context, correlationID string, turnNumber int, toolCall llm.ToolCall) llm.Message {
+	runner.emit(ToolStartEvent{CorrelationID: correlationID, Turn: turnNumber, ToolCall: toolCall})
+	runner.infof("executing tool call id=%s name=%s", toolCall.ID, toolCall.Name)
+	started := time.Now()
+	toolResponse, toolParts := runner.executeTool(ctx, correlationID, toolCall)
+	runner.emit(ToolEndEvent{
+		CorrelationID: correlationID,
+		Turn:          turnNumber,
+		ToolCall:      toolCall,
+		Result:        toolResponse,
+		Parts:         toolParts,
+		Duration:      time.Since(started),
+	})
+	runner.debugf("tool call id=%s completed with %d byte(s) response", toolCall.ID, len(toolResponse))
+	return llm.Message{
+		Role:       llm.RoleTool,
+		Content:    toolResponse,
+		Parts:      toolParts,
+		ToolCallID: toolCall.ID,
+	}
+}
+
+func (runner Runner) concurrencySafe(toolName string) bool {
+	if runner.ConcurrencySafe == nil {
+		return true
+	}
+	return runner.ConcurrencySafe(toolName)
+}
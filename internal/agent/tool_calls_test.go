@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// concurrencyProbe records how many tool calls run at once and whether a
+// Write ever ran alongside another call.
+type concurrencyProbe struct {
+	mu           sync.Mutex
+	running      []string
+	peak         int
+	writeOverlap bool
+}
+
+func (probe *concurrencyProbe) execute(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+	probe.mu.Lock()
+	if len(probe.running) > 0 && (toolCall.Name == "Write" || slices.Contains(probe.running, "Write")) {
+		probe.writeOverlap = true
+	}
+	probe.running = append(probe.running, toolCall.Name)
+	probe.peak = max(probe.peak, len(probe.running))
+	probe.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	probe.mu.Lock()
+	index := slices.Index(probe.running, toolCall.Name)
+	probe.running = slices.Delete(probe.running, index, index+1)
+	probe.mu.Unlock()
+	return "result " + toolCall.ID
+}
+
+func TestRunPrompt_RunsToolCallsConcurrentlyInCallOrder(t *testing.T) {
+	history := []llm.Message{}
+	probe := &concurrencyProbe{}
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{
+			responseWithToolCalls(
+				sampleToolCall("call_1", "Read", "{}"),
+				sampleToolCall("call_2", "Read", "{}"),
+				sampleToolCall("call_3", "Read", "{}"),
+				sampleToolCall("call_4", "Read", "{}"),
+			),
+			responseWithText("stop", "done"),
+		}},
+		Model:              "test-model",
+		ExecuteTool:        probe.execute,
+		MaxConcurrentTools: 2,
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "read all", "corr-parallel"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if probe.peak != 2 {
+		t.Fatalf("expected two calls at once, got %d", probe.peak)
+	}
+	for index, id := range []string{"call_1", "call_2", "call_3", "call_4"} {
+		if result := history[2+index]; result.ToolCallID != id || result.Content != "result "+id {
+			t.Fatalf("expected result of %s at position %d, got %+v", id, index, result)
+		}
+	}
+}
+
+func TestRunPrompt_SerializesConcurrencyUnsafeTools(t *testing.T) {
+	history := []llm.Message{}
+	probe := &concurrencyProbe{}
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{
+			responseWithToolCalls(
+				sampleToolCall("call_1", "Read", "{}"),
+				sampleToolCall("call_2", "Read", "{}"),
+				sampleToolCall("call_3", "Write", "{}"),
+				sampleToolCall("call_4", "Read", "{}"),
+				sampleToolCall("call_5", "Read", "{}"),
+			),
+			responseWithText("stop", "done"),
+		}},
+		Model:              "test-model",
+		ExecuteTool:        probe.execute,
+		MaxConcurrentTools: 4,
+		ConcurrencySafe:    func(toolName string) bool { return toolName != "Write" },
+	}
+
+	if _, err := runner.RunPrompt(context.Background(), &history, "edit", "corr-serial"); err != nil {
+		t.Fatalf("RunPrompt returned error: %v", err)
+	}
+	if probe.writeOverlap {
+		t.Fatal("expected Write to run alone")
+	}
+	if probe.peak != 2 {
+		t.Fatalf("expected the reads on each side of Write to run together, got peak %d", probe.peak)
+	}
+	if history[4].ToolCallID != "call_3" {
+		t.Fatalf("expected results in call order, got %+v", history[4])
+	}
+}
+
+func TestRunPrompt_StopsStartingToolCallsOnceCancelled(t *testing.T) {
+	history := []llm.Message{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	executed := 0
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{
+			responseWithToolCalls(sampleToolCall("call_1", "Read", "{}"), sampleToolCall("call_2", "Read", "{}")),
+		}},
+		Model: "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			executed++
+			cancel()
+			return "{}"
+		},
+		MaxConcurrentTools: 1,
+	}
+
+	_, err := runner.RunPrompt(ctx, &history, "read", "corr-cancel-tools")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if executed != 1 || len(history) != 3 || history[2].ToolCallID != "call_1" {
+		t.Fatalf("expected only the first call to run, got %d executions and %d messages", executed, len(history))
+	}
+}
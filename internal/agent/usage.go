@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// UsageTracker accumulates token usage for the current prompt and for the
+// whole session, and remembers which provider and model served the latest
+// turn. It is shared by pointer so copies of a Runner report into the same
+// totals. A nil tracker ignores updates.
+type UsageTracker struct {
+	mu       sync.Mutex
+	prompt   llm.Usage
+	session  llm.Usage
+	provider string
+	model    string
+	// parent also receives everything added, see Child.
+	parent *UsageTracker
+}
+
+func NewUsageTracker(sessionUsage llm.Usage) *UsageTracker {
+	return &UsageTracker{session: sessionUsage}
+}
+
+// Child returns a tracker for a sub-agent. It keeps its own prompt and
+// session totals, so the sub-agent's budgets apply to its own spending, and
+// adds its usage to tracker as well.
+func (tracker *UsageTracker) Child() *UsageTracker {
+	return &UsageTracker{parent: tracker}
+}
+
+func (tracker *UsageTracker) beginPrompt() {
+	if tracker == nil {
+		return
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.prompt = llm.Usage{}
+}
+
+func (tracker *UsageTracker) add(usage llm.Usage) {
+	if tracker == nil {
+		return
+	}
+	tracker.mu.Lock()
+	tracker.prompt = tracker.prompt.Add(usage)
+	tracker.session = tracker.session.Add(usage)
+	tracker.mu.Unlock()
+	tracker.parent.add(usage)
+}
+
+func (tracker *UsageTracker) recordRoute(provider, model string) {
+	if tracker == nil {
+		return
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.provider = provider
+	tracker.model = model
+}
+
+// LastRoute returns the provider and model that served the most recent turn.
+func (tracker *UsageTracker) LastRoute() (string, string) {
+	if tracker == nil {
+		return "", ""
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return tracker.provider, tracker.model
+}
+
+// Prompt returns the usage of the most recent prompt.
+func (tracker *UsageTracker) Prompt() llm.Usage {
+	if tracker == nil {
+		return llm.Usage{}
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return tracker.prompt
+}
+
+// Session returns the usage accumulated over the session, including usage
+// the tracker was created with.
+func (tracker *UsageTracker) Session() llm.Usage {
+	if tracker == nil {
+		return llm.Usage{}
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return tracker.session
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+// budgetExhausted ends a run whose turn or tool call budget ran out with a
+// BudgetError. With WrapUp it first asks the model for a summary and returns
+// that instead of the last partial text; if the wrap-up itself fails, the
+// run ends as if WrapUp were off.
+func (runner Runner) budgetExhausted(ctx context.Context, correlationID string, turnNumber int, messageHistory *[]llm.Message, lastAssistantText string, err error) (string, error) {
+	budgetErr := &BudgetError{Err: err}
+	if !runner.WrapUp {
+		return lastAssistantText, budgetErr
+	}
+	summary, wrapErr := runner.wrapUp(ctx, correlationID, turnNumber, messageHistory, err)
+	if wrapErr != nil {
+		runner.warnf("wrap-up after %v failed: %v", err, wrapErr)
+		return lastAssistantText, budgetErr
+	}
+	budgetErr.Summary = summary
+	return summary, budgetErr
+}
+
+// wrapUp asks the model to summarize where it stands. The request keeps the
+// tool definitions, which some providers require alongside tool calls in the
+// history, but allows no tool calls, and any the model makes anyway are left
+// out of the history so every call in it stays answered.
+func (runner Runner) wrapUp(ctx context.Context, correlationID string, turnNumber int, messageHistory *[]llm.Message, budgetErr error) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	*messageHistory = append(*messageHistory, llm.Message{
+		Role:    llm.RoleUser,
+		Content: wrapUpPrompt(budgetErr),
+	})
+
+	runner.emit(TurnStartEvent{CorrelationID: correlationID, Turn: turnNumber, Messages: len(*messageHistory)})
+	requestMessages := *messageHistory
+	if runner.Context != nil {
+		prepared, err := runner.Context.Prepare(ctx, requestMessages)
+		if err != nil {
+			return "", fmt.Errorf("prepare context: %w", err)
+		}
+		requestMessages = prepared
+	}
+	toolDefinitions := runner.ToolDefinitions
+	if runner.Plan.Active() {
+		toolDefinitions = runner.Plan.toolDefinitions(toolDefinitions)
+	}
+	options := runner.Options
+	options.ToolChoice = &llm.ToolChoice{Mode: llm.ToolChoiceNone}
+	options.ResponseFormat = nil
+	resp, err := runner.complete(ctx, correlationID, turnNumber, llm.CompletionRequest{
+		Model:          runner.Model,
+		Messages:       requestMessages,
+		Tools:          toolDefinitions,
+		RequestOptions: options,
+	})
+	if err != nil {
+		return "", err
+	}
+	usage, provider, model := runner.recordUsage(resp)
+	if len(resp.Choices) == 0 {
+		return "", errors.New("no choices in response")
+	}
+
+	choice := resp.Choices[0]
+	*messageHistory = append(*messageHistory, llm.Message{
+		Role:            llm.RoleAssistant,
+		Content:         choice.Message.Content,
+		Reasoning:       choice.Message.Reasoning,
+		ReasoningBlocks: choice.Message.ReasoningBlocks,
+	})
+	runner.checkpoint(*messageHistory)
+	runner.emit(TurnEndEvent{
+		CorrelationID: correlationID,
+		Turn:          turnNumber,
+		Provider:      provider,
+		Model:         model,
+		FinishReason:  choice.FinishReason,
+		Usage:         usage,
+	})
+	summary := strings.TrimSpace(choice.Message.Content)
+	if summary == "" {
+		return "", errors.New("the model returned an empty summary")
+	}
+	return summary, nil
+}
+
+func wrapUpPrompt(budgetErr error) string {
+	return fmt.Sprintf("You have run out of budget for this task (%v) and cannot call any more tools. "+
+		"Reply with a short summary of what you have done so far, what remains to be done, and the next steps to finish it.", budgetErr)
+}
+
+// skippedToolResults answers tool calls that were not run, so the history
+// stays valid and the session can be continued.
+func skippedToolResults(toolCalls []llm.ToolCall, reason error) []llm.Message {
+	results := make([]llm.Message, 0, len(toolCalls))
+	for _, toolCall := range toolCalls {
+		results = append(results, llm.Message{
+			Role:       llm.RoleTool,
+			Content:    tools.ErrorEnvelope(fmt.Sprintf("tool call not run: %v", reason), map[string]any{"tool": toolCall.Name}),
+			ToolCallID: toolCall.ID,
+		})
+	}
+	return results
+}
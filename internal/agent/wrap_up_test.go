@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+func TestRunPrompt_WrapsUpWhenToolBudgetRunsOut(t *testing.T) {
+	history := []llm.Message{{Role: llm.RoleSystem, Content: "system"}}
+	wrapUp := responseWithText("stop", "Renamed the field in config.go; handlers.go still uses the old name. Next: update handlers.go and run the tests.")
+	wrapUp.Choices[0].Message.ToolCalls = []llm.ToolCall{sampleToolCall("call_9", "Read", "{}")}
+	llmClient := &queuedClient{responses: []llm.CompletionResponse{
+		responseWithToolCalls(sampleToolCall("call_1", "Read", `{"file_path":"config.go"}`)),
+		responseWithToolCalls(
+			sampleToolCall("call_2", "Read", `{"file_path":"handlers.go"}`),
+			sampleToolCall("call_3", "Read", `{"file_path":"main.go"}`),
+		),
+		wrapUp,
+	}}
+	executed := 0
+	runner := Runner{
+		LLMClient:       llmClient,
+		Model:           "test-model",
+		ToolDefinitions: []llm.ToolDefinition{{Name: "Read"}},
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			executed++
+			return "{}"
+		},
+		Policy: Policy{MaxToolCalls: 2},
+		WrapUp: true,
+	}
+
+	summary, err := runner.RunPrompt(context.Background(), &history, "rename the field", "corr-wrap")
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, ErrToolCallBudgetExceeded) {
+		t.Fatalf("expected a BudgetError for the tool call budget, got %v", err)
+	}
+	if !strings.HasPrefix(summary, "Renamed the field") || budgetErr.Summary != summary {
+		t.Fatalf("expected the wrap-up summary returned, got %q (error summary %q)", summary, budgetErr.Summary)
+	}
+	if executed != 1 {
+		t.Fatalf("expected only the calls within budget to run, got %d", executed)
+	}
+
+	request := llmClient.requests[2]
+	if request.ToolChoice == nil || request.ToolChoice.Mode != llm.ToolChoiceNone {
+		t.Fatalf("expected the wrap-up request to allow no tool calls, got %+v", request.ToolChoice)
+	}
+	if last := request.Messages[len(request.Messages)-1]; last.Role != llm.RoleUser || !strings.Contains(last.Content, "run out of budget") {
+		t.Fatalf("expected the wrap-up prompt last, got %+v", last)
+	}
+
+	answered := map[string]bool{}
+	for _, message := range history {
+		if message.Role == llm.RoleTool {
+			answered[message.ToolCallID] = true
+		}
+	}
+	for _, message := range history {
+		for _, toolCall := range message.ToolCalls {
+			if !answered[toolCall.ID] {
+				t.Fatalf("expected every tool call in the history answered, %s is not", toolCall.ID)
+			}
+		}
+	}
+	if skipped := history[6]; skipped.ToolCallID != "call_3" || !strings.Contains(skipped.Content, "tool call not run") {
+		t.Fatalf("expected the skipped call answered with the budget error, got %+v", skipped)
+	}
+	if final := history[len(history)-1]; final.Role != llm.RoleAssistant || final.Content != summary || len(final.ToolCalls) != 0 {
+		t.Fatalf("expected the summary to end the history without tool calls, got %+v", final)
+	}
+}
+
+func TestRunPrompt_MaxTurnsWithoutWrapUpReturnsBudgetError(t *testing.T) {
+	history := []llm.Message{}
+	toolTurn := responseWithToolCalls(sampleToolCall("call_1", "ListDir", "{}"))
+	toolTurn.Choices[0].Message.Content = "looking around"
+	runner := Runner{
+		LLMClient: &queuedClient{responses: []llm.CompletionResponse{toolTurn}},
+		Model:     "test-model",
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return "{}"
+		},
+		Policy: Policy{MaxTurns: 1},
+	}
+
+	text, err := runner.RunPrompt(context.Background(), &history, "explore", "corr-turns")
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, ErrMaxTurnsExceeded) || budgetErr.Summary != "" {
+		t.Fatalf("expected a BudgetError without summary, got %v", err)
+	}
+	if text != "looking around" {
+		t.Fatalf("expected the last partial text, got %q", text)
+	}
+}
@@ -0,0 +1,164 @@
+package appcore
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/agent"
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// Observe logs agent events with their fields as typed values, so sinks get
+// them without parsing a message back. Streamed deltas are not logged.
+func (logger Logger) Observe(event agent.Event) {
+	level, fields, ok := eventFields(event)
+	if !ok || !logger.enabled || level > logger.level {
+		return
+	}
+	logger.write(LogEntry{
+		Timestamp:     time.Now(),
+		Level:         level,
+		Message:       formatEventMessage(event.EventName(), fields),
+		SchemaVersion: EventSchemaVersion,
+		Event:         event.EventName(),
+		Fields:        fields,
+	})
+}
+
+func eventFields(event agent.Event) (LogLevel, map[string]any, bool) {
+	switch typed := event.(type) {
+	case agent.PromptStartEvent:
+		return LogLevelInfo, map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"prompt_chars":   len(typed.Prompt),
+		}, true
+	case agent.PromptEndEvent:
+		return LogLevelInfo, withUsage(map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"response_chars": len(typed.Response),
+			"provider":       typed.Provider,
+			"model":          typed.Model,
+			"turns":          typed.Turns,
+		}, typed.Usage), true
+	case agent.TurnStartEvent:
+		return LogLevelInfo, map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"turn":           typed.Turn,
+			"messages":       typed.Messages,
+		}, true
+	case agent.TurnEndEvent:
+		return LogLevelInfo, withUsage(map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"turn":           typed.Turn,
+			"provider":       typed.Provider,
+			"model":          typed.Model,
+			"finish_reason":  typed.FinishReason,
+			"tool_calls":     typed.ToolCalls,
+		}, typed.Usage), true
+	case agent.ToolApprovalEvent:
+		return LogLevelInfo, map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"turn":           typed.Turn,
+			"tool_call_id":   typed.ToolCall.ID,
+			"tool":           typed.ToolCall.Name,
+			"approved":       typed.Approved,
+			"edited":         typed.Edited,
+			"reason":         typed.Reason,
+		}, true
+	case agent.ToolStartEvent:
+		return LogLevelInfo, map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"turn":           typed.Turn,
+			"tool_call_id":   typed.ToolCall.ID,
+			"tool":           typed.ToolCall.Name,
+		}, true
+	case agent.ToolEndEvent:
+		return LogLevelInfo, map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"turn":           typed.Turn,
+			"tool_call_id":   typed.ToolCall.ID,
+			"tool":           typed.ToolCall.Name,
+			"response_bytes": len(typed.Result),
+			"parts":          len(typed.Parts),
+			"duration_ms":    typed.Duration.Milliseconds(),
+		}, true
+	case agent.RepetitionEvent:
+		return LogLevelWarn, map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"turn":           typed.Turn,
+			"provider":       typed.Provider,
+			"model":          typed.Model,
+			"tool_call_id":   typed.ToolCall.ID,
+			"tool":           typed.ToolCall.Name,
+			"kind":           string(typed.Kind),
+			"repeats":        typed.Repeats,
+			"aborted":        typed.Aborted,
+		}, true
+	case agent.BudgetExceededEvent:
+		return LogLevelWarn, map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"turn":           typed.Turn,
+			"prompt_tokens":  typed.PromptUsage.TotalTokens,
+			"prompt_cost":    typed.PromptUsage.Cost,
+			"err":            typed.Err.Error(),
+		}, true
+	case agent.OutputInvalidEvent:
+		return LogLevelWarn, map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"turn":           typed.Turn,
+			"repair":         typed.Repair,
+			"max_repairs":    typed.MaxRepairs,
+			"err":            typed.Err.Error(),
+		}, true
+	case agent.ContextCompactedEvent:
+		return LogLevelInfo, map[string]any{
+			"strategy":        string(typed.Strategy),
+			"context_window":  typed.ContextWindow,
+			"tokens_before":   typed.TokensBefore,
+			"tokens_after":    typed.TokensAfter,
+			"messages_before": typed.MessagesBefore,
+			"messages_after":  typed.MessagesAfter,
+		}, true
+	case agent.ErrorEvent:
+		return LogLevelError, map[string]any{
+			"correlation_id": typed.CorrelationID,
+			"err":            typed.Err.Error(),
+		}, true
+	default:
+		return LogLevelInfo, nil, false
+	}
+}
+
+func withUsage(fields map[string]any, usage llm.Usage) map[string]any {
+	fields["prompt_tokens"] = usage.PromptTokens
+	fields["completion_tokens"] = usage.CompletionTokens
+	fields["cached_tokens"] = usage.CachedTokens
+	fields["cache_write_tokens"] = usage.CacheWriteTokens
+	fields["total_tokens"] = usage.TotalTokens
+	fields["cost_usd"] = usage.Cost
+	return fields
+}
+
+// formatEventMessage renders an event as "event=name key=value ..." for text
+// sinks, quoting values that contain spaces.
+func formatEventMessage(name string, fields map[string]any) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys)+1)
+	parts = append(parts, "event="+name)
+	for _, key := range keys {
+		value := fmt.Sprint(fields[key])
+		if strings.ContainsAny(value, " \t\n\"") || value == "" {
+			value = strconv.Quote(value)
+		}
+		parts = append(parts, key+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
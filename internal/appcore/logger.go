@@ -157,7 +157,10 @@ func (logger Logger) logf(level LogLevel, format string, args ...interface{}) {
 		entry.Event = eventName
 		entry.Fields = fields
 	}
+	logger.write(entry)
+}
 
+func (logger Logger) write(entry LogEntry) {
 	sink := logger.sink
 	if sink == nil {
 		sink = textSink{writer: os.Stderr}
@@ -2,9 +2,15 @@ package appcore
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/agent"
+	"github.com/adriankopytko/ShimiBot/internal/llm"
 )
 
 type captureSink struct {
@@ -105,3 +111,33 @@ func TestJSONFileSink_WritesSchemaVersionedEventRecord(t *testing.T) {
 		t.Fatalf("expected correlation_id c-1, got %#v", record.Fields["correlation_id"])
 	}
 }
+
+func TestLogger_ObserveLogsTypedEventFields(t *testing.T) {
+	sink := &captureSink{}
+	logger := Logger{enabled: true, level: LogLevelInfo, sink: sink}
+
+	logger.Observe(agent.ToolEndEvent{
+		CorrelationID: "corr-1",
+		Turn:          2,
+		ToolCall:      llm.ToolCall{ID: "call_1", Name: "Read"},
+		Result:        "hello",
+		Duration:      1500 * time.Millisecond,
+	})
+	logger.Observe(agent.ErrorEvent{CorrelationID: "corr-1", Err: errors.New("turn timed out after 5m")})
+	logger.Observe(agent.AssistantDeltaEvent{Delta: llm.StreamDelta{Content: "partial"}})
+
+	if len(sink.entries) != 2 {
+		t.Fatalf("expected 2 entries without the delta, got %d", len(sink.entries))
+	}
+	toolEnd := sink.entries[0]
+	if toolEnd.Event != "tool_end" || toolEnd.Fields["response_bytes"] != 5 || toolEnd.Fields["duration_ms"] != int64(1500) {
+		t.Fatalf("unexpected tool_end entry %+v", toolEnd)
+	}
+	failed := sink.entries[1]
+	if failed.Level != LogLevelError || failed.Fields["err"] != "turn timed out after 5m" {
+		t.Fatalf("expected error text kept intact, got %+v", failed)
+	}
+	if !strings.Contains(failed.Message, `err="turn timed out after 5m"`) {
+		t.Fatalf("expected quoted value in text message, got %q", failed.Message)
+	}
+}
@@ -1,19 +1,36 @@
 package appcore
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"strings"
 	"time"
 
+	"github.com/adriankopytko/ShimiBot/internal/catalog"
 	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/texttools"
 	"github.com/adriankopytko/ShimiBot/internal/tools"
 	"github.com/joho/godotenv"
 )
 
+const (
+	ProviderOpenRouter = "openrouter"
+	ProviderAnthropic  = "anthropic"
+	ProviderOllama     = "ollama"
+)
+
+var defaultModels = map[string]string{
+	ProviderOpenRouter: "anthropic/claude-haiku-4.5",
+	ProviderAnthropic:  "claude-haiku-4-5",
+	ProviderOllama:     "llama3.1",
+}
+
 type LLMConfig struct {
 	Provider string
 	APIKey   string
@@ -46,24 +63,162 @@ func LoadEnvFilesIfPresent(paths []string, logger Logger) {
 	}
 }
 
-func ResolveLLMConfig(logger Logger) (LLMConfig, error) {
-	provider := "openrouter"
-	logger.Debugf("resolved provider=%s", provider)
+// RoutingConfig describes the routes tried besides the primary one. Each
+// route is written as "provider:model"; a spec without a known provider
+// prefix names a model on the primary provider, and an empty model selects
+// the provider's default.
+type RoutingConfig struct {
+	// Fallbacks are tried in order when the primary route fails.
+	Fallbacks []string
+	// ToolResults, when set, serves turns whose newest messages are tool
+	// results, falling back to the primary chain.
+	ToolResults string
+	// TextToolModels lists models, or path.Match patterns, without native
+	// tool calling; their routes use the texttools protocol instead.
+	TextToolModels []string
+}
+
+func ResolveLLMConfig(provider string, logger Logger) (LLMConfig, error) {
+	return resolveProviderConfig(provider, os.Getenv("AI_MODEL"), logger)
+}
+
+// ResolveRouteConfig resolves a "provider:model" route spec relative to the
+// primary configuration.
+func ResolveRouteConfig(spec string, primary LLMConfig, logger Logger) (LLMConfig, error) {
+	provider, model := primary.Provider, strings.TrimSpace(spec)
+	if prefix, rest, found := strings.Cut(model, ":"); found {
+		switch strings.ToLower(strings.TrimSpace(prefix)) {
+		case ProviderOpenRouter, ProviderAnthropic, ProviderOllama:
+			provider, model = prefix, strings.TrimSpace(rest)
+		}
+	} else {
+		switch strings.ToLower(model) {
+		case ProviderOpenRouter, ProviderAnthropic, ProviderOllama:
+			provider, model = model, ""
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(provider), primary.Provider) && model == "" {
+		model = primary.Model
+	}
+	if model == "" {
+		model = defaultModels[strings.ToLower(strings.TrimSpace(provider))]
+	}
+	return resolveProviderConfig(provider, model, logger)
+}
+
+// NewRoutedLLMClient builds the client used by the agent: every route retries
+// on its own, the primary route falls back to routing.Fallbacks, and turns
+// carrying only tool results go to routing.ToolResults when it is set.
+func NewRoutedLLMClient(primary LLMConfig, routing RoutingConfig, retry llm.RetryPolicy, logger Logger) (llm.Client, error) {
+	newRoute := func(config LLMConfig) (llm.Route, error) {
+		client, err := NewLLMClient(config)
+		if err != nil {
+			return llm.Route{}, err
+		}
+		if MatchesModel(routing.TextToolModels, config.Model) {
+			client = texttools.NewClient(client)
+			logger.Infof("using text tool protocol provider=%s model=%s", config.Provider, config.Model)
+		}
+		return llm.Route{
+			Provider: config.Provider,
+			Model:    config.Model,
+			Client:   llm.NewRetryingClient(client, retry, logger),
+		}, nil
+	}
+
+	primaryRoute, err := newRoute(primary)
+	if err != nil {
+		return nil, err
+	}
+	chain := []llm.Route{primaryRoute}
+	for _, spec := range routing.Fallbacks {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		config, err := ResolveRouteConfig(spec, primary, logger)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback route %q: %w", spec, err)
+		}
+		route, err := newRoute(config)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, route)
+	}
+	primaryClient := llm.NewFallbackClient(chain, logger)
+
+	if strings.TrimSpace(routing.ToolResults) == "" {
+		return primaryClient, nil
+	}
+	config, err := ResolveRouteConfig(routing.ToolResults, primary, logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tool result route %q: %w", routing.ToolResults, err)
+	}
+	toolResultRoute, err := newRoute(config)
+	if err != nil {
+		return nil, err
+	}
+	toolResultClient := llm.NewFallbackClient(append([]llm.Route{toolResultRoute}, chain...), logger)
+	return llm.NewRouter(primaryClient, map[llm.TurnKind]llm.Client{llm.TurnKindToolResults: toolResultClient}), nil
+}
 
-	apiKey := strings.TrimSpace(os.Getenv("OPENROUTER_API_KEY"))
-	baseURL := strings.TrimSpace(os.Getenv("OPENROUTER_BASE_URL"))
-	model := strings.TrimSpace(os.Getenv("AI_MODEL"))
+// MatchesModel reports whether model equals one of patterns or matches it as
+// a path.Match pattern, e.g. "ollama/*" or "llama2*".
+func MatchesModel(patterns []string, model string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == model {
+			return true
+		}
+		if matched, err := path.Match(pattern, model); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
 
-	if baseURL == "" {
-		baseURL = "https://openrouter.ai/api/v1"
+func resolveProviderConfig(provider, model string, logger Logger) (LLMConfig, error) {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if provider == "" {
+		provider = ProviderOpenRouter
 	}
+	logger.Debugf("resolved provider=%s", provider)
+
+	model = strings.TrimSpace(model)
 	if model == "" {
-		model = "anthropic/claude-haiku-4.5"
+		model = defaultModels[provider]
 	}
 
-	if apiKey == "" {
-		logger.Errorf("openrouter api key not found")
-		return LLMConfig{}, errors.New("missing API key: set OPENROUTER_API_KEY")
+	var apiKey, baseURL string
+	switch provider {
+	case ProviderOpenRouter:
+		apiKey = strings.TrimSpace(os.Getenv("OPENROUTER_API_KEY"))
+		baseURL = strings.TrimSpace(os.Getenv("OPENROUTER_BASE_URL"))
+		if baseURL == "" {
+			baseURL = "https://openrouter.ai/api/v1"
+		}
+		if apiKey == "" {
+			logger.Errorf("openrouter api key not found")
+			return LLMConfig{}, errors.New("missing API key: set OPENROUTER_API_KEY")
+		}
+	case ProviderAnthropic:
+		apiKey = strings.TrimSpace(os.Getenv("ANTHROPIC_API_KEY"))
+		baseURL = strings.TrimSpace(os.Getenv("ANTHROPIC_BASE_URL"))
+		if baseURL == "" {
+			baseURL = llm.DefaultAnthropicBaseURL
+		}
+		if apiKey == "" {
+			logger.Errorf("anthropic api key not found")
+			return LLMConfig{}, errors.New("missing API key: set ANTHROPIC_API_KEY")
+		}
+	case ProviderOllama:
+		apiKey = strings.TrimSpace(os.Getenv("OLLAMA_API_KEY"))
+		baseURL = strings.TrimSpace(os.Getenv("OLLAMA_BASE_URL"))
+		if baseURL == "" {
+			baseURL = llm.DefaultOllamaBaseURL
+		}
+	default:
+		return LLMConfig{}, fmt.Errorf("unsupported provider %q (use: %s, %s, %s)", provider, ProviderOpenRouter, ProviderAnthropic, ProviderOllama)
 	}
 
 	logger.Debugf("llm config resolved (provider=%s model=%s base_url=%s)", provider, model, baseURL)
@@ -76,20 +231,72 @@ func ResolveLLMConfig(logger Logger) (LLMConfig, error) {
 	}, nil
 }
 
+func NewLLMClient(config LLMConfig) (llm.Client, error) {
+	switch config.Provider {
+	case ProviderOpenRouter:
+		return llm.NewOpenAIClient(config.APIKey, config.BaseURL), nil
+	case ProviderAnthropic:
+		return llm.NewAnthropicClient(config.APIKey, config.BaseURL), nil
+	case ProviderOllama:
+		return llm.NewOllamaClient(config.APIKey, config.BaseURL), nil
+	default:
+		return nil, fmt.Errorf("unsupported provider %q", config.Provider)
+	}
+}
+
+// LoadModelCatalog returns the model catalog of config's provider, from the
+// on-disk cache while it is fresh.
+func LoadModelCatalog(ctx context.Context, config LLMConfig, refresh bool) (*catalog.Catalog, error) {
+	client, err := NewLLMClient(config)
+	if err != nil {
+		return nil, err
+	}
+	lister, _ := client.(llm.ModelLister)
+	return catalog.Loader{Lister: lister, Provider: config.Provider, BaseURL: config.BaseURL}.Load(ctx, refresh)
+}
+
+// LoadPriceTable reads a JSON object mapping model names to prices in USD per
+// million tokens, e.g. {"anthropic/claude-haiku-4.5": {"prompt": 1, "completion": 5}}.
+// An empty path yields an empty table.
+func LoadPriceTable(path string) (llm.PriceTable, error) {
+	trimmedPath := strings.TrimSpace(path)
+	if trimmedPath == "" {
+		return llm.PriceTable{}, nil
+	}
+
+	payload, err := os.ReadFile(trimmedPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading price table %q: %w", trimmedPath, err)
+	}
+
+	var table llm.PriceTable
+	if err := json.Unmarshal(payload, &table); err != nil {
+		return nil, fmt.Errorf("failed parsing price table %q: %w", trimmedPath, err)
+	}
+	return table, nil
+}
+
 func DispatchToolCall(logger Logger, toolRegistry *tools.Registry, toolContext tools.ToolContext, toolCall llm.ToolCall) string {
+	output, _ := DispatchToolCallWithParts(logger, toolRegistry, toolContext, toolCall)
+	return output
+}
+
+// DispatchToolCallWithParts also returns content parts, such as images, that
+// the tool attached to its result.
+func DispatchToolCallWithParts(logger Logger, toolRegistry *tools.Registry, toolContext tools.ToolContext, toolCall llm.ToolCall) (string, []llm.ContentPart) {
 	toolName := toolCall.Name
 	logger.Debugf("event=tool_dispatch correlation_id=%s tool=%s", toolContext.CorrelationID, toolName)
 
 	if toolRegistry != nil {
-		output, matched := toolRegistry.Execute(toolCall, toolContext)
+		output, parts, matched := toolRegistry.ExecuteWithParts(toolCall, toolContext)
 		if matched {
-			logger.Debugf("event=tool_dispatch_complete correlation_id=%s tool=%s", toolContext.CorrelationID, toolName)
-			return output
+			logger.Debugf("event=tool_dispatch_complete correlation_id=%s tool=%s parts=%d", toolContext.CorrelationID, toolName, len(parts))
+			return output, parts
 		}
 	}
 
 	logger.Warnf("event=tool_unknown correlation_id=%s tool=%s", toolContext.CorrelationID, toolName)
-	return tools.ErrorEnvelope(fmt.Sprintf("unknown tool '%s'", toolName), map[string]any{"tool": toolName})
+	return tools.ErrorEnvelope(fmt.Sprintf("unknown tool '%s'", toolName), map[string]any{"tool": toolName}), nil
 }
 
 func NewCorrelationID() string {
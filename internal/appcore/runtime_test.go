@@ -0,0 +1,174 @@
+package appcore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+func TestResolveLLMConfig_DefaultsToOpenRouter(t *testing.T) {
+	t.Setenv("AI_MODEL", "")
+	t.Setenv("OPENROUTER_API_KEY", "or-key")
+	t.Setenv("OPENROUTER_BASE_URL", "")
+
+	config, err := ResolveLLMConfig("", Logger{})
+	if err != nil {
+		t.Fatalf("ResolveLLMConfig returned error: %v", err)
+	}
+	if config.Provider != ProviderOpenRouter || config.APIKey != "or-key" {
+		t.Fatalf("expected openrouter config, got %+v", config)
+	}
+	if config.Model != "anthropic/claude-haiku-4.5" {
+		t.Fatalf("expected default openrouter model, got %q", config.Model)
+	}
+}
+
+func TestResolveLLMConfig_SelectsAnthropic(t *testing.T) {
+	t.Setenv("AI_MODEL", "")
+	t.Setenv("ANTHROPIC_API_KEY", "ant-key")
+	t.Setenv("ANTHROPIC_BASE_URL", "")
+
+	config, err := ResolveLLMConfig("Anthropic", Logger{})
+	if err != nil {
+		t.Fatalf("ResolveLLMConfig returned error: %v", err)
+	}
+	if config.Provider != ProviderAnthropic || config.BaseURL != llm.DefaultAnthropicBaseURL {
+		t.Fatalf("expected anthropic config, got %+v", config)
+	}
+
+	client, err := NewLLMClient(config)
+	if err != nil {
+		t.Fatalf("NewLLMClient returned error: %v", err)
+	}
+	if _, ok := client.(*llm.AnthropicClient); !ok {
+		t.Fatalf("expected anthropic client, got %T", client)
+	}
+}
+
+func TestResolveLLMConfig_RejectsMissingKeyAndUnknownProvider(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	if _, err := ResolveLLMConfig("anthropic", Logger{}); err == nil {
+		t.Fatal("expected error for missing anthropic api key")
+	}
+
+	if _, err := ResolveLLMConfig("nope", Logger{}); err == nil {
+		t.Fatal("expected error for unsupported provider")
+	}
+}
+
+func TestResolveLLMConfig_OllamaNeedsNoAPIKey(t *testing.T) {
+	t.Setenv("AI_MODEL", "")
+	t.Setenv("OLLAMA_API_KEY", "")
+	t.Setenv("OLLAMA_BASE_URL", "")
+	t.Setenv("OPENROUTER_API_KEY", "")
+
+	config, err := ResolveLLMConfig("ollama", Logger{})
+	if err != nil {
+		t.Fatalf("ResolveLLMConfig returned error: %v", err)
+	}
+	if config.BaseURL != llm.DefaultOllamaBaseURL || config.APIKey != "" {
+		t.Fatalf("expected local ollama config without key, got %+v", config)
+	}
+
+	client, err := NewLLMClient(config)
+	if err != nil {
+		t.Fatalf("NewLLMClient returned error: %v", err)
+	}
+	if _, ok := client.(*llm.OllamaClient); !ok {
+		t.Fatalf("expected ollama client, got %T", client)
+	}
+}
+
+func TestResolveRouteConfig(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "ant-key")
+	t.Setenv("OLLAMA_BASE_URL", "")
+	primary := LLMConfig{Provider: ProviderOllama, Model: "qwen3"}
+
+	tests := []struct {
+		spec     string
+		provider string
+		model    string
+	}{
+		{"anthropic:claude-sonnet-4-5", ProviderAnthropic, "claude-sonnet-4-5"},
+		{"anthropic", ProviderAnthropic, "claude-haiku-4-5"},
+		{"ollama", ProviderOllama, "qwen3"},
+		{"llama3.1:8b", ProviderOllama, "llama3.1:8b"},
+	}
+	for _, test := range tests {
+		config, err := ResolveRouteConfig(test.spec, primary, Logger{})
+		if err != nil {
+			t.Fatalf("%s: ResolveRouteConfig returned error: %v", test.spec, err)
+		}
+		if config.Provider != test.provider || config.Model != test.model {
+			t.Fatalf("%s: expected %s/%s, got %s/%s", test.spec, test.provider, test.model, config.Provider, config.Model)
+		}
+	}
+}
+
+func TestNewRoutedLLMClient(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("OLLAMA_BASE_URL", "")
+	primary := LLMConfig{Provider: ProviderOllama, Model: "qwen3", BaseURL: llm.DefaultOllamaBaseURL}
+
+	client, err := NewRoutedLLMClient(primary, RoutingConfig{Fallbacks: []string{"ollama:llama3.1"}}, llm.RetryPolicy{}, Logger{})
+	if err != nil {
+		t.Fatalf("NewRoutedLLMClient returned error: %v", err)
+	}
+	if _, ok := client.(*llm.FallbackClient); !ok {
+		t.Fatalf("expected fallback client, got %T", client)
+	}
+
+	client, err = NewRoutedLLMClient(primary, RoutingConfig{ToolResults: "llama3.2:1b"}, llm.RetryPolicy{}, Logger{})
+	if err != nil {
+		t.Fatalf("NewRoutedLLMClient returned error: %v", err)
+	}
+	if _, ok := client.(*llm.Router); !ok {
+		t.Fatalf("expected router, got %T", client)
+	}
+
+	if _, err := NewRoutedLLMClient(primary, RoutingConfig{Fallbacks: []string{"anthropic"}}, llm.RetryPolicy{}, Logger{}); err == nil {
+		t.Fatal("expected error for fallback route without credentials")
+	}
+}
+
+func TestMatchesModel(t *testing.T) {
+	patterns := []string{"phi3", " llama2* ", "mistral/*"}
+	for _, model := range []string{"phi3", "llama2:13b", "mistral/7b"} {
+		if !MatchesModel(patterns, model) {
+			t.Fatalf("expected %q to match", model)
+		}
+	}
+	for _, model := range []string{"phi3.5", "llama3.1", "mistral/7b/q4"} {
+		if MatchesModel(patterns, model) {
+			t.Fatalf("expected %q not to match", model)
+		}
+	}
+}
+
+func TestLoadPriceTable(t *testing.T) {
+	table, err := LoadPriceTable("")
+	if err != nil || len(table) != 0 {
+		t.Fatalf("expected empty table for empty path, got %v err=%v", table, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"m":{"prompt":1.5,"completion":6,"cached_prompt":0.15}}`), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	table, err = LoadPriceTable(path)
+	if err != nil {
+		t.Fatalf("LoadPriceTable returned error: %v", err)
+	}
+	if table["m"] != (llm.ModelPrice{PromptPerMillion: 1.5, CompletionPerMillion: 6, CachedPromptPerMillion: 0.15}) {
+		t.Fatalf("unexpected price entry %+v", table["m"])
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	if _, err := LoadPriceTable(path); err == nil {
+		t.Fatal("expected error for invalid price table")
+	}
+}
@@ -0,0 +1,80 @@
+package appcore
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/agent"
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+const subAgentInstruction = " You are a sub-agent working on one task delegated by another agent. " +
+	"Nobody sees your intermediate messages: your final reply is the only thing returned, so make it a complete, self-contained answer."
+
+// SubAgent runs the Task tool's delegated tasks. Each task gets a child of
+// Parent with a fresh history, the tools in Registry (or the requested
+// subset of them) and Policy as its budgets. Child correlation IDs extend
+// the caller's, and the child stops when the caller's turn is cancelled.
+type SubAgent struct {
+	// Parent is copied for each task, keeping its client, model, request
+	// options, approver and observer. It is set once the parent runner
+	// exists, after the Task tool was registered.
+	Parent   agent.Runner
+	Registry *tools.Registry
+	Policy   agent.Policy
+	Logger   Logger
+	// NewContext, when set, gives each task its own context manager.
+	NewContext func() agent.ContextManager
+
+	tasks atomic.Int64
+}
+
+func (subAgent *SubAgent) RunTask(toolContext tools.ToolContext, task tools.TaskRequest) (string, error) {
+	registry := subAgent.Registry
+	if len(task.Tools) > 0 {
+		subset, err := registry.Subset(task.Tools...)
+		if err != nil {
+			return "", err
+		}
+		registry = subset
+	}
+
+	child := subAgent.Parent
+	child.ToolDefinitions = registry.Definitions()
+	child.ExecuteTool = nil
+	child.ExecuteToolWithParts = func(ctx context.Context, correlationID string, toolCall llm.ToolCall) (string, []llm.ContentPart) {
+		childToolContext := toolContext
+		childToolContext.Context = ctx
+		childToolContext.CorrelationID = correlationID
+		return DispatchToolCallWithParts(subAgent.Logger, registry, childToolContext, toolCall)
+	}
+	child.ConcurrencySafe = registry.ConcurrencySafe
+	child.Policy = subAgent.Policy
+	child.Usage = subAgent.Parent.Usage.Child()
+	child.Options.ToolChoice = nil
+	child.Options.ResponseFormat = nil
+	child.OutputSchema = nil
+	child.Stream = false
+	child.Checkpointer = nil
+	child.Context = nil
+	if subAgent.NewContext != nil {
+		child.Context = subAgent.NewContext()
+	}
+
+	correlationID := fmt.Sprintf("%s/task-%d", toolContext.CorrelationID, subAgent.tasks.Add(1))
+	subAgent.Logger.Infof("event=task_start correlation_id=%s parent_correlation_id=%s tools=%d", correlationID, toolContext.CorrelationID, len(child.ToolDefinitions))
+	history := []llm.Message{{Role: llm.RoleSystem, Content: BuildSystemPrompt(time.Now()) + subAgentInstruction}}
+	answer, err := child.RunPrompt(tools.BaseContext(toolContext), &history, task.Prompt, correlationID)
+	usage := child.Usage.Session()
+	subAgent.Logger.Infof("event=task_end correlation_id=%s messages=%d total_tokens=%d cost_usd=%f", correlationID, len(history), usage.TotalTokens, usage.Cost)
+	if err != nil {
+		if answer != "" {
+			return "", fmt.Errorf("sub-agent stopped: %w; its last message was: %s", err, answer)
+		}
+		return "", fmt.Errorf("sub-agent stopped: %w", err)
+	}
+	return answer, nil
+}
@@ -0,0 +1,145 @@
+package appcore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/agent"
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+type scriptedClient struct {
+	responses      []llm.CompletionResponse
+	requests       []llm.CompletionRequest
+	correlationIDs []string
+}
+
+func (client *scriptedClient) Complete(ctx context.Context, request llm.CompletionRequest) (llm.CompletionResponse, error) {
+	client.requests = append(client.requests, request)
+	client.correlationIDs = append(client.correlationIDs, llm.CorrelationID(ctx))
+	response := client.responses[0]
+	client.responses = client.responses[1:]
+	return response, nil
+}
+
+func scriptedResponse(content string, usage llm.Usage, toolCalls ...llm.ToolCall) llm.CompletionResponse {
+	finishReason := "stop"
+	if len(toolCalls) > 0 {
+		finishReason = "tool_calls"
+	}
+	return llm.CompletionResponse{
+		Choices: []llm.Choice{{FinishReason: finishReason, Message: llm.Message{Role: llm.RoleAssistant, Content: content, ToolCalls: toolCalls}}},
+		Usage:   usage,
+	}
+}
+
+func TestSubAgent_RunsChildWithFreshHistoryAndRestrictedTools(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0o600); err != nil {
+		t.Fatalf("failed writing fixture: %v", err)
+	}
+	client := &scriptedClient{responses: []llm.CompletionResponse{
+		scriptedResponse("", llm.Usage{TotalTokens: 100}, llm.ToolCall{ID: "call_1", Name: "ListDir", Arguments: `{"path":"."}`}),
+		scriptedResponse("the repo has main.go", llm.Usage{TotalTokens: 50}),
+	}}
+	registry, err := tools.DefaultRegistry().Subset("ListDir", "Read")
+	if err != nil {
+		t.Fatalf("Subset returned error: %v", err)
+	}
+	parentUsage := agent.NewUsageTracker(llm.Usage{TotalTokens: 10})
+	subAgent := &SubAgent{
+		Parent: agent.Runner{
+			LLMClient: client,
+			Model:     "test-model",
+			Usage:     parentUsage,
+			Options:   llm.RequestOptions{ToolChoice: &llm.ToolChoice{Mode: llm.ToolChoiceRequired}},
+			Checkpointer: agent.CheckpointFunc(func(history []llm.Message) error {
+				t.Fatal("expected the sub-agent not to checkpoint into the parent's session")
+				return nil
+			}),
+		},
+		Registry: registry,
+		Policy:   agent.Policy{MaxTurns: 5},
+	}
+
+	answer, err := subAgent.RunTask(tools.ToolContext{CWD: root, AllowedRoot: root, CorrelationID: "corr-parent"}, tools.TaskRequest{Prompt: "what is in the repo?"})
+	if err != nil {
+		t.Fatalf("RunTask returned error: %v", err)
+	}
+	if answer != "the repo has main.go" {
+		t.Fatalf("expected the child's final answer, got %q", answer)
+	}
+
+	first := client.requests[0]
+	if len(first.Messages) != 2 || first.Messages[1].Content != "what is in the repo?" || !strings.Contains(first.Messages[0].Content, "sub-agent") {
+		t.Fatalf("expected a fresh history with the sub-agent system prompt, got %+v", first.Messages)
+	}
+	if len(first.Tools) != 2 || first.RequestOptions.ToolChoice != nil {
+		t.Fatalf("expected only the task tools and no forced tool choice, got %d tools and %+v", len(first.Tools), first.RequestOptions.ToolChoice)
+	}
+	if client.correlationIDs[0] != "corr-parent/task-1" {
+		t.Fatalf("expected a child correlation id, got %q", client.correlationIDs[0])
+	}
+	if usage := parentUsage.Session(); usage.TotalTokens != 160 {
+		t.Fatalf("expected the child's usage added to the parent, got %d", usage.TotalTokens)
+	}
+}
+
+func TestSubAgent_ReportsBudgetStops(t *testing.T) {
+	client := &scriptedClient{responses: []llm.CompletionResponse{
+		scriptedResponse("still looking", llm.Usage{}, llm.ToolCall{ID: "call_1", Name: "ListDir", Arguments: `{}`}),
+	}}
+	root := t.TempDir()
+	subAgent := &SubAgent{
+		Parent:   agent.Runner{LLMClient: client, Model: "test-model"},
+		Registry: tools.DefaultRegistry(),
+		Policy:   agent.Policy{MaxTurns: 1},
+	}
+
+	_, err := subAgent.RunTask(tools.ToolContext{CWD: root, AllowedRoot: root, CorrelationID: "corr-parent"}, tools.TaskRequest{Prompt: "explore"})
+	if err == nil || !strings.Contains(err.Error(), "max turns exceeded") || !strings.Contains(err.Error(), "still looking") {
+		t.Fatalf("expected budget error with the last message, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := subAgent.RunTask(tools.ToolContext{CWD: root, AllowedRoot: root, Context: cancelled}, tools.TaskRequest{Prompt: "explore"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the parent's cancellation to stop the child, got %v", err)
+	}
+}
+
+func TestSubAgent_SpendCountsTowardsParentBudget(t *testing.T) {
+	root := t.TempDir()
+	client := &scriptedClient{responses: []llm.CompletionResponse{
+		scriptedResponse("", llm.Usage{TotalTokens: 100}, llm.ToolCall{ID: "call_1", Name: "Task", Arguments: `{"prompt":"explore"}`}),
+		scriptedResponse("explored", llm.Usage{TotalTokens: 1000}),
+		scriptedResponse("unused", llm.Usage{TotalTokens: 100}),
+	}}
+	parentUsage := agent.NewUsageTracker(llm.Usage{})
+	subAgent := &SubAgent{Registry: tools.DefaultRegistry(), Policy: agent.Policy{MaxTurns: 5}}
+	registry := tools.NewRegistry(tools.TaskTool{Runner: subAgent})
+	parent := agent.Runner{
+		LLMClient: client,
+		Model:     "test-model",
+		Usage:     parentUsage,
+		Policy:    agent.Policy{MaxPromptTokens: 500},
+		ExecuteTool: func(ctx context.Context, correlationID string, toolCall llm.ToolCall) string {
+			return DispatchToolCall(Logger{}, registry, tools.ToolContext{Context: ctx, CWD: root, AllowedRoot: root, CorrelationID: correlationID}, toolCall)
+		},
+	}
+	subAgent.Parent = parent
+
+	history := []llm.Message{}
+	_, err := parent.RunPrompt(context.Background(), &history, "delegate", "corr-parent")
+	if !errors.Is(err, agent.ErrUsageBudgetExceeded) {
+		t.Fatalf("expected the sub-agent's spend to exhaust the parent's prompt budget, got %v", err)
+	}
+	if len(client.requests) != 2 {
+		t.Fatalf("expected no parent turn after the task, got %d requests", len(client.requests))
+	}
+}
@@ -0,0 +1,261 @@
+// Package catalog caches the models a provider serves and answers questions
+// about them: whether a model exists, its context length, pricing and tool
+// support.
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+const (
+	DefaultCacheDir = ".shimibot/cache"
+	DefaultTTL      = 24 * time.Hour
+
+	maxSuggestions = 3
+)
+
+// ErrUnknownModel is returned by Validate for a model the provider does not
+// list.
+var ErrUnknownModel = errors.New("unknown model")
+
+// Catalog is the model list of one provider endpoint.
+type Catalog struct {
+	Provider  string          `json:"provider"`
+	BaseURL   string          `json:"base_url"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Models    []llm.ModelInfo `json:"models"`
+	// Stale is set when the provider could not be reached and an expired
+	// cache was used instead.
+	Stale bool `json:"-"`
+}
+
+// Loader fetches catalogs and caches them on disk per provider and base URL.
+type Loader struct {
+	Lister   llm.ModelLister
+	Provider string
+	BaseURL  string
+	// CacheDir and TTL default to DefaultCacheDir and DefaultTTL.
+	CacheDir string
+	TTL      time.Duration
+	Now      func() time.Time
+}
+
+// Load returns the cached catalog while it is fresh, and otherwise fetches
+// it from the provider. refresh skips the cache. When fetching fails, an
+// expired cache is returned marked Stale.
+func (loader Loader) Load(ctx context.Context, refresh bool) (*Catalog, error) {
+	cached, cacheErr := loader.readCache()
+	if cacheErr == nil && !refresh && loader.now().Sub(cached.FetchedAt) < loader.ttl() {
+		return cached, nil
+	}
+
+	if loader.Lister == nil {
+		return nil, fmt.Errorf("provider %s cannot list models", loader.Provider)
+	}
+	models, err := loader.Lister.ListModels(ctx)
+	if err != nil {
+		if cacheErr == nil {
+			cached.Stale = true
+			return cached, nil
+		}
+		return nil, fmt.Errorf("list %s models: %w", loader.Provider, err)
+	}
+
+	catalog := &Catalog{Provider: loader.Provider, BaseURL: loader.BaseURL, FetchedAt: loader.now(), Models: models}
+	if err := loader.writeCache(catalog); err != nil {
+		return catalog, fmt.Errorf("write model cache: %w", err)
+	}
+	return catalog, nil
+}
+
+func (loader Loader) cachePath() string {
+	dir := strings.TrimSpace(loader.CacheDir)
+	if dir == "" {
+		dir = DefaultCacheDir
+	}
+	sum := sha256.Sum256([]byte(loader.BaseURL))
+	return filepath.Join(dir, fmt.Sprintf("models-%s-%s.json", loader.Provider, hex.EncodeToString(sum[:4])))
+}
+
+func (loader Loader) readCache() (*Catalog, error) {
+	data, err := os.ReadFile(loader.cachePath())
+	if err != nil {
+		return nil, err
+	}
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+func (loader Loader) writeCache(catalog *Catalog) error {
+	path := loader.cachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(temporary, path)
+}
+
+func (loader Loader) now() time.Time {
+	if loader.Now != nil {
+		return loader.Now()
+	}
+	return time.Now()
+}
+
+func (loader Loader) ttl() time.Duration {
+	if loader.TTL > 0 {
+		return loader.TTL
+	}
+	return DefaultTTL
+}
+
+// Lookup finds model by id. A name without a tag also matches its ":latest"
+// tag, as Ollama does.
+func (catalog *Catalog) Lookup(model string) (llm.ModelInfo, bool) {
+	if catalog == nil {
+		return llm.ModelInfo{}, false
+	}
+	for _, info := range catalog.Models {
+		if info.ID == model {
+			return info, true
+		}
+	}
+	if !strings.Contains(model, ":") {
+		return catalog.Lookup(model + ":latest")
+	}
+	return llm.ModelInfo{}, false
+}
+
+// Validate returns the model's info, or an ErrUnknownModel error naming the
+// closest model ids.
+func (catalog *Catalog) Validate(model string) (llm.ModelInfo, error) {
+	if info, ok := catalog.Lookup(model); ok {
+		return info, nil
+	}
+	err := fmt.Errorf("%w %q for provider %s", ErrUnknownModel, model, catalog.Provider)
+	if suggestions := catalog.Suggest(model); len(suggestions) > 0 {
+		err = fmt.Errorf("%w (did you mean %s?)", err, strings.Join(suggestions, ", "))
+	}
+	return llm.ModelInfo{}, err
+}
+
+// Suggest returns up to three model ids close to model: ids containing it
+// first, then ids within a small edit distance.
+func (catalog *Catalog) Suggest(model string) []string {
+	type candidate struct {
+		id       string
+		distance int
+	}
+	query := strings.ToLower(model)
+	candidates := make([]candidate, 0)
+	for _, info := range catalog.Models {
+		id := strings.ToLower(info.ID)
+		distance := editDistance(query, id)
+		if query != "" && strings.Contains(id, query) {
+			distance = 0
+		}
+		if distance <= max(2, len(query)/4) {
+			candidates = append(candidates, candidate{id: info.ID, distance: distance})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].id < candidates[j].id
+	})
+
+	suggestions := make([]string, 0, maxSuggestions)
+	for _, candidate := range candidates[:min(len(candidates), maxSuggestions)] {
+		suggestions = append(suggestions, candidate.id)
+	}
+	return suggestions
+}
+
+// Filter selects models for listing. The zero Filter matches every model.
+type Filter struct {
+	// Query matches a case-insensitive substring of the id or name.
+	Query         string
+	ToolsOnly     bool
+	MinContext    int
+	MaxPromptCost float64
+}
+
+// Select returns the models matching filter, sorted by id.
+func (catalog *Catalog) Select(filter Filter) []llm.ModelInfo {
+	query := strings.ToLower(strings.TrimSpace(filter.Query))
+	selected := make([]llm.ModelInfo, 0, len(catalog.Models))
+	for _, info := range catalog.Models {
+		if query != "" && !strings.Contains(strings.ToLower(info.ID), query) && !strings.Contains(strings.ToLower(info.Name), query) {
+			continue
+		}
+		if filter.ToolsOnly && (info.SupportsTools == nil || !*info.SupportsTools) {
+			continue
+		}
+		if filter.MinContext > 0 && info.ContextLength < filter.MinContext {
+			continue
+		}
+		if filter.MaxPromptCost > 0 && (info.Pricing == nil || info.Pricing.PromptPerMillion > filter.MaxPromptCost) {
+			continue
+		}
+		selected = append(selected, info)
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].ID < selected[j].ID })
+	return selected
+}
+
+// Prices returns the reported prices of the models that have them.
+func (catalog *Catalog) Prices() llm.PriceTable {
+	table := llm.PriceTable{}
+	if catalog == nil {
+		return table
+	}
+	for _, info := range catalog.Models {
+		if info.Pricing != nil {
+			table[info.ID] = *info.Pricing
+		}
+	}
+	return table
+}
+
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
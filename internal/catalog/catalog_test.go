@@ -0,0 +1,107 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+type stubLister struct {
+	models []llm.ModelInfo
+	err    error
+	calls  int
+}
+
+func (lister *stubLister) ListModels(ctx context.Context) ([]llm.ModelInfo, error) {
+	lister.calls++
+	return lister.models, lister.err
+}
+
+func boolPointer(value bool) *bool {
+	return &value
+}
+
+func sampleCatalog() *Catalog {
+	return &Catalog{Provider: "openrouter", Models: []llm.ModelInfo{
+		{ID: "anthropic/claude-haiku-4.5", Name: "Claude Haiku 4.5", ContextLength: 200000, SupportsTools: boolPointer(true),
+			Pricing: &llm.ModelPrice{PromptPerMillion: 1, CompletionPerMillion: 5}},
+		{ID: "openai/gpt-4o-mini", ContextLength: 128000, SupportsTools: boolPointer(true),
+			Pricing: &llm.ModelPrice{PromptPerMillion: 0.15, CompletionPerMillion: 0.6}},
+		{ID: "microsoft/phi-3-mini", ContextLength: 4096, SupportsTools: boolPointer(false)},
+		{ID: "llama3.1:latest"},
+	}}
+}
+
+func TestLoader_CachesUntilTTLAndFallsBackToStaleCache(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	lister := &stubLister{models: sampleCatalog().Models}
+	loader := Loader{Lister: lister, Provider: "openrouter", BaseURL: "https://openrouter.ai/api/v1", CacheDir: t.TempDir(), TTL: time.Hour,
+		Now: func() time.Time { return now }}
+
+	if _, err := loader.Load(context.Background(), false); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	catalog, err := loader.Load(context.Background(), false)
+	if err != nil || lister.calls != 1 || len(catalog.Models) != 4 {
+		t.Fatalf("expected cached catalog, got %v after %d calls", err, lister.calls)
+	}
+
+	if _, err := loader.Load(context.Background(), true); err != nil || lister.calls != 2 {
+		t.Fatalf("expected refresh to bypass the cache, got %v after %d calls", err, lister.calls)
+	}
+
+	now = now.Add(2 * time.Hour)
+	lister.err = errors.New("offline")
+	catalog, err = loader.Load(context.Background(), false)
+	if err != nil || !catalog.Stale || lister.calls != 3 {
+		t.Fatalf("expected stale cache when offline, got %+v %v", catalog, err)
+	}
+
+	loader.BaseURL = "http://localhost:11434"
+	if _, err := loader.Load(context.Background(), false); err == nil || !strings.Contains(err.Error(), "offline") {
+		t.Fatalf("expected error without a cache for this base URL, got %v", err)
+	}
+}
+
+func TestCatalog_ValidateSuggestsCloseModels(t *testing.T) {
+	catalog := sampleCatalog()
+
+	if info, err := catalog.Validate("anthropic/claude-haiku-4.5"); err != nil || info.ContextLength != 200000 {
+		t.Fatalf("expected known model, got %+v %v", info, err)
+	}
+	if _, err := catalog.Validate("llama3.1"); err != nil {
+		t.Fatalf("expected untagged name to match :latest, got %v", err)
+	}
+
+	_, err := catalog.Validate("anthropic/claude-haiku-45")
+	if !errors.Is(err, ErrUnknownModel) || !strings.Contains(err.Error(), "did you mean anthropic/claude-haiku-4.5?") {
+		t.Fatalf("expected suggestion, got %v", err)
+	}
+	if _, err := catalog.Validate("something-else-entirely"); err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Fatalf("expected no suggestion, got %v", err)
+	}
+}
+
+func TestCatalog_SelectAndPrices(t *testing.T) {
+	catalog := sampleCatalog()
+
+	selected := catalog.Select(Filter{ToolsOnly: true, MinContext: 100000, MaxPromptCost: 0.5})
+	if len(selected) != 1 || selected[0].ID != "openai/gpt-4o-mini" {
+		t.Fatalf("unexpected selection %+v", selected)
+	}
+	if selected := catalog.Select(Filter{Query: "HAIKU"}); len(selected) != 1 {
+		t.Fatalf("expected case-insensitive query match, got %+v", selected)
+	}
+	if selected := catalog.Select(Filter{}); len(selected) != 4 || selected[0].ID != "anthropic/claude-haiku-4.5" {
+		t.Fatalf("expected every model sorted by id, got %+v", selected)
+	}
+
+	prices := catalog.Prices()
+	if len(prices) != 2 || prices["anthropic/claude-haiku-4.5"].CompletionPerMillion != 5 {
+		t.Fatalf("unexpected prices %+v", prices)
+	}
+}
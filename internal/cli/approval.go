@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/adriankopytko/ShimiBot/internal/agent"
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// maxPreviewLines bounds how much of a diff or argument listing is shown
+// before asking.
+const maxPreviewLines = 120
+
+// TerminalApprover asks about tool calls on the terminal. It shows the
+// tool's preview, such as a diff for file edits, or else its pretty-printed
+// arguments, and accepts approve once, approve always, deny with a reason or
+// edit the arguments.
+type TerminalApprover struct {
+	Input  *LineReader
+	Output io.Writer
+	// Preview describes what a call would change; it may be nil.
+	Preview func(toolCall llm.ToolCall) (string, bool)
+}
+
+// NewTerminalApprover asks on stdin and stdout, sharing stdin with the
+// interactive shell.
+func NewTerminalApprover(preview func(toolCall llm.ToolCall) (string, bool)) *TerminalApprover {
+	return &TerminalApprover{Input: stdinLines(), Output: os.Stdout, Preview: preview}
+}
+
+func (approver *TerminalApprover) Approve(ctx context.Context, toolCall llm.ToolCall) (agent.ApprovalDecision, error) {
+	fmt.Fprintf(approver.Output, "tool> %s\n%s\n", toolCall.Name, approver.describe(toolCall))
+	for {
+		fmt.Fprintf(approver.Output, "run it? [y]es, [a]lways for %s, [n]o, [e]dit arguments: ", toolCall.Name)
+		answer, err := approver.readLine(ctx)
+		if err != nil {
+			return agent.ApprovalDecision{}, err
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return agent.ApprovalDecision{Approved: true}, nil
+		case "a", "always":
+			return agent.ApprovalDecision{Approved: true, Always: true}, nil
+		case "n", "no":
+			fmt.Fprint(approver.Output, "reason for the model (optional): ")
+			reason, err := approver.readLine(ctx)
+			if err != nil {
+				return agent.ApprovalDecision{}, err
+			}
+			if reason == "" {
+				return agent.ApprovalDecision{Reason: "the user declined to run it"}, nil
+			}
+			return agent.ApprovalDecision{Reason: "the user declined to run it: " + reason}, nil
+		case "e", "edit":
+			arguments, err := approver.readArguments(ctx)
+			if err != nil {
+				return agent.ApprovalDecision{}, err
+			}
+			if arguments == "" {
+				continue
+			}
+			return agent.ApprovalDecision{Approved: true, Arguments: arguments}, nil
+		}
+	}
+}
+
+// describe returns the tool's preview or its indented arguments, cut to
+// maxPreviewLines.
+func (approver *TerminalApprover) describe(toolCall llm.ToolCall) string {
+	if approver.Preview != nil {
+		if preview, ok := approver.Preview(toolCall); ok {
+			return truncateLines(preview, maxPreviewLines)
+		}
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(toolCall.Arguments), "", "  "); err != nil {
+		return truncateLines(toolCall.Arguments, maxPreviewLines)
+	}
+	return truncateLines(indented.String(), maxPreviewLines)
+}
+
+func truncateLines(text string, limit int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > limit {
+		hidden := len(lines) - limit
+		lines = append(lines[:limit], fmt.Sprintf("... %d more line(s)", hidden))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// readArguments asks for replacement JSON arguments until they parse. An
+// empty answer keeps the model's arguments and returns "".
+func (approver *TerminalApprover) readArguments(ctx context.Context) (string, error) {
+	for {
+		fmt.Fprint(approver.Output, "new arguments as one line of JSON (empty to go back): ")
+		arguments, err := approver.readLine(ctx)
+		if err != nil || arguments == "" {
+			return "", err
+		}
+		if json.Valid([]byte(arguments)) {
+			return arguments, nil
+		}
+		fmt.Fprintln(approver.Output, "not valid JSON, try again")
+	}
+}
+
+// readLine waits for an answer until ctx is done, so cancelling the turn
+// also abandons the prompt.
+func (approver *TerminalApprover) readLine(ctx context.Context) (string, error) {
+	line, err := approver.Input.ReadLine(ctx)
+	if errors.Is(err, io.EOF) {
+		return "", errors.New("no answer to the approval prompt: input closed")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
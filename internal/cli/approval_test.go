@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+func answering(input string) (*TerminalApprover, *strings.Builder) {
+	output := &strings.Builder{}
+	return &TerminalApprover{Input: NewLineReader(strings.NewReader(input)), Output: output}, output
+}
+
+func TestTerminalApprover_Decisions(t *testing.T) {
+	toolCall := llm.ToolCall{Name: "Bash", Arguments: `{"command":"make clean"}`}
+
+	approver, output := answering("maybe\na\n")
+	decision, err := approver.Approve(context.Background(), toolCall)
+	if err != nil || !decision.Approved || !decision.Always {
+		t.Fatalf("expected approve always after re-asking, got %+v %v", decision, err)
+	}
+	if !strings.Contains(output.String(), "tool> Bash\n{\n  \"command\": \"make clean\"\n}") {
+		t.Fatalf("expected pretty-printed arguments, got %q", output.String())
+	}
+
+	approver, _ = answering("n\nuse go clean instead\n")
+	decision, _ = approver.Approve(context.Background(), toolCall)
+	if decision.Approved || decision.Reason != "the user declined to run it: use go clean instead" {
+		t.Fatalf("expected denial with reason, got %+v", decision)
+	}
+
+	approver, output = answering("e\n{broken\n{\"command\":\"go clean\"}\n")
+	decision, _ = approver.Approve(context.Background(), toolCall)
+	if !decision.Approved || decision.Arguments != `{"command":"go clean"}` || !strings.Contains(output.String(), "not valid JSON") {
+		t.Fatalf("expected edited arguments, got %+v", decision)
+	}
+
+	approver, _ = answering("")
+	if _, err := approver.Approve(context.Background(), toolCall); err == nil {
+		t.Fatal("expected error when input is closed")
+	}
+}
+
+func TestTerminalApprover_ShowsPreview(t *testing.T) {
+	approver, output := answering("y\n")
+	approver.Preview = func(toolCall llm.ToolCall) (string, bool) {
+		return "--- a/x\n+++ b/x\n@@ -1,1 +1,1 @@\n-old\n+new\n", true
+	}
+	if decision, _ := approver.Approve(context.Background(), llm.ToolCall{Name: "Write", Arguments: "{}"}); !decision.Approved {
+		t.Fatalf("expected approval, got %+v", decision)
+	}
+	if !strings.Contains(output.String(), "-old\n+new\nrun it?") {
+		t.Fatalf("expected diff before the prompt, got %q", output.String())
+	}
+}
@@ -1,26 +1,100 @@
 package cli
 
 import (
-	"fmt"
 	"flag"
+	"fmt"
 	"os"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
 )
 
 type Config struct {
-	Prompt      string
-	SessionID   string
-	Interactive bool
-	LogEnabled  bool
-	LogLevel    string
-	LogSink     string
-	LogFile     string
+	Prompt       string
+	SessionID    string
+	Provider     string
+	Interactive  bool
+	LogEnabled   bool
+	LogLevel     string
+	LogSink      string
+	LogFile      string
 	TurnTimeout  time.Duration
 	ToolTimeout  time.Duration
 	MaxTurns     int
 	MaxToolCalls int
+	PriceTable   string
+	LLMRetries   int
+	// Fallbacks and ToolResultModel are "provider:model" route specs.
+	Fallbacks       []string
+	ToolResultModel string
+	// TextToolModels are models, or path.Match patterns, that get tools
+	// through the text protocol instead of native tool calling.
+	TextToolModels []string
+	// RecordCassette and ReplayCassette are cassette file paths; at most one
+	// may be set.
+	RecordCassette string
+	ReplayCassette string
+	// RequestOptions holds the sampling and tool-choice settings sent with
+	// every LLM request.
+	RequestOptions llm.RequestOptions
+	// ShowReasoning prints streamed model reasoning, dimmed, in the
+	// interactive shell.
+	ShowReasoning bool
+	// Compaction is the strategy used once the history passes
+	// CompactionThreshold of ContextWindow tokens.
+	Compaction          string
+	ContextWindow       int
+	CompactionThreshold float64
+	// ContextWindowSet reports whether ContextWindow was configured rather
+	// than defaulted, so the model's catalog context length may replace it.
+	ContextWindowSet bool
+	// ValidateModel checks the configured model against the provider's
+	// model catalog at startup.
+	ValidateModel bool
+	// Command is a subcommand given after the flags, such as "models", and
+	// CommandArgs are its arguments.
+	Command     string
+	CommandArgs []string
+	// OutputSchema is the path of a JSON Schema the final answer must match.
+	OutputSchema  string
+	OutputRepairs int
+	// ToolConcurrency is how many tool calls of one turn may run at once.
+	ToolConcurrency int
+	// TaskTools are the tools sub-agents started by the Task tool may use;
+	// when empty, from "none", the Task tool is not offered. TaskPolicy holds each
+	// sub-agent's budgets.
+	TaskTools  []string
+	TaskPolicy TaskPolicy
+	// Approval is the tool approval policy. Empty means ask-mutating in the
+	// interactive shell; runs without it must set a policy that never asks.
+	Approval string
+	// Plan starts in plan mode: only read-only tools until the user accepts
+	// the plan.
+	Plan bool
+	// WrapUp asks the model for a progress summary when the turn or tool
+	// call budget runs out.
+	WrapUp bool
+	// MaxRepetitions stops a prompt once a tool call has repeated the same
+	// call or error this many times.
+	MaxRepetitions int
+	// Resume continues the run -session was in when it was interrupted.
+	Resume bool
+
+	MaxPromptTokens  int
+	MaxSessionTokens int
+	MaxPromptCost    float64
+	MaxSessionCost   float64
+}
+
+// TaskPolicy limits one delegated task. Zero values mean no limit.
+type TaskPolicy struct {
+	MaxTurns     int
+	MaxToolCalls int
+	MaxCost      float64
 }
 
 func ParseConfig() (Config, error) {
@@ -38,16 +112,66 @@ func ParseArgs(args []string, envLookup func(string) string) (Config, error) {
 		defaultLogSink = "stderr"
 	}
 	defaultLogFile := strings.TrimSpace(envLookup("SHIMIBOT_LOG_FILE"))
+	defaultProvider := strings.TrimSpace(envLookup("AI_PROVIDER"))
+	if defaultProvider == "" {
+		defaultProvider = "openrouter"
+	}
 	defaultTurnTimeout := parseDurationEnvLookup(envLookup("SHIMIBOT_TURN_TIMEOUT"), 90*time.Second)
 	defaultToolTimeout := parseDurationEnvLookup(envLookup("SHIMIBOT_TOOL_TIMEOUT"), 30*time.Second)
 	defaultMaxTurns := parseIntEnvLookup(envLookup("SHIMIBOT_MAX_TURNS"), 0)
 	defaultMaxToolCalls := parseIntEnvLookup(envLookup("SHIMIBOT_MAX_TOOL_CALLS"), 0)
+	defaultMaxRepetitions := parseIntEnvLookup(envLookup("SHIMIBOT_MAX_REPETITIONS"), 3)
+	defaultToolConcurrency := parseIntEnvLookup(envLookup("SHIMIBOT_TOOL_CONCURRENCY"), 4)
+	defaultApproval := strings.TrimSpace(envLookup("SHIMIBOT_APPROVAL"))
+	defaultPlan := parseBoolEnvLookup(envLookup("SHIMIBOT_PLAN"), false)
+	defaultWrapUp := parseBoolEnvLookup(envLookup("SHIMIBOT_WRAP_UP"), false)
+	defaultTaskTools := strings.TrimSpace(envLookup("SHIMIBOT_TASK_TOOLS"))
+	if defaultTaskTools == "" {
+		defaultTaskTools = "Read,ListDir,FetchWebPage,WebSearchOllama"
+	}
+	defaultTaskMaxTurns := parseIntEnvLookup(envLookup("SHIMIBOT_TASK_MAX_TURNS"), 20)
+	defaultTaskMaxToolCalls := parseIntEnvLookup(envLookup("SHIMIBOT_TASK_MAX_TOOL_CALLS"), 50)
+	defaultTaskMaxCost := parseFloatEnvLookup(envLookup("SHIMIBOT_TASK_MAX_COST"), 0)
+	defaultLLMRetries := parseIntEnvLookup(envLookup("SHIMIBOT_LLM_RETRIES"), 3)
+	defaultFallbacks := strings.TrimSpace(envLookup("AI_FALLBACK_MODELS"))
+	defaultToolResultModel := strings.TrimSpace(envLookup("AI_TOOL_RESULT_MODEL"))
+	defaultTextToolModels := strings.TrimSpace(envLookup("SHIMIBOT_TEXT_TOOL_MODELS"))
+	defaultRecordCassette := strings.TrimSpace(envLookup("SHIMIBOT_RECORD_CASSETTE"))
+	defaultReplayCassette := strings.TrimSpace(envLookup("SHIMIBOT_REPLAY_CASSETTE"))
+	defaultTemperature := strings.TrimSpace(envLookup("SHIMIBOT_TEMPERATURE"))
+	defaultTopP := strings.TrimSpace(envLookup("SHIMIBOT_TOP_P"))
+	defaultMaxTokens := parseIntEnvLookup(envLookup("SHIMIBOT_MAX_TOKENS"), 0)
+	defaultStop := envLookup("SHIMIBOT_STOP")
+	defaultSeed := strings.TrimSpace(envLookup("SHIMIBOT_SEED"))
+	defaultToolChoice := strings.TrimSpace(envLookup("SHIMIBOT_TOOL_CHOICE"))
+	defaultParallelToolCalls := strings.TrimSpace(envLookup("SHIMIBOT_PARALLEL_TOOL_CALLS"))
+	defaultReasoningEffort := strings.TrimSpace(envLookup("SHIMIBOT_REASONING_EFFORT"))
+	defaultReasoningBudget := parseIntEnvLookup(envLookup("SHIMIBOT_REASONING_BUDGET"), 0)
+	defaultShowReasoning := parseBoolEnvLookup(envLookup("SHIMIBOT_SHOW_REASONING"), false)
+	defaultPromptCache := parseBoolEnvLookup(envLookup("SHIMIBOT_PROMPT_CACHE"), true)
+	defaultCompaction := strings.TrimSpace(envLookup("SHIMIBOT_COMPACTION"))
+	if defaultCompaction == "" {
+		defaultCompaction = "elide"
+	}
+	defaultContextWindow := parseIntEnvLookup(envLookup("SHIMIBOT_CONTEXT_WINDOW"), 128000)
+	contextWindowFromEnv := strings.TrimSpace(envLookup("SHIMIBOT_CONTEXT_WINDOW")) != ""
+	defaultValidateModel := parseBoolEnvLookup(envLookup("SHIMIBOT_VALIDATE_MODEL"), true)
+	defaultCompactionThreshold := parseFloatEnvLookup(envLookup("SHIMIBOT_COMPACTION_THRESHOLD"), 0.8)
+	defaultOutputSchema := strings.TrimSpace(envLookup("SHIMIBOT_OUTPUT_SCHEMA"))
+	defaultOutputRepairs := parseIntEnvLookup(envLookup("SHIMIBOT_OUTPUT_REPAIRS"), 2)
+	defaultPriceTable := strings.TrimSpace(envLookup("SHIMIBOT_PRICE_TABLE"))
+	defaultMaxPromptTokens := parseIntEnvLookup(envLookup("SHIMIBOT_MAX_PROMPT_TOKENS"), 0)
+	defaultMaxSessionTokens := parseIntEnvLookup(envLookup("SHIMIBOT_MAX_SESSION_TOKENS"), 0)
+	defaultMaxPromptCost := parseFloatEnvLookup(envLookup("SHIMIBOT_MAX_PROMPT_COST"), 0)
+	defaultMaxSessionCost := parseFloatEnvLookup(envLookup("SHIMIBOT_MAX_SESSION_COST"), 0)
 
 	config := Config{}
 	flagSet := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	flagSet.SetOutput(os.Stderr)
 	flagSet.StringVar(&config.Prompt, "p", "", "Prompt to send to LLM")
 	flagSet.StringVar(&config.SessionID, "session", "", "Session ID used to persist and resume chat history")
+	flagSet.BoolVar(&config.Resume, "resume", false, "Continue the session's interrupted run, answering the tool calls it left unfinished (needs -session)")
+	flagSet.StringVar(&config.Provider, "provider", defaultProvider, "LLM provider: openrouter, anthropic, ollama")
 	flagSet.BoolVar(&config.Interactive, "interactive", false, "Run in interactive multi-turn mode")
 	flagSet.BoolVar(&config.LogEnabled, "log-enabled", defaultLogEnabled, "Enable logging output")
 	flagSet.StringVar(&config.LogLevel, "log-level", defaultLogLevel, "Log level: error, warn, info, debug")
@@ -57,10 +181,92 @@ func ParseArgs(args []string, envLookup func(string) string) (Config, error) {
 	flagSet.DurationVar(&config.ToolTimeout, "tool-timeout", defaultToolTimeout, "Maximum duration per tool execution (e.g. 30s, 2m)")
 	flagSet.IntVar(&config.MaxTurns, "max-turns", defaultMaxTurns, "Maximum LLM turns per prompt (0 means no limit)")
 	flagSet.IntVar(&config.MaxToolCalls, "max-tool-calls", defaultMaxToolCalls, "Maximum tool calls per prompt (0 means no limit)")
+	flagSet.IntVar(&config.ToolConcurrency, "tool-concurrency", defaultToolConcurrency, "Maximum tool calls of one turn run at once (1 runs them one after another)")
+	flagSet.StringVar(&config.Approval, "approval", defaultApproval, "Tool approval policy: ask, ask-mutating, read-only or auto (required with -p unless -interactive)")
+	taskTools := ""
+	flagSet.IntVar(&config.MaxRepetitions, "max-repetitions", defaultMaxRepetitions, "Stop a prompt once a tool call repeats the same call or error this many times (0 means no limit)")
+	flagSet.BoolVar(&config.WrapUp, "wrap-up", defaultWrapUp, "When -max-turns or -max-tool-calls runs out, ask the model to summarize its progress and next steps")
+	flagSet.BoolVar(&config.Plan, "plan", defaultPlan, "Start in plan mode: only read-only tools until the plan is accepted with :accept")
+	flagSet.StringVar(&taskTools, "task-tools", defaultTaskTools, "Comma-separated tools sub-agents started by the Task tool may use, or none to disable the Task tool")
+	flagSet.IntVar(&config.TaskPolicy.MaxTurns, "task-max-turns", defaultTaskMaxTurns, "Maximum LLM turns per delegated task (0 means no limit)")
+	flagSet.IntVar(&config.TaskPolicy.MaxToolCalls, "task-max-tool-calls", defaultTaskMaxToolCalls, "Maximum tool calls per delegated task (0 means no limit)")
+	flagSet.Float64Var(&config.TaskPolicy.MaxCost, "task-max-cost", defaultTaskMaxCost, "Maximum estimated USD cost per delegated task (0 means no limit)")
+	fallbacks := ""
+	flagSet.StringVar(&fallbacks, "fallback", defaultFallbacks, "Comma-separated provider:model routes tried in order when the primary model fails")
+	flagSet.StringVar(&config.ToolResultModel, "tool-result-model", defaultToolResultModel, "provider:model route for turns that only carry tool results")
+	textToolModels := ""
+	flagSet.StringVar(&textToolModels, "text-tool-models", defaultTextToolModels, "Comma-separated models (or glob patterns) without native tool calling; tools are described in the prompt and calls parsed from text")
+	flagSet.StringVar(&config.RecordCassette, "record", defaultRecordCassette, "Record every LLM request and response to this cassette file")
+	flagSet.StringVar(&config.ReplayCassette, "replay", defaultReplayCassette, "Serve LLM responses from this cassette file instead of calling a provider")
+	temperature := ""
+	topP := ""
+	stop := ""
+	seed := ""
+	toolChoice := ""
+	parallelToolCalls := ""
+	flagSet.StringVar(&temperature, "temperature", defaultTemperature, "Sampling temperature (empty uses the provider default)")
+	flagSet.StringVar(&topP, "top-p", defaultTopP, "Nucleus sampling top_p (empty uses the provider default)")
+	flagSet.IntVar(&config.RequestOptions.MaxTokens, "max-tokens", defaultMaxTokens, "Maximum completion tokens per LLM call (0 uses the provider default)")
+	flagSet.StringVar(&stop, "stop", defaultStop, "Comma-separated stop sequences")
+	flagSet.StringVar(&seed, "seed", defaultSeed, "Sampling seed for providers that support it")
+	flagSet.StringVar(&toolChoice, "tool-choice", defaultToolChoice, "Tool choice for the first turn of a prompt: auto, none, required or a tool name")
+	flagSet.StringVar(&parallelToolCalls, "parallel-tool-calls", defaultParallelToolCalls, "Allow parallel tool calls: true or false (empty uses the provider default)")
+	reasoningEffort := ""
+	reasoningBudget := 0
+	flagSet.StringVar(&reasoningEffort, "reasoning-effort", defaultReasoningEffort, "Enable model reasoning with effort: low, medium or high")
+	flagSet.IntVar(&reasoningBudget, "reasoning-budget", defaultReasoningBudget, "Enable model reasoning with this token budget (overrides the effort's budget)")
+	promptCache := true
+	flagSet.BoolVar(&promptCache, "prompt-cache", defaultPromptCache, "Mark the system prompt, tools and earlier history cacheable for providers with explicit prompt caching")
+	flagSet.BoolVar(&config.ShowReasoning, "show-reasoning", defaultShowReasoning, "Show streamed model reasoning in interactive mode")
+	flagSet.StringVar(&config.Compaction, "compaction", defaultCompaction, "History compaction near the context window: none, elide, window, summarize")
+	flagSet.IntVar(&config.ContextWindow, "context-window", defaultContextWindow, "Model context window in tokens used to decide when to compact history")
+	flagSet.Float64Var(&config.CompactionThreshold, "compaction-threshold", defaultCompactionThreshold, "Fraction of the context window at which history is compacted")
+	flagSet.StringVar(&config.OutputSchema, "output-schema", defaultOutputSchema, "Path to a JSON Schema file; the final answer must be JSON matching it")
+	flagSet.IntVar(&config.OutputRepairs, "output-repairs", defaultOutputRepairs, "Times an answer that fails -output-schema validation is sent back for correction")
+	flagSet.IntVar(&config.LLMRetries, "llm-retries", defaultLLMRetries, "Maximum retries for rate-limited, overloaded or failed LLM requests (0 disables retries)")
+	flagSet.IntVar(&config.MaxPromptTokens, "max-prompt-tokens", defaultMaxPromptTokens, "Maximum total tokens per prompt (0 means no limit)")
+	flagSet.IntVar(&config.MaxSessionTokens, "max-session-tokens", defaultMaxSessionTokens, "Maximum total tokens per session (0 means no limit)")
+	flagSet.Float64Var(&config.MaxPromptCost, "max-prompt-cost", defaultMaxPromptCost, "Maximum estimated USD cost per prompt (0 means no limit)")
+	flagSet.Float64Var(&config.MaxSessionCost, "max-session-cost", defaultMaxSessionCost, "Maximum estimated USD cost per session (0 means no limit)")
+	flagSet.BoolVar(&config.ValidateModel, "validate-model", defaultValidateModel, "Check the model against the provider's model list at startup")
+	flagSet.StringVar(&config.PriceTable, "price-table", defaultPriceTable, "Path to a JSON per-model price table (USD per million tokens) used for cost estimates")
 
 	if err := flagSet.Parse(args); err != nil {
 		return Config{}, err
 	}
+	config.ContextWindowSet = contextWindowFromEnv
+	flagSet.Visit(func(set *flag.Flag) {
+		if set.Name == "context-window" {
+			config.ContextWindowSet = true
+		}
+	})
+	if remaining := flagSet.Args(); len(remaining) > 0 {
+		config.Command, config.CommandArgs = remaining[0], remaining[1:]
+	}
+	if err := parseRequestOptions(&config.RequestOptions, temperature, topP, stop, seed, toolChoice, parallelToolCalls); err != nil {
+		return Config{}, err
+	}
+	if err := parseReasoningOptions(&config.RequestOptions, reasoningEffort, reasoningBudget); err != nil {
+		return Config{}, err
+	}
+	config.RequestOptions.DisablePromptCache = !promptCache
+	for _, spec := range strings.Split(fallbacks, ",") {
+		if trimmed := strings.TrimSpace(spec); trimmed != "" {
+			config.Fallbacks = append(config.Fallbacks, trimmed)
+		}
+	}
+	for _, pattern := range strings.Split(textToolModels, ",") {
+		if trimmed := strings.TrimSpace(pattern); trimmed != "" {
+			config.TextToolModels = append(config.TextToolModels, trimmed)
+		}
+	}
+	if !strings.EqualFold(strings.TrimSpace(taskTools), "none") {
+		for _, name := range strings.Split(taskTools, ",") {
+			if trimmed := strings.TrimSpace(name); trimmed != "" {
+				config.TaskTools = append(config.TaskTools, trimmed)
+			}
+		}
+	}
 
 	if err := validateConfig(config); err != nil {
 		return Config{}, err
@@ -83,6 +289,24 @@ func validateConfig(config Config) error {
 			return fmt.Errorf("invalid value for -log-sink: %q (use: stderr, stdout, json-file)", config.LogSink)
 		}
 
+		switch strings.ToLower(strings.TrimSpace(config.Provider)) {
+		case "openrouter", "anthropic", "ollama":
+		default:
+			return fmt.Errorf("invalid value for -provider: %q (use: openrouter, anthropic, ollama)", config.Provider)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(config.Compaction)) {
+		case "none", "elide", "window", "summarize":
+		default:
+			return fmt.Errorf("invalid value for -compaction: %q (use: none, elide, window, summarize)", config.Compaction)
+		}
+		if config.ContextWindow < 0 {
+			return fmt.Errorf("invalid value for -context-window: must be >= 0")
+		}
+		if config.CompactionThreshold <= 0 || config.CompactionThreshold > 1 {
+			return fmt.Errorf("invalid value for -compaction-threshold: must be > 0 and <= 1")
+		}
+
 		if config.TurnTimeout <= 0 {
 			return fmt.Errorf("invalid value for -turn-timeout: must be > 0")
 		}
@@ -95,12 +319,153 @@ func validateConfig(config Config) error {
 		if config.MaxToolCalls < 0 {
 			return fmt.Errorf("invalid value for -max-tool-calls: must be >= 0")
 		}
+		if config.Resume && strings.TrimSpace(config.SessionID) == "" {
+			return fmt.Errorf("invalid value for -resume: needs -session")
+		}
+		if config.MaxRepetitions < 0 {
+			return fmt.Errorf("invalid value for -max-repetitions: must be >= 0")
+		}
+		if config.ToolConcurrency < 1 {
+			return fmt.Errorf("invalid value for -tool-concurrency: must be >= 1")
+		}
+		if config.TaskPolicy.MaxTurns < 0 {
+			return fmt.Errorf("invalid value for -task-max-turns: must be >= 0")
+		}
+		if config.TaskPolicy.MaxToolCalls < 0 {
+			return fmt.Errorf("invalid value for -task-max-tool-calls: must be >= 0")
+		}
+		if config.TaskPolicy.MaxCost < 0 {
+			return fmt.Errorf("invalid value for -task-max-cost: must be >= 0")
+		}
+		if slices.Contains(config.TaskTools, "Task") {
+			return fmt.Errorf("invalid value for -task-tools: sub-agents cannot start sub-agents")
+		}
+		if err := validateApproval(config); err != nil {
+			return err
+		}
+		for _, pattern := range config.TextToolModels {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid value for -text-tool-models: %q is not a valid pattern", pattern)
+			}
+		}
+		switch config.Command {
+		case "":
+		case "models":
+			if strings.TrimSpace(config.ReplayCassette) != "" {
+				return fmt.Errorf("invalid flags: the models command cannot be combined with -replay")
+			}
+		default:
+			return fmt.Errorf("unknown command %q (use: models)", config.Command)
+		}
+		if strings.TrimSpace(config.RecordCassette) != "" && strings.TrimSpace(config.ReplayCassette) != "" {
+			return fmt.Errorf("invalid flags: -record and -replay cannot be combined")
+		}
+		if config.RequestOptions.MaxTokens < 0 {
+			return fmt.Errorf("invalid value for -max-tokens: must be >= 0")
+		}
+		if config.LLMRetries < 0 {
+			return fmt.Errorf("invalid value for -llm-retries: must be >= 0")
+		}
+		if config.OutputRepairs < 0 {
+			return fmt.Errorf("invalid value for -output-repairs: must be >= 0")
+		}
+		if config.MaxPromptTokens < 0 {
+			return fmt.Errorf("invalid value for -max-prompt-tokens: must be >= 0")
+		}
+		if config.MaxSessionTokens < 0 {
+			return fmt.Errorf("invalid value for -max-session-tokens: must be >= 0")
+		}
+		if config.MaxPromptCost < 0 {
+			return fmt.Errorf("invalid value for -max-prompt-cost: must be >= 0")
+		}
+		if config.MaxSessionCost < 0 {
+			return fmt.Errorf("invalid value for -max-session-cost: must be >= 0")
+		}
 		return nil
 	default:
 		return fmt.Errorf("invalid value for -log-level: %q (use: error, warn, info, debug)", config.LogLevel)
 	}
 }
 
+// validateApproval checks the approval policy. A prompt or resumed run
+// outside the interactive shell has nobody to ask, so it needs a policy that
+// never asks.
+func validateApproval(config Config) error {
+	approval := strings.ToLower(strings.TrimSpace(config.Approval))
+	switch approval {
+	case "", "ask", "ask-mutating", "read-only", "auto":
+	default:
+		return fmt.Errorf("invalid value for -approval: %q (use: ask, ask-mutating, read-only, auto)", config.Approval)
+	}
+	if config.Interactive || config.Command != "" || (strings.TrimSpace(config.Prompt) == "" && !config.Resume) {
+		return nil
+	}
+	if approval == "" {
+		return fmt.Errorf("missing -approval: non-interactive runs must choose read-only or auto")
+	}
+	if approval == "ask" || approval == "ask-mutating" {
+		return fmt.Errorf("invalid value for -approval: %q needs -interactive; non-interactive runs must choose read-only or auto", config.Approval)
+	}
+	return nil
+}
+
+// parseRequestOptions converts the optional sampling flags, leaving unset
+// values nil so the provider default applies.
+func parseRequestOptions(options *llm.RequestOptions, temperature, topP, stop, seed, toolChoice, parallelToolCalls string) error {
+	if trimmed := strings.TrimSpace(temperature); trimmed != "" {
+		parsed, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil || parsed < 0 || parsed > 2 {
+			return fmt.Errorf("invalid value for -temperature: %q (use a number between 0 and 2)", temperature)
+		}
+		options.Temperature = &parsed
+	}
+	if trimmed := strings.TrimSpace(topP); trimmed != "" {
+		parsed, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			return fmt.Errorf("invalid value for -top-p: %q (use a number in (0, 1])", topP)
+		}
+		options.TopP = &parsed
+	}
+	for _, sequence := range strings.Split(stop, ",") {
+		if sequence != "" {
+			options.Stop = append(options.Stop, sequence)
+		}
+	}
+	if trimmed := strings.TrimSpace(seed); trimmed != "" {
+		parsed, err := strconv.ParseInt(trimmed, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value for -seed: %q", seed)
+		}
+		options.Seed = &parsed
+	}
+	options.ToolChoice = llm.ParseToolChoice(toolChoice)
+	if trimmed := strings.TrimSpace(parallelToolCalls); trimmed != "" {
+		parsed, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			return fmt.Errorf("invalid value for -parallel-tool-calls: %q (use: true, false)", parallelToolCalls)
+		}
+		options.ParallelToolCalls = &parsed
+	}
+	return nil
+}
+
+// parseReasoningOptions enables reasoning when an effort or a budget is set.
+func parseReasoningOptions(options *llm.RequestOptions, effort string, budget int) error {
+	normalizedEffort := llm.ReasoningEffort(strings.ToLower(strings.TrimSpace(effort)))
+	switch normalizedEffort {
+	case "", llm.ReasoningEffortLow, llm.ReasoningEffortMedium, llm.ReasoningEffortHigh:
+	default:
+		return fmt.Errorf("invalid value for -reasoning-effort: %q (use: low, medium, high)", effort)
+	}
+	if budget < 0 {
+		return fmt.Errorf("invalid value for -reasoning-budget: must be >= 0")
+	}
+	if normalizedEffort != "" || budget > 0 {
+		options.Reasoning = &llm.ReasoningOptions{Effort: normalizedEffort, BudgetTokens: budget}
+	}
+	return nil
+}
+
 func parseBoolEnvLookup(value string, fallback bool) bool {
 	value = strings.TrimSpace(strings.ToLower(value))
 	switch value {
@@ -136,3 +501,15 @@ func parseIntEnvLookup(value string, fallback int) int {
 	}
 	return parsed
 }
+
+func parseFloatEnvLookup(value string, fallback float64) float64 {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || parsed < 0 {
+		return fallback
+	}
+	return parsed
+}
@@ -3,8 +3,11 @@ package cli
 import (
 	"errors"
 	"flag"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
 )
 
 func envMap(values map[string]string) func(string) string {
@@ -49,6 +52,21 @@ func TestParseArgs_UsesDefaultsWhenNoFlags(t *testing.T) {
 	if config.MaxToolCalls != 0 {
 		t.Fatalf("expected default max-tool-calls 0, got %d", config.MaxToolCalls)
 	}
+	if config.WrapUp {
+		t.Fatalf("expected default wrap-up false, got true")
+	}
+	if config.MaxRepetitions != 3 {
+		t.Fatalf("expected default max-repetitions 3, got %d", config.MaxRepetitions)
+	}
+	if config.ToolConcurrency != 4 {
+		t.Fatalf("expected default tool-concurrency 4, got %d", config.ToolConcurrency)
+	}
+	if config.Provider != "openrouter" {
+		t.Fatalf("expected default provider openrouter, got %q", config.Provider)
+	}
+	if config.LLMRetries != 3 {
+		t.Fatalf("expected default llm-retries 3, got %d", config.LLMRetries)
+	}
 }
 
 func TestParseArgs_UsesEnvDefaults(t *testing.T) {
@@ -61,11 +79,15 @@ func TestParseArgs_UsesEnvDefaults(t *testing.T) {
 		"SHIMIBOT_TOOL_TIMEOUT":   "45s",
 		"SHIMIBOT_MAX_TURNS":      "7",
 		"SHIMIBOT_MAX_TOOL_CALLS": "9",
+		"AI_PROVIDER":             "ollama",
 	}))
 	if err != nil {
 		t.Fatalf("ParseArgs returned error: %v", err)
 	}
 
+	if config.Provider != "ollama" {
+		t.Fatalf("expected env default provider ollama, got %q", config.Provider)
+	}
 	if !config.LogEnabled {
 		t.Fatalf("expected env default log-enabled true, got false")
 	}
@@ -93,7 +115,7 @@ func TestParseArgs_UsesEnvDefaults(t *testing.T) {
 }
 
 func TestParseArgs_FlagsOverrideEnvDefaults(t *testing.T) {
-	config, err := ParseArgs([]string{"-log-enabled=false", "-log-level=warn", "-log-sink=stdout", "-log-file=/tmp/override.log", "-interactive", "-session=s1", "-p", "hello", "-turn-timeout=75s", "-tool-timeout=12s", "-max-turns=3", "-max-tool-calls=4"}, envMap(map[string]string{
+	config, err := ParseArgs([]string{"-log-enabled=false", "-log-level=warn", "-log-sink=stdout", "-log-file=/tmp/override.log", "-interactive", "-session=s1", "-p", "hello", "-turn-timeout=75s", "-tool-timeout=12s", "-max-turns=3", "-max-tool-calls=4", "-wrap-up"}, envMap(map[string]string{
 		"LOG_ENABLED":             "true",
 		"LOG_LEVEL":               "debug",
 		"SHIMIBOT_LOG_SINK":       "json-file",
@@ -140,6 +162,9 @@ func TestParseArgs_FlagsOverrideEnvDefaults(t *testing.T) {
 	if config.MaxToolCalls != 4 {
 		t.Fatalf("expected max-tool-calls 4, got %d", config.MaxToolCalls)
 	}
+	if !config.WrapUp {
+		t.Fatalf("expected wrap-up true, got false")
+	}
 }
 
 func TestParseArgs_ReturnsErrorForInvalidLogLevel(t *testing.T) {
@@ -156,6 +181,13 @@ func TestParseArgs_ReturnsErrorForInvalidLogSink(t *testing.T) {
 	}
 }
 
+func TestParseArgs_ReturnsErrorForInvalidProvider(t *testing.T) {
+	_, err := ParseArgs([]string{"-provider=nope"}, envMap(map[string]string{}))
+	if err == nil {
+		t.Fatal("expected error for invalid provider, got nil")
+	}
+}
+
 func TestParseArgs_ReturnsErrorForMissingLogFileWithJSONSink(t *testing.T) {
 	_, err := ParseArgs([]string{"-log-sink=json-file"}, envMap(map[string]string{}))
 	if err == nil {
@@ -173,9 +205,174 @@ func TestParseArgs_ReturnsErrorForInvalidRuntimeLimits(t *testing.T) {
 	if _, err := ParseArgs([]string{"-max-turns=-1"}, envMap(map[string]string{})); err == nil {
 		t.Fatal("expected error for negative max-turns")
 	}
+	if _, err := ParseArgs([]string{"-max-repetitions=-1"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected error for negative max-repetitions")
+	}
 	if _, err := ParseArgs([]string{"-max-tool-calls=-2"}, envMap(map[string]string{})); err == nil {
 		t.Fatal("expected error for negative max-tool-calls")
 	}
+	if _, err := ParseArgs([]string{"-llm-retries=-1"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected error for negative llm-retries")
+	}
+}
+
+func TestParseArgs_UsageBudgets(t *testing.T) {
+	config, err := ParseArgs([]string{"-max-prompt-tokens=5000", "-max-session-cost=1.5"}, envMap(map[string]string{
+		"SHIMIBOT_MAX_PROMPT_TOKENS":  "100",
+		"SHIMIBOT_MAX_SESSION_TOKENS": "20000",
+		"SHIMIBOT_MAX_PROMPT_COST":    "0.25",
+	}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.MaxPromptTokens != 5000 {
+		t.Fatalf("expected flag max-prompt-tokens 5000, got %d", config.MaxPromptTokens)
+	}
+	if config.MaxSessionTokens != 20000 {
+		t.Fatalf("expected env max-session-tokens 20000, got %d", config.MaxSessionTokens)
+	}
+	if config.MaxPromptCost != 0.25 {
+		t.Fatalf("expected env max-prompt-cost 0.25, got %f", config.MaxPromptCost)
+	}
+	if config.MaxSessionCost != 1.5 {
+		t.Fatalf("expected flag max-session-cost 1.5, got %f", config.MaxSessionCost)
+	}
+
+	if _, err := ParseArgs([]string{"-max-prompt-cost=-1"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected error for negative max-prompt-cost")
+	}
+	if _, err := ParseArgs([]string{"-max-session-tokens=-5"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected error for negative max-session-tokens")
+	}
+}
+
+func TestParseArgs_RoutingFlags(t *testing.T) {
+	config, err := ParseArgs([]string{"-tool-result-model=ollama:llama3.2"}, envMap(map[string]string{
+		"AI_FALLBACK_MODELS": " anthropic:claude-haiku-4-5, ,ollama ",
+	}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if len(config.Fallbacks) != 2 || config.Fallbacks[0] != "anthropic:claude-haiku-4-5" || config.Fallbacks[1] != "ollama" {
+		t.Fatalf("expected two trimmed fallbacks, got %q", config.Fallbacks)
+	}
+	if config.ToolResultModel != "ollama:llama3.2" {
+		t.Fatalf("expected tool-result-model flag, got %q", config.ToolResultModel)
+	}
+}
+
+func TestParseArgs_CassetteFlags(t *testing.T) {
+	config, err := ParseArgs([]string{"-replay=run.json"}, envMap(map[string]string{}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.ReplayCassette != "run.json" || config.RecordCassette != "" {
+		t.Fatalf("expected replay cassette only, got %+v", config)
+	}
+
+	if _, err := ParseArgs([]string{"-replay=run.json"}, envMap(map[string]string{"SHIMIBOT_RECORD_CASSETTE": "out.json"})); err == nil {
+		t.Fatal("expected error when recording and replaying at once")
+	}
+}
+
+func TestParseArgs_RequestOptions(t *testing.T) {
+	config, err := ParseArgs([]string{"-temperature=0.2", "-max-tokens=512", "-tool-choice=Read", "-parallel-tool-calls=false"}, envMap(map[string]string{
+		"SHIMIBOT_STOP": "END,STOP",
+		"SHIMIBOT_SEED": "42",
+	}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	options := config.RequestOptions
+	if options.Temperature == nil || *options.Temperature != 0.2 || options.TopP != nil || options.MaxTokens != 512 {
+		t.Fatalf("expected sampling options from flags, got %+v", options)
+	}
+	if len(options.Stop) != 2 || options.Seed == nil || *options.Seed != 42 {
+		t.Fatalf("expected stop and seed from env, got %+v", options)
+	}
+	if options.ToolChoice == nil || options.ToolChoice.Mode != llm.ToolChoiceTool || options.ToolChoice.Name != "Read" {
+		t.Fatalf("expected forced Read tool choice, got %+v", options.ToolChoice)
+	}
+	if options.ParallelToolCalls == nil || *options.ParallelToolCalls {
+		t.Fatalf("expected parallel tool calls disabled, got %v", options.ParallelToolCalls)
+	}
+
+	for _, args := range [][]string{{"-temperature=3"}, {"-top-p=0"}, {"-seed=x"}, {"-parallel-tool-calls=maybe"}, {"-max-tokens=-1"}} {
+		if _, err := ParseArgs(args, envMap(map[string]string{})); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
+
+func TestParseArgs_ReasoningFlags(t *testing.T) {
+	config, err := ParseArgs([]string{}, envMap(map[string]string{}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.RequestOptions.Reasoning != nil || config.ShowReasoning {
+		t.Fatalf("expected reasoning off by default, got %+v", config.RequestOptions.Reasoning)
+	}
+
+	config, err = ParseArgs([]string{"-reasoning-effort=HIGH", "-show-reasoning"}, envMap(map[string]string{"SHIMIBOT_REASONING_BUDGET": "2048"}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	reasoning := config.RequestOptions.Reasoning
+	if reasoning == nil || reasoning.Effort != llm.ReasoningEffortHigh || reasoning.BudgetTokens != 2048 || !config.ShowReasoning {
+		t.Fatalf("expected reasoning settings from flags and env, got %+v", reasoning)
+	}
+
+	for _, args := range [][]string{{"-reasoning-effort=max"}, {"-reasoning-budget=-1"}} {
+		if _, err := ParseArgs(args, envMap(map[string]string{})); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
+
+func TestParseArgs_CompactionFlags(t *testing.T) {
+	config, err := ParseArgs([]string{}, envMap(map[string]string{}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.Compaction != "elide" || config.ContextWindow != 128000 || config.CompactionThreshold != 0.8 {
+		t.Fatalf("unexpected compaction defaults: %q %d %f", config.Compaction, config.ContextWindow, config.CompactionThreshold)
+	}
+
+	config, err = ParseArgs([]string{"-compaction=summarize", "-compaction-threshold=0.6"}, envMap(map[string]string{"SHIMIBOT_CONTEXT_WINDOW": "32000"}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.Compaction != "summarize" || config.ContextWindow != 32000 || config.CompactionThreshold != 0.6 {
+		t.Fatalf("unexpected compaction settings: %q %d %f", config.Compaction, config.ContextWindow, config.CompactionThreshold)
+	}
+
+	for _, args := range [][]string{{"-compaction=truncate"}, {"-context-window=-1"}, {"-compaction-threshold=1.5"}} {
+		if _, err := ParseArgs(args, envMap(map[string]string{})); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
+
+func TestParseArgs_OutputSchemaFlags(t *testing.T) {
+	config, err := ParseArgs([]string{"-output-schema", "schema.json"}, envMap(map[string]string{}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.OutputSchema != "schema.json" || config.OutputRepairs != 2 {
+		t.Fatalf("expected schema path and default repairs, got %q %d", config.OutputSchema, config.OutputRepairs)
+	}
+
+	config, err = ParseArgs([]string{}, envMap(map[string]string{"SHIMIBOT_OUTPUT_SCHEMA": "env.json", "SHIMIBOT_OUTPUT_REPAIRS": "0"}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.OutputSchema != "env.json" || config.OutputRepairs != 0 {
+		t.Fatalf("expected schema settings from env, got %q %d", config.OutputSchema, config.OutputRepairs)
+	}
+
+	if _, err := ParseArgs([]string{"-output-repairs=-1"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected error for negative -output-repairs")
+	}
 }
 
 func TestParseArgs_ReturnsHelpError(t *testing.T) {
@@ -184,3 +381,116 @@ func TestParseArgs_ReturnsHelpError(t *testing.T) {
 		t.Fatalf("expected flag.ErrHelp, got %v", err)
 	}
 }
+
+func TestParseArgs_PromptCacheFlag(t *testing.T) {
+	config, err := ParseArgs([]string{}, envMap(map[string]string{}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.RequestOptions.DisablePromptCache {
+		t.Fatal("expected prompt caching on by default")
+	}
+
+	config, err = ParseArgs([]string{}, envMap(map[string]string{"SHIMIBOT_PROMPT_CACHE": "false"}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if !config.RequestOptions.DisablePromptCache {
+		t.Fatal("expected SHIMIBOT_PROMPT_CACHE=false to disable prompt caching")
+	}
+}
+
+func TestParseArgs_TextToolModels(t *testing.T) {
+	config, err := ParseArgs([]string{"-text-tool-models=phi3, llama2*,"}, envMap(map[string]string{}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if len(config.TextToolModels) != 2 || config.TextToolModels[0] != "phi3" || config.TextToolModels[1] != "llama2*" {
+		t.Fatalf("unexpected text tool models %v", config.TextToolModels)
+	}
+
+	if _, err := ParseArgs([]string{}, envMap(map[string]string{"SHIMIBOT_TEXT_TOOL_MODELS": "llama[2"})); err == nil {
+		t.Fatal("expected error for malformed pattern")
+	}
+}
+
+func TestParseArgs_ModelsCommandAndValidation(t *testing.T) {
+	config, err := ParseArgs([]string{"-provider=ollama", "models", "-tools", "llama"}, envMap(map[string]string{}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.Command != "models" || len(config.CommandArgs) != 2 || !config.ValidateModel || config.ContextWindowSet {
+		t.Fatalf("unexpected command config %+v", config)
+	}
+
+	config, err = ParseArgs([]string{"-validate-model=false", "-context-window=64000"}, envMap(map[string]string{}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.ValidateModel || !config.ContextWindowSet {
+		t.Fatalf("expected validation off and context window set, got %+v", config)
+	}
+
+	if _, err := ParseArgs([]string{"chat"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected error for unknown command")
+	}
+}
+
+func TestParseArgs_ToolConcurrency(t *testing.T) {
+	config, err := ParseArgs([]string{}, envMap(map[string]string{"SHIMIBOT_TOOL_CONCURRENCY": "1"}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if config.ToolConcurrency != 1 {
+		t.Fatalf("expected env tool-concurrency 1, got %d", config.ToolConcurrency)
+	}
+	if _, err := ParseArgs([]string{"-tool-concurrency=0"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected error for tool-concurrency 0")
+	}
+}
+
+func TestParseArgs_ApprovalPolicy(t *testing.T) {
+	if _, err := ParseArgs([]string{"-p", "hello"}, envMap(map[string]string{})); err == nil || !strings.Contains(err.Error(), "missing -approval") {
+		t.Fatalf("expected non-interactive run without a policy to fail, got %v", err)
+	}
+	if _, err := ParseArgs([]string{"-p", "hello", "-approval=ask"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected prompting policy to need -interactive")
+	}
+	config, err := ParseArgs([]string{"-p", "hello"}, envMap(map[string]string{"SHIMIBOT_APPROVAL": "read-only"}))
+	if err != nil || config.Approval != "read-only" {
+		t.Fatalf("expected env approval read-only, got %q (%v)", config.Approval, err)
+	}
+	if _, err := ParseArgs([]string{"-interactive", "-approval=ask"}, envMap(map[string]string{})); err != nil {
+		t.Fatalf("expected ask to be allowed interactively, got %v", err)
+	}
+	if _, err := ParseArgs([]string{"-interactive", "-approval=never"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected unknown approval policy to fail")
+	}
+	if _, err := ParseArgs([]string{"-resume", "-session=s1"}, envMap(map[string]string{})); err == nil || !strings.Contains(err.Error(), "missing -approval") {
+		t.Fatalf("expected non-interactive resume without a policy to fail, got %v", err)
+	}
+	if _, err := ParseArgs([]string{"-resume", "-approval=auto"}, envMap(map[string]string{})); err == nil || !strings.Contains(err.Error(), "needs -session") {
+		t.Fatalf("expected resume without a session to fail, got %v", err)
+	}
+	config, err = ParseArgs([]string{"-interactive"}, envMap(map[string]string{"SHIMIBOT_PLAN": "true"}))
+	if err != nil || !config.Plan {
+		t.Fatalf("expected env to start in plan mode, got %t (%v)", config.Plan, err)
+	}
+}
+
+func TestParseArgs_TaskTools(t *testing.T) {
+	config, err := ParseArgs([]string{"-task-max-turns=5"}, envMap(map[string]string{}))
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if len(config.TaskTools) != 4 || config.TaskTools[0] != "Read" || config.TaskPolicy.MaxTurns != 5 || config.TaskPolicy.MaxToolCalls != 50 {
+		t.Fatalf("unexpected task defaults %v %+v", config.TaskTools, config.TaskPolicy)
+	}
+	config, err = ParseArgs([]string{}, envMap(map[string]string{"SHIMIBOT_TASK_TOOLS": "none"}))
+	if err != nil || len(config.TaskTools) != 0 {
+		t.Fatalf("expected none to disable the Task tool, got %v (%v)", config.TaskTools, err)
+	}
+	if _, err := ParseArgs([]string{"-task-tools=Read,Task"}, envMap(map[string]string{})); err == nil {
+		t.Fatal("expected nested Task to be rejected")
+	}
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// DescribeError explains provider failures in terms the user can act on and
+// falls back to the plain error text for everything else.
+func DescribeError(err error) string {
+	var apiErr *llm.APIError
+	if !errors.As(err, &apiErr) {
+		return err.Error()
+	}
+
+	var hint string
+	switch apiErr.Kind {
+	case llm.ErrorKindAuth:
+		hint = "the provider rejected the credentials; check the API key for the selected provider"
+	case llm.ErrorKindRateLimit:
+		hint = "the provider is rate limiting requests; wait a moment or raise -llm-retries"
+	case llm.ErrorKindOverloaded:
+		hint = "the provider is overloaded or unavailable; try again later or raise -llm-retries"
+	case llm.ErrorKindContextLength:
+		hint = "the conversation no longer fits the model's context window; start a new session"
+	case llm.ErrorKindInvalidRequest:
+		hint = "the provider rejected the request; check the model name and provider settings"
+	case llm.ErrorKindTransport:
+		hint = "could not reach the provider; check the base URL and your network connection"
+	default:
+		return err.Error()
+	}
+	return fmt.Sprintf("%s\n  %s", err.Error(), hint)
+}
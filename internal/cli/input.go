@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// LineReader reads lines on its own goroutine, so a caller waiting for a
+// line can give up when its context is done, such as on Ctrl-C, and the
+// line still goes to the next caller.
+type LineReader struct {
+	lines chan string
+	// err is set before lines is closed.
+	err error
+}
+
+func NewLineReader(input io.Reader) *LineReader {
+	reader := &LineReader{lines: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(input)
+		for scanner.Scan() {
+			reader.lines <- scanner.Text()
+		}
+		reader.err = scanner.Err()
+		close(reader.lines)
+	}()
+	return reader
+}
+
+// ReadLine returns the next line, or io.EOF once the input has ended.
+func (reader *LineReader) ReadLine(ctx context.Context) (string, error) {
+	select {
+	case line, ok := <-reader.lines:
+		if !ok {
+			if reader.err != nil {
+				return "", reader.err
+			}
+			return "", io.EOF
+		}
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+var (
+	stdinOnce   sync.Once
+	stdinReader *LineReader
+)
+
+// stdinLines reads the shell's input. The terminal approver reads its
+// answers from it too, so neither loses lines the other has buffered. It
+// starts reading stdin on first use.
+func stdinLines() *LineReader {
+	stdinOnce.Do(func() {
+		stdinReader = NewLineReader(os.Stdin)
+	})
+	return stdinReader
+}
@@ -1,32 +1,147 @@
 package cli
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+
+	"github.com/adriankopytko/ShimiBot/internal/agent"
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// TurnRunner runs one prompt, sending the run's events to observer; the
+// returned string is the final answer. The shell cancels ctx on Ctrl-C.
+type TurnRunner func(ctx context.Context, input string, observer agent.Observer) (string, error)
+
+// LocalCommand is handled by the shell itself when the input is ":<Name>",
+// optionally followed by arguments.
+type LocalCommand struct {
+	Name        string
+	Description string
+	Run         func(args string)
+	// Turn, when set instead of Run, runs an agent turn with the arguments
+	// as input and is printed like a prompt.
+	Turn TurnRunner
+}
+
+const (
+	ansiDim   = "\x1b[2m"
+	ansiReset = "\x1b[0m"
 )
 
-type TurnRunner func(input string) (string, error)
+type printMode int
+
+const (
+	printNone printMode = iota
+	printReasoning
+	printText
+)
+
+// streamPrinter writes streamed reasoning dimmed on "thinking>" lines and
+// answer text on "assistant>" lines. It ends the open line when a turn ends,
+// before any tool approval prompt, and ignores other events.
+type streamPrinter struct {
+	mode      printMode
+	wroteText bool
+}
+
+func (printer *streamPrinter) Observe(event agent.Event) {
+	switch typed := event.(type) {
+	case agent.AssistantDeltaEvent:
+		printer.write(typed.Delta)
+	case agent.TurnEndEvent:
+		printer.endLine()
+	}
+}
+
+func (printer *streamPrinter) write(delta llm.StreamDelta) {
+	if delta.Reasoning != "" {
+		printer.switchTo(printReasoning)
+		fmt.Print(delta.Reasoning)
+	}
+	if delta.Content != "" {
+		printer.switchTo(printText)
+		fmt.Print(delta.Content)
+		printer.wroteText = true
+	}
+}
+
+func (printer *streamPrinter) switchTo(mode printMode) {
+	if printer.mode == mode {
+		return
+	}
+	printer.endLine()
+	switch mode {
+	case printReasoning:
+		fmt.Print(ansiDim + "thinking> ")
+	case printText:
+		fmt.Print("assistant> ")
+	}
+	printer.mode = mode
+}
+
+func (printer *streamPrinter) endLine() {
+	switch printer.mode {
+	case printReasoning:
+		fmt.Println(ansiReset)
+	case printText:
+		fmt.Println()
+	}
+	printer.mode = printNone
+}
+
+// finish ends the open line and reports whether answer text was streamed.
+func (printer *streamPrinter) finish() bool {
+	printer.endLine()
+	return printer.wroteText
+}
+
+// RunInteractive reads prompts until the input ends or :exit. After each
+// turn it prints status, when set and non-empty, such as the todo list.
+//
+// Ctrl-C cancels the turn in flight and returns to the prompt; pressed again
+// within a couple of seconds, it makes RunInteractive return ErrInterrupted.
+func RunInteractive(sessionID string, runTurn TurnRunner, status func() string, commands ...LocalCommand) error {
+	interrupts, stop := watchInterrupts()
+	defer stop()
+	return runShell(stdinLines(), interrupts, sessionID, runTurn, status, commands)
+}
 
-func RunInteractive(sessionID string, runTurn TurnRunner) error {
+func runShell(lines *LineReader, interrupts *interruptHandler, sessionID string, runTurn TurnRunner, status func() string, commands []LocalCommand) error {
 	if strings.TrimSpace(sessionID) != "" {
 		fmt.Fprintf(os.Stderr, "session: %s\n", sessionID)
 	}
 
-	scanner := bufio.NewScanner(os.Stdin)
 	for {
 		fmt.Print("you> ")
-		if !scanner.Scan() {
+		readCtx, cancelRead := interrupts.context()
+		line, err := lines.ReadLine(readCtx)
+		interrupted := readCtx.Err() != nil
+		cancelRead()
+		if interrupted {
+			fmt.Println()
+			if interrupts.exiting() {
+				return ErrInterrupted
+			}
+			fmt.Fprintln(os.Stderr, "(press Ctrl-C again to exit)")
+			continue
+		}
+		if errors.Is(err, io.EOF) {
 			break
 		}
+		if err != nil {
+			return err
+		}
 
-		input := strings.TrimSpace(scanner.Text())
+		input := strings.TrimSpace(line)
 		if input == "" {
 			continue
 		}
 
-		handled, shouldExit := dispatchLocalCommand(input)
+		handled, shouldExit := dispatchLocalCommand(input, commands)
 		if handled {
 			if shouldExit {
 				break
@@ -34,27 +149,69 @@ func RunInteractive(sessionID string, runTurn TurnRunner) error {
 			continue
 		}
 
-		responseText, runErr := runTurn(input)
-		if runErr != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", runErr)
-			continue
+		turn := runTurn
+		if command, args, ok := findLocalCommand(input, commands); ok && command.Turn != nil {
+			turn, input = command.Turn, args
 		}
 
-		fmt.Printf("assistant> %s\n", responseText)
-	}
-
-	if scanErr := scanner.Err(); scanErr != nil {
-		return scanErr
+		printer := &streamPrinter{}
+		turnCtx, cancelTurn := interrupts.context()
+		responseText, runErr := turn(turnCtx, input, printer)
+		interrupted = turnCtx.Err() != nil
+		cancelTurn()
+		streamed := printer.finish()
+		// A failed turn may still return text, such as a wrap-up summary.
+		if !streamed && responseText != "" {
+			fmt.Printf("assistant> %s\n", responseText)
+		}
+		switch {
+		case interrupted && errors.Is(runErr, context.Canceled):
+			fmt.Fprintln(os.Stderr, "turn cancelled")
+		case runErr != nil:
+			fmt.Fprintf(os.Stderr, "error: %s\n", DescribeError(runErr))
+		}
+		if interrupted && interrupts.exiting() {
+			return ErrInterrupted
+		}
+		if status != nil {
+			if text := status(); text != "" {
+				fmt.Println(text)
+			}
+		}
 	}
 
 	return nil
 }
 
-func dispatchLocalCommand(input string) (handled bool, shouldExit bool) {
+func dispatchLocalCommand(input string, commands []LocalCommand) (handled bool, shouldExit bool) {
 	switch input {
 	case ":exit", ":quit":
 		return true, true
-	default:
+	case ":help":
+		fmt.Println(":exit, :quit  leave the shell")
+		for _, command := range commands {
+			fmt.Printf(":%-12s %s\n", command.Name, command.Description)
+		}
+		return true, false
+	}
+
+	command, args, ok := findLocalCommand(input, commands)
+	if !ok || command.Run == nil {
 		return false, false
 	}
+	command.Run(args)
+	return true, false
+}
+
+func findLocalCommand(input string, commands []LocalCommand) (LocalCommand, string, bool) {
+	if !strings.HasPrefix(input, ":") {
+		return LocalCommand{}, "", false
+	}
+	name, args, _ := strings.Cut(strings.TrimPrefix(input, ":"), " ")
+	for _, command := range commands {
+		if command.Name == name {
+			return command, strings.TrimSpace(args), true
+		}
+	}
+	return LocalCommand{}, "", false
 }
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/agent"
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+func TestDispatchLocalCommand_RunsRegisteredCommand(t *testing.T) {
+	receivedArgs := ""
+	invoked := 0
+	commands := []LocalCommand{{
+		Name: "usage",
+		Run: func(args string) {
+			invoked++
+			receivedArgs = args
+		},
+	}}
+
+	handled, shouldExit := dispatchLocalCommand(":usage  session ", commands)
+	if !handled || shouldExit {
+		t.Fatalf("expected command handled without exit, got handled=%t exit=%t", handled, shouldExit)
+	}
+	if invoked != 1 || receivedArgs != "session" {
+		t.Fatalf("expected command invoked once with args, got invoked=%d args=%q", invoked, receivedArgs)
+	}
+}
+
+func TestDispatchLocalCommand_ExitAndPassthrough(t *testing.T) {
+	if handled, shouldExit := dispatchLocalCommand(":quit", nil); !handled || !shouldExit {
+		t.Fatalf("expected :quit to exit")
+	}
+	if handled, _ := dispatchLocalCommand(":unknown", nil); handled {
+		t.Fatalf("expected unknown command to be passed to the model")
+	}
+	if handled, _ := dispatchLocalCommand("hello", nil); handled {
+		t.Fatalf("expected plain input to be passed to the model")
+	}
+	turnCommands := []LocalCommand{{Name: "resume", Turn: func(ctx context.Context, input string, observer agent.Observer) (string, error) { return "", nil }}}
+	if handled, _ := dispatchLocalCommand(":resume", turnCommands); handled {
+		t.Fatalf("expected a turn command to be left to the turn loop")
+	}
+	if command, _, ok := findLocalCommand(":resume now", turnCommands); !ok || command.Turn == nil {
+		t.Fatalf("expected the turn command to be found")
+	}
+}
+
+func TestRunShell_CtrlCCancelsTurnThenExitsWhenRepeated(t *testing.T) {
+	interrupts := &interruptHandler{window: time.Minute}
+	started := make(chan struct{}, 1)
+	inputs := []string{}
+	runTurn := func(ctx context.Context, input string, observer agent.Observer) (string, error) {
+		inputs = append(inputs, input)
+		if input == "slow" {
+			started <- struct{}{}
+			<-ctx.Done()
+			return "", fmt.Errorf("request failed: %w", ctx.Err())
+		}
+		return "ok", nil
+	}
+	go func() {
+		<-started
+		interrupts.interrupt(time.Now())
+	}()
+
+	lines := NewLineReader(strings.NewReader("slow\nquick\n"))
+	if err := runShell(lines, interrupts, "", runTurn, nil, nil); err != nil {
+		t.Fatalf("expected the shell to continue after one Ctrl-C, got %v", err)
+	}
+	if len(inputs) != 2 || inputs[1] != "quick" {
+		t.Fatalf("expected the next prompt run after the cancelled turn, got %v", inputs)
+	}
+
+	interrupts = &interruptHandler{window: time.Minute}
+	go func() {
+		<-started
+		interrupts.interrupt(time.Now())
+		interrupts.interrupt(time.Now())
+	}()
+	lines = NewLineReader(strings.NewReader("slow\nquick\n"))
+	if err := runShell(lines, interrupts, "", runTurn, nil, nil); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("expected a second Ctrl-C to exit, got %v", err)
+	}
+}
+
+func TestInterruptHandler_ExitsOnlyWithinWindow(t *testing.T) {
+	interrupts := &interruptHandler{window: 2 * time.Second}
+	start := time.Now()
+	interrupts.interrupt(start)
+	interrupts.interrupt(start.Add(3 * time.Second))
+	if interrupts.exiting() {
+		t.Fatal("expected Ctrl-C presses further apart than the window not to exit")
+	}
+	interrupts.interrupt(start.Add(4 * time.Second))
+	if !interrupts.exiting() {
+		t.Fatal("expected a second Ctrl-C within the window to exit")
+	}
+}
+
+func TestFormatUsage(t *testing.T) {
+	text := FormatUsage(llm.Usage{PromptTokens: 100, CachedTokens: 40, CompletionTokens: 20, TotalTokens: 120, Cost: 0.0123})
+	expected := "120 tokens (prompt 100, cached 40, completion 20), ~$0.0123"
+	if text != expected {
+		t.Fatalf("expected %q, got %q", expected, text)
+	}
+
+	text = FormatUsage(llm.Usage{PromptTokens: 100, CachedTokens: 40, CacheWriteTokens: 50, CompletionTokens: 20, TotalTokens: 120})
+	expected = "120 tokens (prompt 100, cached 40, cache write 50, completion 20)"
+	if text != expected {
+		t.Fatalf("expected %q, got %q", expected, text)
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	authErr := fmt.Errorf("turn failed: %w", llm.NewHTTPError("anthropic", 401, nil, "invalid x-api-key"))
+	if text := DescribeError(authErr); !strings.Contains(text, "invalid x-api-key") || !strings.Contains(text, "check the API key") {
+		t.Fatalf("expected auth hint, got %q", text)
+	}
+	if text := DescribeError(errors.New("boom")); text != "boom" {
+		t.Fatalf("expected plain error text, got %q", text)
+	}
+}
+
+func TestFormatStatus(t *testing.T) {
+	if text := FormatStatus(nil, false); text != "" {
+		t.Fatalf("expected no status without todos or plan mode, got %q", text)
+	}
+	text := FormatStatus([]tools.TodoItem{{Content: "rename field", Status: tools.TodoInProgress}}, true)
+	expected := "todo> 0/1 done\n  [>] rename field\nplan> plan mode is on: only read-only tools run until you :accept the plan"
+	if text != expected {
+		t.Fatalf("expected %q, got %q", expected, text)
+	}
+}
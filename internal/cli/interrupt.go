@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// ExitInterrupted is the exit status after Ctrl-C, as shells report a
+// process killed by SIGINT.
+const ExitInterrupted = 130
+
+// ErrInterrupted is returned by RunInteractive when Ctrl-C is pressed twice
+// within interruptWindow.
+var ErrInterrupted = errors.New("interrupted")
+
+// interruptWindow is how soon a second Ctrl-C must follow the first to exit
+// the shell.
+const interruptWindow = 2 * time.Second
+
+// interruptHandler turns Ctrl-C into cancelling whatever the shell is
+// waiting on, a turn or the next line of input. A second Ctrl-C within
+// window also asks the shell to exit.
+type interruptHandler struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	last   time.Time
+	exit   bool
+}
+
+// watchInterrupts handles SIGINT until stop is called, instead of letting
+// it kill the process.
+func watchInterrupts() (handler *interruptHandler, stop func()) {
+	handler = &interruptHandler{window: interruptWindow}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+				handler.interrupt(time.Now())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return handler, func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+func (handler *interruptHandler) interrupt(now time.Time) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if !handler.last.IsZero() && now.Sub(handler.last) <= handler.window {
+		handler.exit = true
+	}
+	handler.last = now
+	if handler.cancel != nil {
+		handler.cancel()
+	}
+}
+
+// context returns a context the next Ctrl-C cancels. Only the latest one is
+// cancelled; callers release it with the returned CancelFunc.
+func (handler *interruptHandler) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handler.mu.Lock()
+	handler.cancel = cancel
+	handler.mu.Unlock()
+	return ctx, cancel
+}
+
+// exiting reports whether Ctrl-C was pressed twice within the window.
+func (handler *interruptHandler) exiting() bool {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	return handler.exit
+}
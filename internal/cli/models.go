@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/adriankopytko/ShimiBot/internal/catalog"
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// ModelsOptions are the arguments of the models command and :models.
+type ModelsOptions struct {
+	Filter  catalog.Filter
+	Refresh bool
+}
+
+// ParseModelsArgs parses "[-tools] [-min-context=N] [-max-price=USD]
+// [-refresh] [query]".
+func ParseModelsArgs(args []string) (ModelsOptions, error) {
+	options := ModelsOptions{}
+	flagSet := flag.NewFlagSet("models", flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	flagSet.BoolVar(&options.Filter.ToolsOnly, "tools", false, "Only list models known to support tool calling")
+	flagSet.IntVar(&options.Filter.MinContext, "min-context", 0, "Only list models with at least this many context tokens")
+	flagSet.Float64Var(&options.Filter.MaxPromptCost, "max-price", 0, "Only list models whose prompt price in USD per million tokens is at most this")
+	flagSet.BoolVar(&options.Refresh, "refresh", false, "Fetch the model list again instead of using the cache")
+	if err := flagSet.Parse(args); err != nil {
+		return ModelsOptions{}, fmt.Errorf("invalid models arguments: %w (use: [-tools] [-min-context=N] [-max-price=USD] [-refresh] [query])", err)
+	}
+	if flagSet.NArg() > 1 {
+		return ModelsOptions{}, fmt.Errorf("invalid models arguments: expected at most one query, got %q", strings.Join(flagSet.Args(), " "))
+	}
+	options.Filter.Query = flagSet.Arg(0)
+	return options, nil
+}
+
+// FormatModels renders models as a table with context length, prices in USD
+// per million tokens and tool support; unknown values are shown as "-".
+func FormatModels(models []llm.ModelInfo) string {
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "MODEL\tCONTEXT\tPROMPT $/M\tCOMPLETION $/M\tTOOLS")
+	for _, model := range models {
+		context, prompt, completion, tools := "-", "-", "-", "-"
+		if model.ContextLength > 0 {
+			context = strconv.Itoa(model.ContextLength)
+		}
+		if model.Pricing != nil {
+			prompt = strconv.FormatFloat(model.Pricing.PromptPerMillion, 'f', -1, 64)
+			completion = strconv.FormatFloat(model.Pricing.CompletionPerMillion, 'f', -1, 64)
+		}
+		if model.SupportsTools != nil {
+			tools = map[bool]string{true: "yes", false: "no"}[*model.SupportsTools]
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", model.ID, context, prompt, completion, tools)
+	}
+	writer.Flush()
+	return builder.String()
+}
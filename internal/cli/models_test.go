@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+func TestParseModelsArgs(t *testing.T) {
+	options, err := ParseModelsArgs([]string{"-tools", "-min-context=100000", "-refresh", "claude"})
+	if err != nil {
+		t.Fatalf("ParseModelsArgs returned error: %v", err)
+	}
+	if !options.Filter.ToolsOnly || options.Filter.MinContext != 100000 || !options.Refresh || options.Filter.Query != "claude" {
+		t.Fatalf("unexpected options %+v", options)
+	}
+
+	for _, args := range [][]string{{"-unknown"}, {"claude", "gpt"}} {
+		if _, err := ParseModelsArgs(args); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
+
+func TestFormatModels(t *testing.T) {
+	supportsTools := true
+	text := FormatModels([]llm.ModelInfo{
+		{ID: "openai/gpt-4o-mini", ContextLength: 128000, SupportsTools: &supportsTools, Pricing: &llm.ModelPrice{PromptPerMillion: 0.15, CompletionPerMillion: 0.6}},
+		{ID: "llama3.1:latest"},
+	})
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and two rows, got %q", text)
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "openai/gpt-4o-mini 128000 0.15 0.6 yes" {
+		t.Fatalf("unexpected row %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "llama3.1:latest - - - -" {
+		t.Fatalf("unexpected row %q", lines[2])
+	}
+}
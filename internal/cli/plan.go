@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+// FormatStatus renders the todo list and a plan mode reminder for the
+// shell to print after a turn, or "" when there is neither.
+func FormatStatus(todos []tools.TodoItem, planning bool) string {
+	lines := make([]string, 0, 2)
+	if text := tools.FormatTodos(todos); text != "" {
+		lines = append(lines, "todo> "+text)
+	}
+	if planning {
+		lines = append(lines, "plan> plan mode is on: only read-only tools run until you :accept the plan")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// FormatUsage renders token usage and cost for the :usage command.
+func FormatUsage(usage llm.Usage) string {
+	cache := fmt.Sprintf("cached %d", usage.CachedTokens)
+	if usage.CacheWriteTokens > 0 {
+		cache += fmt.Sprintf(", cache write %d", usage.CacheWriteTokens)
+	}
+	text := fmt.Sprintf("%d tokens (prompt %d, %s, completion %d)",
+		usage.TotalTokens, usage.PromptTokens, cache, usage.CompletionTokens)
+	if usage.Cost > 0 {
+		text += fmt.Sprintf(", ~$%.4f", usage.Cost)
+	}
+	return text
+}
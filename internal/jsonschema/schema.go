@@ -0,0 +1,473 @@
+// Package jsonschema validates JSON documents against the subset of JSON
+// Schema that model providers accept for structured output: type, enum,
+// const, properties, required, additionalProperties, items, length, size and
+// range bounds, pattern, allOf/anyOf/oneOf/not and local $ref. Other keywords,
+// such as format, are accepted and ignored.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultName = "response"
+
+var namePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Schema is a parsed JSON Schema document.
+type Schema struct {
+	document map[string]any
+	patterns map[string]*regexp.Regexp
+}
+
+// ValidationError lists every way a document failed to match a schema. Each
+// problem starts with the JSON path of the offending value.
+type ValidationError struct {
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return strings.Join(err.Problems, "; ")
+}
+
+// Load reads and parses the schema file at path.
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read schema: %w", err)
+	}
+	schema, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse schema %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// Parse parses a schema document. It must be a JSON object and every pattern
+// in it must compile.
+func Parse(data []byte) (*Schema, error) {
+	var document map[string]any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("schema must be a JSON object: %w", err)
+	}
+	if document == nil {
+		return nil, errors.New("schema must be a JSON object")
+	}
+
+	schema := &Schema{document: document, patterns: map[string]*regexp.Regexp{}}
+	if err := schema.compilePatterns(document); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// Document returns the parsed schema for sending to a provider.
+func (schema *Schema) Document() map[string]any {
+	return schema.document
+}
+
+// Name returns the schema title reduced to the characters providers accept in
+// a response format name, or "response" when the schema has no title.
+func (schema *Schema) Name() string {
+	title, _ := schema.document["title"].(string)
+	name := strings.Trim(namePattern.ReplaceAllString(title, "_"), "_")
+	if name == "" {
+		return defaultName
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// Validate checks value, as produced by json.Unmarshal into an any, against
+// the schema. It returns a *ValidationError when value does not match.
+func (schema *Schema) Validate(value any) error {
+	problems := schema.validate(schema.document, value, "$", 0)
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// ValidateText extracts a JSON document from a model reply, tolerating
+// surrounding whitespace and a Markdown code fence, and validates it. It
+// returns the extracted document.
+func (schema *Schema) ValidateText(text string) (string, error) {
+	extracted := ExtractJSON(text)
+	if extracted == "" {
+		return "", &ValidationError{Problems: []string{"$: response is empty, expected a JSON document"}}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(extracted))
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", &ValidationError{Problems: []string{fmt.Sprintf("$: response is not valid JSON: %v", err)}}
+	}
+	if decoder.More() {
+		return "", &ValidationError{Problems: []string{"$: response contains more than one JSON document"}}
+	}
+	if err := schema.Validate(value); err != nil {
+		return "", err
+	}
+	return extracted, nil
+}
+
+// ExtractJSON trims text and removes a surrounding Markdown code fence.
+func ExtractJSON(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "```") {
+		return trimmed
+	}
+	body := strings.TrimPrefix(trimmed, "```")
+	newline := strings.IndexByte(body, '\n')
+	if newline < 0 {
+		return trimmed
+	}
+	body = body[newline+1:]
+	body, found := strings.CutSuffix(strings.TrimSpace(body), "```")
+	if !found {
+		return trimmed
+	}
+	return strings.TrimSpace(body)
+}
+
+// maxDepth stops recursive $ref cycles from looping forever.
+const maxDepth = 64
+
+func (schema *Schema) validate(node any, value any, path string, depth int) []string {
+	if depth > maxDepth {
+		return []string{path + ": schema nesting is too deep"}
+	}
+
+	switch typed := node.(type) {
+	case bool:
+		if !typed {
+			return []string{path + ": no value is allowed here"}
+		}
+		return nil
+	case map[string]any:
+		return schema.validateObjectSchema(typed, value, path, depth)
+	default:
+		return nil
+	}
+}
+
+func (schema *Schema) validateObjectSchema(node map[string]any, value any, path string, depth int) []string {
+	if ref, ok := node["$ref"].(string); ok {
+		target, err := schema.resolve(ref)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %v", path, err)}
+		}
+		return schema.validate(target, value, path, depth+1)
+	}
+
+	var problems []string
+	if types, ok := schemaTypes(node["type"]); ok && !matchesAnyType(value, types) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), typeName(value))}
+	}
+
+	if enum, ok := node["enum"].([]any); ok && !containsValue(enum, value) {
+		problems = append(problems, fmt.Sprintf("%s: must be one of %s", path, compactJSON(enum)))
+	}
+	if constant, ok := node["const"]; ok && !reflect.DeepEqual(constant, value) {
+		problems = append(problems, fmt.Sprintf("%s: must equal %s", path, compactJSON(constant)))
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		problems = append(problems, schema.validateObject(node, typed, path, depth)...)
+	case []any:
+		problems = append(problems, schema.validateArray(node, typed, path, depth)...)
+	case string:
+		problems = append(problems, schema.validateString(node, typed, path)...)
+	case float64:
+		problems = append(problems, validateNumber(node, typed, path)...)
+	}
+
+	problems = append(problems, schema.validateCombinators(node, value, path, depth)...)
+	return problems
+}
+
+func (schema *Schema) validateObject(node map[string]any, object map[string]any, path string, depth int) []string {
+	var problems []string
+	if required, ok := node["required"].([]any); ok {
+		for _, entry := range required {
+			name, _ := entry.(string)
+			if _, present := object[name]; name != "" && !present {
+				problems = append(problems, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+	}
+
+	properties, _ := node["properties"].(map[string]any)
+	additional, hasAdditional := node["additionalProperties"]
+	for _, name := range sortedKeys(object) {
+		propertyPath := path + "." + name
+		if propertySchema, ok := properties[name]; ok {
+			problems = append(problems, schema.validate(propertySchema, object[name], propertyPath, depth+1)...)
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			problems = append(problems, fmt.Sprintf("%s: property %q is not allowed", path, name))
+			continue
+		}
+		problems = append(problems, schema.validate(additional, object[name], propertyPath, depth+1)...)
+	}
+
+	if minimum, ok := intKeyword(node, "minProperties"); ok && len(object) < minimum {
+		problems = append(problems, fmt.Sprintf("%s: must have at least %d properties", path, minimum))
+	}
+	if maximum, ok := intKeyword(node, "maxProperties"); ok && len(object) > maximum {
+		problems = append(problems, fmt.Sprintf("%s: must have at most %d properties", path, maximum))
+	}
+	return problems
+}
+
+func (schema *Schema) validateArray(node map[string]any, array []any, path string, depth int) []string {
+	var problems []string
+	if items, ok := node["items"]; ok {
+		for index, item := range array {
+			problems = append(problems, schema.validate(items, item, path+"["+strconv.Itoa(index)+"]", depth+1)...)
+		}
+	}
+	if minimum, ok := intKeyword(node, "minItems"); ok && len(array) < minimum {
+		problems = append(problems, fmt.Sprintf("%s: must have at least %d items", path, minimum))
+	}
+	if maximum, ok := intKeyword(node, "maxItems"); ok && len(array) > maximum {
+		problems = append(problems, fmt.Sprintf("%s: must have at most %d items", path, maximum))
+	}
+	if unique, _ := node["uniqueItems"].(bool); unique {
+		for i := range array {
+			for j := i + 1; j < len(array); j++ {
+				if reflect.DeepEqual(array[i], array[j]) {
+					problems = append(problems, fmt.Sprintf("%s: items %d and %d are equal", path, i, j))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+func (schema *Schema) validateString(node map[string]any, value string, path string) []string {
+	var problems []string
+	length := len([]rune(value))
+	if minimum, ok := intKeyword(node, "minLength"); ok && length < minimum {
+		problems = append(problems, fmt.Sprintf("%s: must be at least %d characters", path, minimum))
+	}
+	if maximum, ok := intKeyword(node, "maxLength"); ok && length > maximum {
+		problems = append(problems, fmt.Sprintf("%s: must be at most %d characters", path, maximum))
+	}
+	if pattern, ok := node["pattern"].(string); ok {
+		if compiled := schema.patterns[pattern]; compiled != nil && !compiled.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("%s: must match pattern %q", path, pattern))
+		}
+	}
+	return problems
+}
+
+func validateNumber(node map[string]any, value float64, path string) []string {
+	var problems []string
+	if minimum, ok := node["minimum"].(float64); ok && value < minimum {
+		problems = append(problems, fmt.Sprintf("%s: must be >= %s", path, formatNumber(minimum)))
+	}
+	if maximum, ok := node["maximum"].(float64); ok && value > maximum {
+		problems = append(problems, fmt.Sprintf("%s: must be <= %s", path, formatNumber(maximum)))
+	}
+	if minimum, ok := node["exclusiveMinimum"].(float64); ok && value <= minimum {
+		problems = append(problems, fmt.Sprintf("%s: must be > %s", path, formatNumber(minimum)))
+	}
+	if maximum, ok := node["exclusiveMaximum"].(float64); ok && value >= maximum {
+		problems = append(problems, fmt.Sprintf("%s: must be < %s", path, formatNumber(maximum)))
+	}
+	if divisor, ok := node["multipleOf"].(float64); ok && divisor > 0 {
+		if quotient := value / divisor; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			problems = append(problems, fmt.Sprintf("%s: must be a multiple of %s", path, formatNumber(divisor)))
+		}
+	}
+	return problems
+}
+
+func (schema *Schema) validateCombinators(node map[string]any, value any, path string, depth int) []string {
+	var problems []string
+	if allOf, ok := node["allOf"].([]any); ok {
+		for _, branch := range allOf {
+			problems = append(problems, schema.validate(branch, value, path, depth+1)...)
+		}
+	}
+	if anyOf, ok := node["anyOf"].([]any); ok && schema.countMatches(anyOf, value, path, depth) == 0 {
+		problems = append(problems, fmt.Sprintf("%s: must match at least one schema in anyOf", path))
+	}
+	if oneOf, ok := node["oneOf"].([]any); ok {
+		if matches := schema.countMatches(oneOf, value, path, depth); matches != 1 {
+			problems = append(problems, fmt.Sprintf("%s: must match exactly one schema in oneOf, matched %d", path, matches))
+		}
+	}
+	if not, ok := node["not"]; ok && len(schema.validate(not, value, path, depth+1)) == 0 {
+		problems = append(problems, fmt.Sprintf("%s: must not match the schema in not", path))
+	}
+	return problems
+}
+
+func (schema *Schema) countMatches(branches []any, value any, path string, depth int) int {
+	matches := 0
+	for _, branch := range branches {
+		if len(schema.validate(branch, value, path, depth+1)) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+// resolve follows a local reference such as "#/$defs/item". Remote
+// references are not supported.
+func (schema *Schema) resolve(ref string) (any, error) {
+	if ref == "#" {
+		return schema.document, nil
+	}
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+
+	var current any = schema.document
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if current, ok = object[token]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return current, nil
+}
+
+func (schema *Schema) compilePatterns(node any) error {
+	switch typed := node.(type) {
+	case map[string]any:
+		if pattern, ok := typed["pattern"].(string); ok {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			schema.patterns[pattern] = compiled
+		}
+		for _, child := range typed {
+			if err := schema.compilePatterns(child); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, child := range typed {
+			if err := schema.compilePatterns(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func schemaTypes(raw any) ([]string, bool) {
+	switch typed := raw.(type) {
+	case string:
+		return []string{typed}, true
+	case []any:
+		types := make([]string, 0, len(typed))
+		for _, entry := range typed {
+			if name, ok := entry.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types, len(types) > 0
+	default:
+		return nil, false
+	}
+}
+
+func matchesAnyType(value any, types []string) bool {
+	for _, name := range types {
+		if name == "integer" {
+			if number, ok := value.(float64); ok && number == math.Trunc(number) {
+				return true
+			}
+			continue
+		}
+		if name == typeName(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func containsValue(values []any, value any) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func intKeyword(node map[string]any, keyword string) (int, bool) {
+	number, ok := node[keyword].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int(number), true
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func compactJSON(value any) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return strings.TrimSpace(buffer.String())
+}
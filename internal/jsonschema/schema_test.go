@@ -0,0 +1,130 @@
+package jsonschema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const reportSchema = `{
+	"title": "Build report!",
+	"type": "object",
+	"required": ["status", "files"],
+	"additionalProperties": false,
+	"properties": {
+		"status": {"enum": ["ok", "failed"]},
+		"files": {"type": "array", "minItems": 1, "items": {"$ref": "#/$defs/file"}},
+		"note": {"type": ["string", "null"], "maxLength": 10}
+	},
+	"$defs": {
+		"file": {
+			"type": "object",
+			"required": ["path", "lines"],
+			"properties": {
+				"path": {"type": "string", "pattern": "^[a-z/]+\\.go$"},
+				"lines": {"type": "integer", "minimum": 0}
+			}
+		}
+	}
+}`
+
+func mustParse(t *testing.T, document string) *Schema {
+	t.Helper()
+	schema, err := Parse([]byte(document))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	return schema
+}
+
+func TestValidateText_AcceptsMatchingDocument(t *testing.T) {
+	schema := mustParse(t, reportSchema)
+
+	reply := "```json\n{\"status\":\"ok\",\"files\":[{\"path\":\"app/main.go\",\"lines\":12}],\"note\":null}\n```"
+	extracted, err := schema.ValidateText(reply)
+	if err != nil {
+		t.Fatalf("ValidateText returned error: %v", err)
+	}
+	if extracted != `{"status":"ok","files":[{"path":"app/main.go","lines":12}],"note":null}` {
+		t.Fatalf("unexpected extracted document: %s", extracted)
+	}
+}
+
+func TestValidateText_ReportsEveryProblem(t *testing.T) {
+	schema := mustParse(t, reportSchema)
+
+	_, err := schema.ValidateText(`{"status":"maybe","files":[{"path":"README.md","lines":1.5}],"extra":true,"note":"far too long"}`)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	want := []string{
+		`$: property "extra" is not allowed`,
+		`$.files[0].lines: expected integer, got number`,
+		`$.files[0].path: must match pattern`,
+		`$.note: must be at most 10 characters`,
+		`$.status: must be one of ["ok","failed"]`,
+	}
+	message := validationErr.Error()
+	for _, expected := range want {
+		if !strings.Contains(message, expected) {
+			t.Fatalf("expected problem %q in %q", expected, message)
+		}
+	}
+}
+
+func TestValidateText_RejectsNonJSON(t *testing.T) {
+	schema := mustParse(t, reportSchema)
+
+	for _, reply := range []string{"", "The build passed.", `{"status":"ok"} {"status":"ok"}`} {
+		if _, err := schema.ValidateText(reply); err == nil {
+			t.Fatalf("expected error for reply %q", reply)
+		}
+	}
+}
+
+func TestValidate_Combinators(t *testing.T) {
+	schema := mustParse(t, `{
+		"oneOf": [{"type": "integer"}, {"type": "number", "minimum": 10}],
+		"not": {"const": 3}
+	}`)
+
+	if err := schema.Validate(float64(2)); err != nil {
+		t.Fatalf("expected 2 to match, got %v", err)
+	}
+	if err := schema.Validate(float64(12)); err == nil || !strings.Contains(err.Error(), "matched 2") {
+		t.Fatalf("expected oneOf failure for 12, got %v", err)
+	}
+	if err := schema.Validate(float64(3)); err == nil || !strings.Contains(err.Error(), "must not match") {
+		t.Fatalf("expected not failure for 3, got %v", err)
+	}
+}
+
+func TestParse_RejectsInvalidSchemas(t *testing.T) {
+	for _, document := range []string{`[]`, `null`, `{"pattern": "("}`} {
+		if _, err := Parse([]byte(document)); err == nil {
+			t.Fatalf("expected error for schema %s", document)
+		}
+	}
+}
+
+func TestLoad_NameFromTitle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(reportSchema), 0o600); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+
+	schema, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if schema.Name() != "Build_report" {
+		t.Fatalf("unexpected name %q", schema.Name())
+	}
+	if mustParse(t, `{}`).Name() != "response" {
+		t.Fatalf("expected default name for untitled schema")
+	}
+}
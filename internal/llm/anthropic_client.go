@@ -0,0 +1,553 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+
+	anthropicAPIVersion       = "2023-06-01"
+	defaultAnthropicMaxTokens = 4096
+	minAnthropicThinking      = 1024
+)
+
+type AnthropicClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+type anthropicRequest struct {
+	Model         string                  `json:"model"`
+	MaxTokens     int                     `json:"max_tokens"`
+	System        []anthropicContentBlock `json:"system,omitempty"`
+	Messages      []anthropicMessage      `json:"messages"`
+	Tools         []anthropicTool         `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice    `json:"tool_choice,omitempty"`
+	Temperature   *float64                `json:"temperature,omitempty"`
+	TopP          *float64                `json:"top_p,omitempty"`
+	StopSequences []string                `json:"stop_sequences,omitempty"`
+	Thinking      *anthropicThinking      `json:"thinking,omitempty"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	// Content is a string or, for tool results with media, a block list.
+	Content   any              `json:"content,omitempty"`
+	Source    *anthropicSource `json:"source,omitempty"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Signature string           `json:"signature,omitempty"`
+	// Data is the encrypted reasoning of a redacted_thinking block.
+	Data string `json:"data,omitempty"`
+
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	InputSchema  map[string]any         `json:"input_schema"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Role       string                  `json:"role"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type anthropicErrorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewAnthropicClient(apiKey, baseURL string) *AnthropicClient {
+	trimmedBaseURL := strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if trimmedBaseURL == "" {
+		trimmedBaseURL = DefaultAnthropicBaseURL
+	}
+	return &AnthropicClient{apiKey: apiKey, baseURL: trimmedBaseURL, httpClient: &http.Client{}}
+}
+
+func (client *AnthropicClient) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
+	payload, err := toAnthropicRequest(request)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return CompletionResponse{}, fmt.Errorf("error encoding anthropic request: %w", err)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, client.baseURL+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return CompletionResponse{}, fmt.Errorf("error creating anthropic request: %w", err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("anthropic-version", anthropicAPIVersion)
+	httpRequest.Header.Set("x-api-key", client.apiKey)
+
+	httpResponse, err := client.httpClient.Do(httpRequest)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+	defer httpResponse.Body.Close()
+
+	responseBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return CompletionResponse{}, fmt.Errorf("error reading anthropic response: %w", err)
+	}
+
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		message := strings.TrimSpace(string(responseBody))
+		var errorResponse anthropicErrorResponse
+		if json.Unmarshal(responseBody, &errorResponse) == nil && errorResponse.Error.Message != "" {
+			message = errorResponse.Error.Type + ": " + errorResponse.Error.Message
+		}
+		return CompletionResponse{}, NewHTTPError("anthropic", httpResponse.StatusCode, httpResponse.Header, message)
+	}
+
+	var decoded anthropicResponse
+	if err := json.Unmarshal(responseBody, &decoded); err != nil {
+		return CompletionResponse{}, fmt.Errorf("error decoding anthropic response: %w", err)
+	}
+
+	return fromAnthropicResponse(decoded), nil
+}
+
+type anthropicModelList struct {
+	Data []struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastID  string `json:"last_id"`
+}
+
+// ListModels pages through /models. Anthropic reports neither context
+// length nor pricing, and every Claude model supports tools.
+func (client *AnthropicClient) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	models := make([]ModelInfo, 0)
+	afterID := ""
+	for {
+		endpoint := client.baseURL + "/models?limit=1000"
+		if afterID != "" {
+			endpoint += "&after_id=" + url.QueryEscape(afterID)
+		}
+		httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating anthropic request: %w", err)
+		}
+		httpRequest.Header.Set("anthropic-version", anthropicAPIVersion)
+		httpRequest.Header.Set("x-api-key", client.apiKey)
+
+		httpResponse, err := client.httpClient.Do(httpRequest)
+		if err != nil {
+			return nil, err
+		}
+		responseBody, err := io.ReadAll(httpResponse.Body)
+		httpResponse.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading anthropic response: %w", err)
+		}
+		if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+			message := strings.TrimSpace(string(responseBody))
+			var errorResponse anthropicErrorResponse
+			if json.Unmarshal(responseBody, &errorResponse) == nil && errorResponse.Error.Message != "" {
+				message = errorResponse.Error.Type + ": " + errorResponse.Error.Message
+			}
+			return nil, NewHTTPError("anthropic", httpResponse.StatusCode, httpResponse.Header, message)
+		}
+
+		var list anthropicModelList
+		if err := json.Unmarshal(responseBody, &list); err != nil {
+			return nil, fmt.Errorf("error decoding anthropic models: %w", err)
+		}
+		supportsTools := true
+		for _, model := range list.Data {
+			models = append(models, ModelInfo{ID: model.ID, Name: model.DisplayName, SupportsTools: &supportsTools})
+		}
+		if !list.HasMore || list.LastID == "" {
+			return models, nil
+		}
+		afterID = list.LastID
+	}
+}
+
+func toAnthropicRequest(request CompletionRequest) (anthropicRequest, error) {
+	messages, system, err := toAnthropicMessages(request.Messages, request.Reasoning != nil)
+	if err != nil {
+		return anthropicRequest{}, err
+	}
+
+	if request.ResponseFormat != nil {
+		system = strings.TrimSpace(system + "\n\n" + anthropicResponseFormatInstruction(request.ResponseFormat))
+	}
+
+	maxTokens := request.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+
+	payload := anthropicRequest{
+		Model:         request.Model,
+		MaxTokens:     maxTokens,
+		Messages:      messages,
+		Tools:         toAnthropicTools(request.Tools),
+		Temperature:   request.Temperature,
+		TopP:          request.TopP,
+		StopSequences: request.Stop,
+	}
+	if len(payload.Tools) > 0 {
+		payload.ToolChoice = toAnthropicToolChoice(request.ToolChoice, request.ParallelToolCalls)
+	}
+	if system != "" {
+		payload.System = []anthropicContentBlock{{Type: "text", Text: system}}
+	}
+	if request.Reasoning != nil {
+		applyAnthropicThinking(&payload, request.Reasoning)
+	}
+	if !request.DisablePromptCache {
+		markAnthropicCacheBreakpoints(&payload)
+	}
+	return payload, nil
+}
+
+// markAnthropicCacheBreakpoints caches the request prefix, which Anthropic
+// orders as tools, system prompt, then messages. Breakpoints after the tool
+// definitions and the system prompt keep those cached when history changes,
+// and one on the latest message lets the next turn read the whole history
+// from the cache. Prefixes below the model's minimum length are not cached.
+func markAnthropicCacheBreakpoints(payload *anthropicRequest) {
+	ephemeral := &anthropicCacheControl{Type: "ephemeral"}
+	if len(payload.Tools) > 0 {
+		payload.Tools[len(payload.Tools)-1].CacheControl = ephemeral
+	}
+	if len(payload.System) > 0 {
+		payload.System[len(payload.System)-1].CacheControl = ephemeral
+	}
+	if len(payload.Messages) == 0 {
+		return
+	}
+	blocks := payload.Messages[len(payload.Messages)-1].Content
+	for index := len(blocks) - 1; index >= 0; index-- {
+		block := &blocks[index]
+		if block.Type == "thinking" || block.Type == "redacted_thinking" || (block.Type == "text" && strings.TrimSpace(block.Text) == "") {
+			continue
+		}
+		block.CacheControl = ephemeral
+		return
+	}
+}
+
+// applyAnthropicThinking enables extended thinking. The budget must be at
+// least 1024 tokens and below max_tokens, and thinking rules out custom
+// sampling and forced tool use, so those settings are relaxed to fit.
+func applyAnthropicThinking(payload *anthropicRequest, reasoning *ReasoningOptions) {
+	budget := max(reasoning.Budget(), minAnthropicThinking)
+	payload.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+	if payload.MaxTokens <= budget {
+		payload.MaxTokens = budget + defaultAnthropicMaxTokens
+	}
+	payload.Temperature = nil
+	payload.TopP = nil
+	if choice := payload.ToolChoice; choice != nil && (choice.Type == "any" || choice.Type == "tool") {
+		choice.Type, choice.Name = "auto", ""
+	}
+}
+
+// anthropicResponseFormatInstruction asks for schema-shaped output in the
+// system prompt, since the Messages API has no response_format.
+func anthropicResponseFormatInstruction(format *ResponseFormat) string {
+	schema, err := json.Marshal(format.Schema)
+	if err != nil {
+		schema = []byte("{}")
+	}
+	return "When you give your final answer, reply with only a JSON document that matches this JSON Schema, with no other text:\n" + string(schema)
+}
+
+// toAnthropicToolChoice maps the tool choice onto Anthropic's auto, any,
+// tool and none types. Disabling parallel tool calls needs a tool_choice, so
+// it implies auto when no choice is set. Seed has no Anthropic equivalent.
+func toAnthropicToolChoice(choice *ToolChoice, parallelToolCalls *bool) *anthropicToolChoice {
+	disableParallel := parallelToolCalls != nil && !*parallelToolCalls
+	if choice == nil {
+		if !disableParallel {
+			return nil
+		}
+		return &anthropicToolChoice{Type: "auto", DisableParallelToolUse: true}
+	}
+
+	switch choice.Mode {
+	case ToolChoiceNone:
+		return &anthropicToolChoice{Type: "none"}
+	case ToolChoiceRequired:
+		return &anthropicToolChoice{Type: "any", DisableParallelToolUse: disableParallel}
+	case ToolChoiceTool:
+		return &anthropicToolChoice{Type: "tool", Name: choice.Name, DisableParallelToolUse: disableParallel}
+	default:
+		return &anthropicToolChoice{Type: "auto", DisableParallelToolUse: disableParallel}
+	}
+}
+
+// toAnthropicMessages hoists system messages into the top-level system prompt
+// and folds tool results into user turns, merging consecutive blocks that end
+// up with the same role as the Messages API requires. With includeThinking,
+// thinking and redacted_thinking blocks are sent back as received, which
+// Anthropic requires while thinking is enabled and a tool call is in progress.
+func toAnthropicMessages(messages []Message, includeThinking bool) ([]anthropicMessage, string, error) {
+	systemParts := make([]string, 0, 1)
+	result := make([]anthropicMessage, 0, len(messages))
+
+	appendBlocks := func(role string, blocks ...anthropicContentBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if last := len(result) - 1; last >= 0 && result[last].Role == role {
+			result[last].Content = append(result[last].Content, blocks...)
+			return
+		}
+		result = append(result, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, message := range messages {
+		switch message.Role {
+		case RoleSystem:
+			if strings.TrimSpace(message.Content) != "" {
+				systemParts = append(systemParts, message.Content)
+			}
+		case RoleUser:
+			if len(message.Parts) == 0 {
+				// The Messages API rejects empty text blocks.
+				if strings.TrimSpace(message.Content) != "" {
+					appendBlocks("user", anthropicContentBlock{Type: "text", Text: message.Content})
+				}
+				break
+			}
+			appendBlocks("user", toAnthropicContentBlocks(message.ContentParts())...)
+		case RoleAssistant:
+			blocks := make([]anthropicContentBlock, 0, len(message.ReasoningBlocks)+len(message.ToolCalls)+1)
+			if includeThinking {
+				blocks = append(blocks, toAnthropicThinkingBlocks(message.ReasoningBlocks)...)
+			}
+			if strings.TrimSpace(message.Content) != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: message.Content})
+			}
+			for _, toolCall := range message.ToolCalls {
+				input := strings.TrimSpace(toolCall.Arguments)
+				if input == "" || !json.Valid([]byte(input)) {
+					input = "{}"
+				}
+				blocks = append(blocks, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    toolCall.ID,
+					Name:  toolCall.Name,
+					Input: json.RawMessage(input),
+				})
+			}
+			appendBlocks("assistant", blocks...)
+		case RoleTool:
+			var content any = message.Content
+			if message.HasMedia() {
+				content = toAnthropicContentBlocks(message.ContentParts())
+			}
+			appendBlocks("user", anthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: message.ToolCallID,
+				Content:   content,
+			})
+		default:
+			return nil, "", fmt.Errorf("unsupported message role %q", message.Role)
+		}
+	}
+
+	return result, strings.Join(systemParts, "\n\n"), nil
+}
+
+// toAnthropicThinkingBlocks returns the blocks Anthropic can verify: signed
+// thinking and redacted thinking. Reasoning from other providers is left out.
+func toAnthropicThinkingBlocks(reasoning []ReasoningBlock) []anthropicContentBlock {
+	blocks := make([]anthropicContentBlock, 0, len(reasoning))
+	for _, block := range reasoning {
+		switch {
+		case block.Type == "thinking" && block.Signature != "":
+			blocks = append(blocks, anthropicContentBlock{Type: "thinking", Thinking: block.Text, Signature: block.Signature})
+		case block.Type == "redacted_thinking" && block.Data != "":
+			blocks = append(blocks, anthropicContentBlock{Type: "redacted_thinking", Data: block.Data})
+		}
+	}
+	return blocks
+}
+
+// toAnthropicContentBlocks maps images to image blocks and files to document
+// blocks, which Anthropic supports for PDFs and plain text.
+func toAnthropicContentBlocks(parts []ContentPart) []anthropicContentBlock {
+	blocks := make([]anthropicContentBlock, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case ContentPartImage:
+			blocks = append(blocks, anthropicContentBlock{Type: "image", Source: toAnthropicSource(part)})
+		case ContentPartFile:
+			blocks = append(blocks, anthropicContentBlock{Type: "document", Source: toAnthropicSource(part)})
+		default:
+			if strings.TrimSpace(part.Text) != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+			}
+		}
+	}
+	return blocks
+}
+
+func toAnthropicSource(part ContentPart) *anthropicSource {
+	if len(part.Data) == 0 {
+		return &anthropicSource{Type: "url", URL: part.URL}
+	}
+	return &anthropicSource{Type: "base64", MediaType: part.MediaType, Data: part.Base64()}
+}
+
+func toAnthropicTools(definitions []ToolDefinition) []anthropicTool {
+	tools := make([]anthropicTool, 0, len(definitions))
+	for _, definition := range definitions {
+		schema := map[string]any{}
+		for key, value := range definition.Parameters {
+			schema[key] = value
+		}
+		if _, ok := schema["type"]; !ok {
+			schema["type"] = "object"
+		}
+
+		tools = append(tools, anthropicTool{
+			Name:        definition.Name,
+			Description: definition.Description,
+			InputSchema: schema,
+		})
+	}
+	return tools
+}
+
+func fromAnthropicResponse(response anthropicResponse) CompletionResponse {
+	textParts := make([]string, 0, len(response.Content))
+	reasoningParts := make([]string, 0)
+	reasoningBlocks := make([]ReasoningBlock, 0)
+	toolCalls := make([]ToolCall, 0)
+	for _, block := range response.Content {
+		switch block.Type {
+		case "text":
+			textParts = append(textParts, block.Text)
+		case "thinking":
+			reasoningParts = append(reasoningParts, block.Thinking)
+			reasoningBlocks = append(reasoningBlocks, ReasoningBlock{Type: block.Type, Text: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			reasoningBlocks = append(reasoningBlocks, ReasoningBlock{Type: block.Type, Data: block.Data})
+		case "tool_use":
+			arguments := strings.TrimSpace(string(block.Input))
+			if arguments == "" {
+				arguments = "{}"
+			}
+			toolCalls = append(toolCalls, ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: arguments,
+			})
+		}
+	}
+
+	message := Message{
+		Role:      RoleAssistant,
+		Content:   strings.TrimSpace(strings.Join(textParts, "")),
+		Reasoning: strings.TrimSpace(strings.Join(reasoningParts, "\n\n")),
+		ToolCalls: toolCalls,
+	}
+	if len(reasoningBlocks) > 0 {
+		message.ReasoningBlocks = reasoningBlocks
+	}
+
+	return CompletionResponse{Choices: []Choice{{
+		FinishReason: anthropicFinishReason(response.StopReason),
+		Message:      message,
+	}}, Usage: fromAnthropicUsage(response.Usage)}
+}
+
+// fromAnthropicUsage folds cache reads and writes into PromptTokens, since
+// Anthropic reports input_tokens excluding them.
+func fromAnthropicUsage(usage anthropicUsage) Usage {
+	promptTokens := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: usage.OutputTokens,
+		CachedTokens:     usage.CacheReadInputTokens,
+		CacheWriteTokens: usage.CacheCreationInputTokens,
+		TotalTokens:      promptTokens + usage.OutputTokens,
+	}
+}
+
+// anthropicFinishReason maps stop_reason onto the OpenAI-style finish reasons
+// the agent loop already understands.
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	// pause_turn only pauses turns of server tools, which requests never
+	// include, so it ends the turn like end_turn.
+	case "end_turn", "stop_sequence", "pause_turn":
+		return "stop"
+	case "tool_use":
+		return "tool_calls"
+	case "max_tokens":
+		return "length"
+	case "refusal":
+		return "content_filter"
+	default:
+		return stopReason
+	}
+}
@@ -0,0 +1,353 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToAnthropicMessages_HoistsSystemAndGroupsToolResults(t *testing.T) {
+	messages := []Message{
+		{Role: RoleSystem, Content: "system prompt"},
+		{Role: RoleUser, Content: "user prompt"},
+		{Role: RoleAssistant, Content: "checking", ToolCalls: []ToolCall{
+			{ID: "call_1", Name: "ListDir", Arguments: "{}"},
+			{ID: "call_2", Name: "Read", Arguments: `{"file_path":"README.md"}`},
+		}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: `{"entries":[]}`},
+		{Role: RoleTool, ToolCallID: "call_2", Content: "readme"},
+		{Role: RoleAssistant, Content: "done"},
+	}
+
+	converted, system, err := toAnthropicMessages(messages, false)
+	if err != nil {
+		t.Fatalf("toAnthropicMessages returned error: %v", err)
+	}
+	if system != "system prompt" {
+		t.Fatalf("expected hoisted system prompt, got %q", system)
+	}
+	if len(converted) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(converted))
+	}
+	if converted[1].Role != "assistant" || len(converted[1].Content) != 3 {
+		t.Fatalf("expected assistant text plus two tool_use blocks, got %+v", converted[1])
+	}
+	if converted[1].Content[2].Type != "tool_use" || string(converted[1].Content[2].Input) != `{"file_path":"README.md"}` {
+		t.Fatalf("expected tool_use input preserved, got %+v", converted[1].Content[2])
+	}
+	if converted[2].Role != "user" || len(converted[2].Content) != 2 {
+		t.Fatalf("expected tool results grouped into one user message, got %+v", converted[2])
+	}
+	if converted[2].Content[1].Type != "tool_result" || converted[2].Content[1].ToolUseID != "call_2" {
+		t.Fatalf("expected tool_result for call_2, got %+v", converted[2].Content[1])
+	}
+}
+
+func TestToAnthropicMessages_SkipsEmptyTextBlocks(t *testing.T) {
+	messages := []Message{
+		{Role: RoleUser, Content: "read it"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "Read", Arguments: "{}"}}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: "{}"},
+		{Role: RoleUser, Content: ""},
+		{Role: RoleUser, Parts: []ContentPart{{Type: ContentPartText, Text: " "}}},
+	}
+
+	converted, _, err := toAnthropicMessages(messages, false)
+	if err != nil {
+		t.Fatalf("toAnthropicMessages returned error: %v", err)
+	}
+	if last := converted[len(converted)-1]; len(last.Content) != 1 || last.Content[0].Type != "tool_result" {
+		t.Fatalf("expected empty user text left out, got %+v", last)
+	}
+}
+
+func TestToAnthropicMessages_InvalidRole(t *testing.T) {
+	if _, _, err := toAnthropicMessages([]Message{{Role: Role("invalid"), Content: "x"}}, false); err == nil {
+		t.Fatal("expected error for invalid role")
+	}
+}
+
+func TestAnthropicFinishReason(t *testing.T) {
+	cases := map[string]string{
+		"end_turn":      "stop",
+		"stop_sequence": "stop",
+		"tool_use":      "tool_calls",
+		"max_tokens":    "length",
+		"refusal":       "content_filter",
+		"pause_turn":    "stop",
+	}
+	for stopReason, expected := range cases {
+		if got := anthropicFinishReason(stopReason); got != expected {
+			t.Fatalf("expected %q for stop_reason %q, got %q", expected, stopReason, got)
+		}
+	}
+}
+
+func TestAnthropicClientComplete_RoundTripsToolUse(t *testing.T) {
+	var captured anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("expected anthropic auth headers, got %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &captured); err != nil {
+			t.Errorf("failed decoding request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","role":"assistant","stop_reason":"tool_use","content":[` +
+			`{"type":"text","text":"Reading."},` +
+			`{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"README.md"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient("test-key", server.URL)
+	response, err := client.Complete(context.Background(), CompletionRequest{
+		Model:    "claude-haiku-4-5",
+		Messages: []Message{{Role: RoleSystem, Content: "system"}, {Role: RoleUser, Content: "read it"}},
+		Tools:    []ToolDefinition{{Name: "Read", Description: "Read a file"}},
+	})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+
+	if len(captured.System) != 1 || captured.System[0].Text != "system" || len(captured.Messages) != 1 {
+		t.Fatalf("expected system hoisted out of messages, got %+v", captured)
+	}
+	if len(captured.Tools) != 1 || captured.Tools[0].InputSchema["type"] != "object" {
+		t.Fatalf("expected tool input_schema defaulted to object, got %+v", captured.Tools)
+	}
+
+	choice := response.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Fatalf("expected finish reason tool_calls, got %q", choice.FinishReason)
+	}
+	if choice.Message.Content != "Reading." {
+		t.Fatalf("expected text content, got %q", choice.Message.Content)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].ID != "toolu_1" {
+		t.Fatalf("expected tool call toolu_1, got %+v", choice.Message.ToolCalls)
+	}
+	if choice.Message.ToolCalls[0].Arguments != `{"file_path":"README.md"}` {
+		t.Fatalf("expected tool arguments preserved, got %q", choice.Message.ToolCalls[0].Arguments)
+	}
+}
+
+func TestAnthropicClientComplete_ReturnsErrorOnFailureStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient("test-key", server.URL)
+	_, err := client.Complete(context.Background(), CompletionRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "x"}}})
+	if err == nil {
+		t.Fatal("expected error for failure status")
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrorKindInvalidRequest || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected invalid_request APIError, got %#v", err)
+	}
+}
+
+func TestAnthropicClientComplete_ClassifiesRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient("test-key", server.URL)
+	_, err := client.Complete(context.Background(), CompletionRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "x"}}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiErr.Kind != ErrorKindRateLimit || !apiErr.Retryable() || apiErr.RetryAfter != 7*time.Second {
+		t.Fatalf("expected retryable rate limit with 7s retry-after, got %+v", apiErr)
+	}
+}
+
+func TestToAnthropicRequest_MapsRequestOptions(t *testing.T) {
+	topP := 0.9
+	parallel := false
+	payload, err := toAnthropicRequest(CompletionRequest{
+		Model:    "m",
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+		Tools:    []ToolDefinition{{Name: "Read"}},
+		RequestOptions: RequestOptions{
+			TopP:              &topP,
+			MaxTokens:         256,
+			Stop:              []string{"END"},
+			ToolChoice:        &ToolChoice{Mode: ToolChoiceRequired},
+			ParallelToolCalls: &parallel,
+		},
+	})
+	if err != nil {
+		t.Fatalf("toAnthropicRequest returned error: %v", err)
+	}
+	if payload.MaxTokens != 256 || *payload.TopP != 0.9 || payload.StopSequences[0] != "END" {
+		t.Fatalf("expected sampling options mapped, got %+v", payload)
+	}
+	if payload.ToolChoice == nil || payload.ToolChoice.Type != "any" || !payload.ToolChoice.DisableParallelToolUse {
+		t.Fatalf("expected tool_choice any without parallel tool use, got %+v", payload.ToolChoice)
+	}
+
+	payload, _ = toAnthropicRequest(CompletionRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	if payload.MaxTokens != defaultAnthropicMaxTokens || payload.ToolChoice != nil {
+		t.Fatalf("expected defaults without options, got %+v", payload)
+	}
+}
+
+func TestToAnthropicRequest_DescribesResponseFormat(t *testing.T) {
+	payload, err := toAnthropicRequest(CompletionRequest{
+		Model: "m",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "be brief"},
+			{Role: RoleUser, Content: "hi"},
+		},
+		RequestOptions: RequestOptions{ResponseFormat: &ResponseFormat{
+			Name:   "response",
+			Schema: map[string]any{"type": "object"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("toAnthropicRequest returned error: %v", err)
+	}
+	system := payload.System[0].Text
+	if !strings.HasPrefix(system, "be brief\n\n") || !strings.HasSuffix(system, `{"type":"object"}`) {
+		t.Fatalf("expected schema instruction after the system prompt, got %q", system)
+	}
+}
+
+func TestAnthropicThinking_CapturesAndReplaysSignedReasoning(t *testing.T) {
+	response := fromAnthropicResponse(anthropicResponse{
+		Content: []anthropicContentBlock{
+			{Type: "thinking", Thinking: "need the file", Signature: "sig-1"},
+			{Type: "redacted_thinking", Data: "encrypted"},
+			{Type: "thinking", Thinking: "then read it", Signature: "sig-2"},
+			{Type: "tool_use", ID: "toolu_1", Name: "Read", Input: json.RawMessage(`{}`)},
+		},
+		StopReason: "tool_use",
+	})
+	assistant := response.Choices[0].Message
+	if assistant.Reasoning != "need the file\n\nthen read it" || len(assistant.ReasoningBlocks) != 3 {
+		t.Fatalf("expected every reasoning block captured, got %+v", assistant)
+	}
+
+	temperature := 0.5
+	request := CompletionRequest{
+		Model: "m",
+		Messages: []Message{
+			{Role: RoleUser, Content: "read it"},
+			assistant,
+			{Role: RoleTool, ToolCallID: "toolu_1", Content: "{}"},
+		},
+		Tools: []ToolDefinition{{Name: "Read"}},
+		RequestOptions: RequestOptions{
+			Temperature: &temperature,
+			ToolChoice:  &ToolChoice{Mode: ToolChoiceRequired},
+			Reasoning:   &ReasoningOptions{Effort: ReasoningEffortLow},
+		},
+	}
+	payload, err := toAnthropicRequest(request)
+	if err != nil {
+		t.Fatalf("toAnthropicRequest returned error: %v", err)
+	}
+	if payload.Thinking == nil || payload.Thinking.BudgetTokens != 1024 || payload.MaxTokens <= 1024 {
+		t.Fatalf("expected thinking budget below max tokens, got %+v", payload)
+	}
+	if payload.Temperature != nil || payload.ToolChoice.Type != "auto" {
+		t.Fatalf("expected sampling and forced tool choice relaxed, got %+v", payload)
+	}
+	blocks := payload.Messages[1].Content
+	if len(blocks) != 4 || blocks[0].Signature != "sig-1" || blocks[1].Type != "redacted_thinking" || blocks[1].Data != "encrypted" ||
+		blocks[2].Thinking != "then read it" || blocks[2].Signature != "sig-2" || blocks[3].Type != "tool_use" {
+		t.Fatalf("expected the reasoning blocks replayed in order before the tool call, got %+v", blocks)
+	}
+
+	request.Reasoning = nil
+	payload, _ = toAnthropicRequest(request)
+	if payload.Thinking != nil || payload.Messages[1].Content[0].Type != "tool_use" {
+		t.Fatalf("expected no thinking without reasoning enabled, got %+v", payload.Messages[1])
+	}
+}
+
+func TestToAnthropicRequest_MarksCacheBreakpoints(t *testing.T) {
+	request := CompletionRequest{
+		Model: "m",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "system"},
+			{Role: RoleUser, Content: "read it"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "toolu_1", Name: "Read", Arguments: "{}"}}},
+			{Role: RoleTool, ToolCallID: "toolu_1", Content: "contents"},
+		},
+		Tools: []ToolDefinition{{Name: "Read"}, {Name: "Write"}},
+	}
+	payload, err := toAnthropicRequest(request)
+	if err != nil {
+		t.Fatalf("toAnthropicRequest returned error: %v", err)
+	}
+	if payload.Tools[0].CacheControl != nil || payload.Tools[1].CacheControl == nil {
+		t.Fatalf("expected a breakpoint on the last tool only, got %+v", payload.Tools)
+	}
+	if payload.System[0].CacheControl == nil || payload.System[0].CacheControl.Type != "ephemeral" {
+		t.Fatalf("expected an ephemeral breakpoint on the system prompt, got %+v", payload.System)
+	}
+	last := payload.Messages[len(payload.Messages)-1].Content
+	if last[len(last)-1].Type != "tool_result" || last[len(last)-1].CacheControl == nil {
+		t.Fatalf("expected a breakpoint on the latest tool result, got %+v", last)
+	}
+	if payload.Messages[0].Content[0].CacheControl != nil {
+		t.Fatal("expected no breakpoint on earlier messages")
+	}
+
+	request.DisablePromptCache = true
+	payload, _ = toAnthropicRequest(request)
+	encoded, _ := json.Marshal(payload)
+	if strings.Contains(string(encoded), "cache_control") {
+		t.Fatalf("expected no cache_control when disabled, got %s", encoded)
+	}
+}
+
+func TestFromAnthropicUsage_ReportsCacheWrites(t *testing.T) {
+	usage := fromAnthropicUsage(anthropicUsage{InputTokens: 10, OutputTokens: 5, CacheCreationInputTokens: 300, CacheReadInputTokens: 700})
+	expected := Usage{PromptTokens: 1010, CompletionTokens: 5, CachedTokens: 700, CacheWriteTokens: 300, TotalTokens: 1015}
+	if usage != expected {
+		t.Fatalf("expected %+v, got %+v", expected, usage)
+	}
+}
+
+func TestAnthropicClientListModels_Paginates(t *testing.T) {
+	pages := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		if r.Header.Get("x-api-key") != "test-key" {
+			t.Errorf("expected api key header")
+		}
+		if r.URL.Query().Get("after_id") == "" {
+			_, _ = w.Write([]byte(`{"data":[{"id":"claude-sonnet-4-5","display_name":"Claude Sonnet 4.5"}],"has_more":true,"last_id":"claude-sonnet-4-5"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[{"id":"claude-haiku-4-5","display_name":"Claude Haiku 4.5"}],"has_more":false}`))
+	}))
+	defer server.Close()
+
+	models, err := NewAnthropicClient("test-key", server.URL).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels returned error: %v", err)
+	}
+	if pages != 2 || len(models) != 2 || models[1].ID != "claude-haiku-4-5" || models[1].SupportsTools == nil || !*models[1].SupportsTools {
+		t.Fatalf("unexpected models after %d pages: %+v", pages, models)
+	}
+}
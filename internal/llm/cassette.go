@@ -0,0 +1,252 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const cassetteVersion = 1
+
+// ErrCassetteMismatch is returned by a ReplayClient when a request was not
+// recorded, i.e. the run diverged from the recording.
+var ErrCassetteMismatch = errors.New("cassette mismatch")
+
+// Cassette is a recording of LLM interactions in the order they happened.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	CorrelationID string             `json:"correlation_id,omitempty"`
+	RequestHash   string             `json:"request_hash"`
+	Request       CompletionRequest  `json:"request"`
+	Response      CompletionResponse `json:"response"`
+	Error         *RecordedError     `json:"error,omitempty"`
+}
+
+// RecordedError keeps enough of an APIError to replay the failure.
+type RecordedError struct {
+	Kind       ErrorKind `json:"kind"`
+	Provider   string    `json:"provider,omitempty"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Message    string    `json:"message"`
+}
+
+// HashRequest fingerprints a request by its JSON encoding. Map keys are
+// encoded in sorted order, so equal requests always hash alike.
+func HashRequest(request CompletionRequest) (string, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("error hashing request: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func LoadCassette(path string) (Cassette, error) {
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		return Cassette{}, fmt.Errorf("failed reading cassette %q: %w", path, err)
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(payload, &cassette); err != nil {
+		return Cassette{}, fmt.Errorf("failed decoding cassette %q: %w", path, err)
+	}
+	if cassette.Version != cassetteVersion {
+		return Cassette{}, fmt.Errorf("unsupported cassette version %d in %q", cassette.Version, path)
+	}
+	return cassette, nil
+}
+
+// Save writes the cassette through a temporary file so an interrupted run
+// never leaves a truncated recording behind.
+func (cassette Cassette) Save(path string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("failed creating cassette directory: %w", err)
+		}
+	}
+	payload, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding cassette: %w", err)
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, payload, 0o600); err != nil {
+		return fmt.Errorf("failed writing cassette: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("failed writing cassette: %w", err)
+	}
+	return nil
+}
+
+// RecordingClient passes requests through to client and appends every
+// request/response pair, including classified provider errors, to a
+// cassette file that is rewritten after each interaction.
+type RecordingClient struct {
+	client Client
+	path   string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+func NewRecordingClient(client Client, path string) *RecordingClient {
+	return &RecordingClient{client: client, path: path, cassette: Cassette{Version: cassetteVersion}}
+}
+
+func (client *RecordingClient) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
+	response, err := client.client.Complete(ctx, request)
+	return client.record(ctx, request, response, err)
+}
+
+func (client *RecordingClient) CompleteStream(ctx context.Context, request CompletionRequest, onDelta StreamHandler) (CompletionResponse, error) {
+	streamingClient, ok := client.client.(StreamingClient)
+	if !ok {
+		return client.Complete(ctx, request)
+	}
+	response, err := streamingClient.CompleteStream(ctx, request, onDelta)
+	return client.record(ctx, request, response, err)
+}
+
+func (client *RecordingClient) record(ctx context.Context, request CompletionRequest, response CompletionResponse, err error) (CompletionResponse, error) {
+	interaction := Interaction{CorrelationID: CorrelationID(ctx), Request: request}
+	if err != nil {
+		apiErr := ClassifyError(err)
+		if apiErr == nil {
+			return response, err
+		}
+		interaction.Error = &RecordedError{
+			Kind:       apiErr.Kind,
+			Provider:   apiErr.Provider,
+			StatusCode: apiErr.StatusCode,
+			Message:    apiErr.Message,
+		}
+	} else {
+		interaction.Response = response
+	}
+
+	hash, hashErr := HashRequest(request)
+	if hashErr != nil {
+		return CompletionResponse{}, hashErr
+	}
+	interaction.RequestHash = hash
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.cassette.Interactions = append(client.cassette.Interactions, interaction)
+	if saveErr := client.cassette.Save(client.path); saveErr != nil {
+		return CompletionResponse{}, saveErr
+	}
+	return response, err
+}
+
+// ReplayClient serves responses from a cassette instead of calling a
+// provider. Requests are matched by hash, each recorded interaction is used
+// once, and an unrecorded request fails with ErrCassetteMismatch.
+type ReplayClient struct {
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+func NewReplayClient(path string) (*ReplayClient, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayClient{cassette: cassette, used: make([]bool, len(cassette.Interactions))}, nil
+}
+
+func (client *ReplayClient) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
+	hash, err := HashRequest(request)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	for index, interaction := range client.cassette.Interactions {
+		if client.used[index] || interaction.RequestHash != hash {
+			continue
+		}
+		client.used[index] = true
+		if interaction.Error != nil {
+			return CompletionResponse{}, &APIError{
+				Kind:       interaction.Error.Kind,
+				Provider:   interaction.Error.Provider,
+				StatusCode: interaction.Error.StatusCode,
+				Message:    interaction.Error.Message,
+			}
+		}
+		return interaction.Response, nil
+	}
+
+	return CompletionResponse{}, fmt.Errorf("%w: no recorded response for request %s (model=%s messages=%d, %d of %d interactions used)",
+		ErrCassetteMismatch, hash[:12], request.Model, len(request.Messages), client.usedCount(), len(client.used))
+}
+
+// CompleteStream replays the recorded response as a single delta.
+func (client *ReplayClient) CompleteStream(ctx context.Context, request CompletionRequest, onDelta StreamHandler) (CompletionResponse, error) {
+	response, err := client.Complete(ctx, request)
+	if err != nil || onDelta == nil || len(response.Choices) == 0 {
+		return response, err
+	}
+
+	message := response.Choices[0].Message
+	delta := StreamDelta{Content: message.Content}
+	for index, toolCall := range message.ToolCalls {
+		delta.ToolCalls = append(delta.ToolCalls, ToolCallDelta{Index: index, ID: toolCall.ID, Name: toolCall.Name, Arguments: toolCall.Arguments})
+	}
+	if delta.Content != "" || len(delta.ToolCalls) > 0 {
+		onDelta(delta)
+	}
+	return response, nil
+}
+
+// Model returns the model of the first recorded request.
+func (client *ReplayClient) Model() string {
+	if len(client.cassette.Interactions) == 0 {
+		return ""
+	}
+	return client.cassette.Interactions[0].Request.Model
+}
+
+// SystemPrompt returns the leading system message of the first recorded
+// request, so a replayed session can start from the same prompt even though
+// it embeds the date it was recorded on.
+func (client *ReplayClient) SystemPrompt() (string, bool) {
+	if len(client.cassette.Interactions) == 0 {
+		return "", false
+	}
+	messages := client.cassette.Interactions[0].Request.Messages
+	if len(messages) == 0 || messages[0].Role != RoleSystem {
+		return "", false
+	}
+	return messages[0].Content, true
+}
+
+// Remaining reports how many recorded interactions have not been replayed.
+func (client *ReplayClient) Remaining() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return len(client.used) - client.usedCount()
+}
+
+func (client *ReplayClient) usedCount() int {
+	count := 0
+	for _, used := range client.used {
+		if used {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestCassette_RecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "run.json")
+	first := CompletionRequest{Model: "m", Messages: []Message{{Role: RoleSystem, Content: "sys"}, {Role: RoleUser, Content: "hi"}}}
+	second := CompletionRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "again"}}}
+
+	recorder := NewRecordingClient(&recordingClient{}, path)
+	ctx := WithCorrelationID(context.Background(), "corr-1")
+	recorded, err := recorder.Complete(ctx, first)
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	if _, err := recorder.Complete(ctx, second); err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette returned error: %v", err)
+	}
+	if len(cassette.Interactions) != 2 || cassette.Interactions[0].CorrelationID != "corr-1" {
+		t.Fatalf("expected two interactions tagged with the correlation id, got %+v", cassette.Interactions)
+	}
+
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatalf("NewReplayClient returned error: %v", err)
+	}
+	if replay.Model() != "m" {
+		t.Fatalf("expected recorded model m, got %q", replay.Model())
+	}
+	if prompt, ok := replay.SystemPrompt(); !ok || prompt != "sys" {
+		t.Fatalf("expected recorded system prompt, got %q ok=%t", prompt, ok)
+	}
+
+	streamed := ""
+	replayed, err := replay.CompleteStream(context.Background(), first, func(delta StreamDelta) { streamed += delta.Content })
+	if err != nil {
+		t.Fatalf("CompleteStream returned error: %v", err)
+	}
+	if replayed.Choices[0].Message.Content != recorded.Choices[0].Message.Content || streamed != "m" {
+		t.Fatalf("expected recorded response replayed, got %+v streamed=%q", replayed, streamed)
+	}
+	if replay.Remaining() != 1 {
+		t.Fatalf("expected one interaction left, got %d", replay.Remaining())
+	}
+
+	if _, err := replay.Complete(context.Background(), first); !errors.Is(err, ErrCassetteMismatch) {
+		t.Fatalf("expected mismatch once the interaction is used up, got %v", err)
+	}
+	diverged := CompletionRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "different"}}}
+	if _, err := replay.Complete(context.Background(), diverged); !errors.Is(err, ErrCassetteMismatch) {
+		t.Fatalf("expected mismatch for unrecorded request, got %v", err)
+	}
+}
+
+func TestCassette_ReplaysRecordedProviderErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.json")
+	request := CompletionRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+
+	recorder := NewRecordingClient(&recordingClient{err: NewHTTPError("anthropic", http.StatusTooManyRequests, nil, "slow down")}, path)
+	if _, err := recorder.Complete(context.Background(), request); err == nil {
+		t.Fatal("expected recorded client to pass the error through")
+	}
+
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatalf("NewReplayClient returned error: %v", err)
+	}
+	_, err = replay.Complete(context.Background(), request)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrorKindRateLimit || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected replayed rate limit error, got %v", err)
+	}
+}
+
+func TestHashRequest_IsStableAcrossParameterMapOrder(t *testing.T) {
+	first := CompletionRequest{Model: "m", Tools: []ToolDefinition{{Name: "Read", Parameters: map[string]any{"type": "object", "properties": map[string]any{"a": 1, "b": 2}}}}}
+	second := CompletionRequest{Model: "m", Tools: []ToolDefinition{{Name: "Read", Parameters: map[string]any{"properties": map[string]any{"b": 2, "a": 1}, "type": "object"}}}}
+
+	firstHash, err := HashRequest(first)
+	if err != nil {
+		t.Fatalf("HashRequest returned error: %v", err)
+	}
+	secondHash, _ := HashRequest(second)
+	if firstHash != secondHash {
+		t.Fatalf("expected equal hashes, got %s and %s", firstHash, secondHash)
+	}
+}
@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+type ContentPartType string
+
+const (
+	ContentPartText  ContentPartType = "text"
+	ContentPartImage ContentPartType = "image"
+	ContentPartFile  ContentPartType = "file"
+)
+
+// ContentPart is one typed piece of message content. Images and files carry
+// either inline Data (with MediaType) or a URL, which may be a data URL.
+type ContentPart struct {
+	Type      ContentPartType `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	MediaType string          `json:"media_type,omitempty"`
+	Data      []byte          `json:"data,omitempty"`
+	URL       string          `json:"url,omitempty"`
+	Filename  string          `json:"filename,omitempty"`
+}
+
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: ContentPartText, Text: text}
+}
+
+func ImagePart(mediaType string, data []byte) ContentPart {
+	return ContentPart{Type: ContentPartImage, MediaType: mediaType, Data: data}
+}
+
+// ImageURLPart references an image by URL. Data URLs are decoded into inline
+// data so every adapter can send them.
+func ImageURLPart(url string) ContentPart {
+	if mediaType, data, ok := parseDataURL(url); ok {
+		return ImagePart(mediaType, data)
+	}
+	return ContentPart{Type: ContentPartImage, URL: url}
+}
+
+func FilePart(filename, mediaType string, data []byte) ContentPart {
+	return ContentPart{Type: ContentPartFile, Filename: filename, MediaType: mediaType, Data: data}
+}
+
+// DataURL returns the part as a data URL, or its URL when it has no inline
+// data.
+func (part ContentPart) DataURL() string {
+	if len(part.Data) == 0 {
+		return part.URL
+	}
+	return "data:" + part.MediaType + ";base64," + part.Base64()
+}
+
+func (part ContentPart) Base64() string {
+	return base64.StdEncoding.EncodeToString(part.Data)
+}
+
+// ContentParts returns the message content as parts: Content, when set, as a
+// leading text part followed by Parts.
+func (message Message) ContentParts() []ContentPart {
+	parts := make([]ContentPart, 0, len(message.Parts)+1)
+	if message.Content != "" {
+		parts = append(parts, TextPart(message.Content))
+	}
+	return append(parts, message.Parts...)
+}
+
+// HasMedia reports whether the message carries image or file parts.
+func (message Message) HasMedia() bool {
+	for _, part := range message.Parts {
+		if part.Type != ContentPartText {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDataURL(url string) (string, []byte, bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", nil, false
+	}
+	header, payload, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", nil, false
+	}
+	mediaType, isBase64 := strings.CutSuffix(header, ";base64")
+	if !isBase64 {
+		return "", nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, false
+	}
+	return mediaType, data, true
+}
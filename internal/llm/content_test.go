@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestImageURLPart_DecodesDataURLs(t *testing.T) {
+	part := ImageURLPart("data:image/png;base64,aGk=")
+	if part.MediaType != "image/png" || string(part.Data) != "hi" || part.URL != "" {
+		t.Fatalf("expected inline png data, got %+v", part)
+	}
+	if part.DataURL() != "data:image/png;base64,aGk=" {
+		t.Fatalf("expected data url round trip, got %q", part.DataURL())
+	}
+
+	remote := ImageURLPart("https://example.com/a.png")
+	if remote.URL != "https://example.com/a.png" || len(remote.Data) != 0 || remote.DataURL() != remote.URL {
+		t.Fatalf("expected remote url kept, got %+v", remote)
+	}
+}
+
+func TestMessage_LegacyStringContentStillDecodes(t *testing.T) {
+	var message Message
+	if err := json.Unmarshal([]byte(`{"role":"user","content":"hello"}`), &message); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	parts := message.ContentParts()
+	if len(parts) != 1 || parts[0].Type != ContentPartText || parts[0].Text != "hello" || message.HasMedia() {
+		t.Fatalf("expected single text part, got %+v", parts)
+	}
+
+	withImage := Message{Role: RoleUser, Content: "look", Parts: []ContentPart{ImagePart("image/png", []byte("png"))}}
+	payload, err := json.Marshal(withImage)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !decoded.HasMedia() || string(decoded.Parts[0].Data) != "png" {
+		t.Fatalf("expected image part round trip, got %+v", decoded)
+	}
+}
+
+func TestToAnthropicMessages_MapsContentParts(t *testing.T) {
+	converted, _, err := toAnthropicMessages([]Message{
+		{Role: RoleUser, Content: "what is this?", Parts: []ContentPart{ImagePart("image/png", []byte("png"))}},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "Read", Arguments: `{"file_path":"a.pdf"}`}}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: `{"ok":true}`, Parts: []ContentPart{FilePart("a.pdf", "application/pdf", []byte("pdf"))}},
+	}, false)
+	if err != nil {
+		t.Fatalf("toAnthropicMessages returned error: %v", err)
+	}
+
+	userBlocks := converted[0].Content
+	if len(userBlocks) != 2 || userBlocks[1].Type != "image" || userBlocks[1].Source.Type != "base64" || userBlocks[1].Source.Data != "cG5n" {
+		t.Fatalf("expected text and base64 image blocks, got %+v", userBlocks)
+	}
+	toolResult := converted[2].Content[0]
+	nested, ok := toolResult.Content.([]anthropicContentBlock)
+	if !ok || len(nested) != 2 || nested[1].Type != "document" || nested[1].Source.MediaType != "application/pdf" {
+		t.Fatalf("expected tool_result with document block, got %+v", toolResult.Content)
+	}
+}
+
+func TestToOllamaMessages_SendsInlineImages(t *testing.T) {
+	converted, err := toOllamaMessages([]Message{
+		{Role: RoleUser, Content: "describe", Parts: []ContentPart{ImagePart("image/png", []byte("png")), FilePart("a.pdf", "application/pdf", []byte("pdf"))}},
+	})
+	if err != nil {
+		t.Fatalf("toOllamaMessages returned error: %v", err)
+	}
+	if len(converted[0].Images) != 1 || converted[0].Images[0] != "cG5n" {
+		t.Fatalf("expected base64 image, got %+v", converted[0])
+	}
+	if converted[0].Content == "describe" {
+		t.Fatalf("expected unsupported file to be described in text, got %q", converted[0].Content)
+	}
+}
@@ -0,0 +1,17 @@
+package llm
+
+import "context"
+
+type correlationIDKey struct{}
+
+// WithCorrelationID attaches the agent's correlation id to ctx so clients can
+// tie provider requests back to the prompt that caused them.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// CorrelationID returns the correlation id attached to ctx, if any.
+func CorrelationID(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
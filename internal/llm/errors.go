@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ErrorKind string
+
+const (
+	ErrorKindRateLimit      ErrorKind = "rate_limit"
+	ErrorKindOverloaded     ErrorKind = "overloaded"
+	ErrorKindAuth           ErrorKind = "auth"
+	ErrorKindContextLength  ErrorKind = "context_length"
+	ErrorKindInvalidRequest ErrorKind = "invalid_request"
+	ErrorKindTransport      ErrorKind = "transport"
+	ErrorKindUnknown        ErrorKind = "unknown"
+)
+
+// APIError is a provider failure classified into an ErrorKind. Adapters return
+// it for non-2xx responses so callers can decide whether to retry, fall back
+// or explain the failure to the user.
+type APIError struct {
+	Kind       ErrorKind
+	Provider   string
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (err *APIError) Error() string {
+	if err.StatusCode > 0 {
+		return fmt.Sprintf("%s request failed (%s, status %d): %s", err.Provider, err.Kind, err.StatusCode, err.Message)
+	}
+	return fmt.Sprintf("%s request failed (%s): %s", err.Provider, err.Kind, err.Message)
+}
+
+func (err *APIError) Unwrap() error {
+	return err.Err
+}
+
+// Retryable reports whether the same request may succeed if sent again.
+func (err *APIError) Retryable() bool {
+	switch err.Kind {
+	case ErrorKindRateLimit, ErrorKindOverloaded, ErrorKindTransport:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewHTTPError classifies a failed HTTP response from provider.
+func NewHTTPError(provider string, statusCode int, header http.Header, message string) *APIError {
+	return &APIError{
+		Kind:       classifyStatus(statusCode, message),
+		Provider:   provider,
+		StatusCode: statusCode,
+		Message:    strings.TrimSpace(message),
+		RetryAfter: parseRetryAfter(header, time.Now()),
+	}
+}
+
+// ClassifyError returns err as an *APIError. Errors that already are one are
+// returned unchanged, network failures are classified as transport errors and
+// anything else is unknown. Context cancellation is not classified and yields
+// nil, so callers stop instead of retrying.
+func ClassifyError(err error) *APIError {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return &APIError{Kind: ErrorKindTransport, Message: err.Error(), Err: err}
+	}
+
+	return &APIError{Kind: ErrorKindUnknown, Message: err.Error(), Err: err}
+}
+
+func classifyStatus(statusCode int, message string) ErrorKind {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden || statusCode == http.StatusPaymentRequired:
+		return ErrorKindAuth
+	case statusCode == http.StatusRequestEntityTooLarge || isContextLengthMessage(message):
+		return ErrorKindContextLength
+	case statusCode == http.StatusRequestTimeout || statusCode == 529 || statusCode >= 500:
+		return ErrorKindOverloaded
+	case statusCode >= 400:
+		return ErrorKindInvalidRequest
+	default:
+		return ErrorKindUnknown
+	}
+}
+
+func isContextLengthMessage(message string) bool {
+	lowered := strings.ToLower(message)
+	for _, marker := range []string{"context length", "context_length", "context window", "maximum context", "prompt is too long", "too many tokens"} {
+		if strings.Contains(lowered, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter understands retry-after-ms as well as Retry-After in
+// seconds or as an HTTP date.
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if header == nil {
+		return 0
+	}
+	if raw := strings.TrimSpace(header.Get("Retry-After-Ms")); raw != "" {
+		if millis, err := strconv.ParseFloat(raw, 64); err == nil && millis > 0 {
+			return time.Duration(millis * float64(time.Millisecond))
+		}
+	}
+	raw := strings.TrimSpace(header.Get("Retry-After"))
+	if raw == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(raw); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
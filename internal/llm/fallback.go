@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"context"
+	"errors"
+)
+
+// Route is one provider/model pair a FallbackClient may send requests to.
+type Route struct {
+	Provider string
+	Model    string
+	Client   Client
+}
+
+// FallbackClient tries its routes in order, moving on to the next one when a
+// route fails with a classified provider error such as a rate limit, an
+// outage or a rejected model. Routes are usually RetryingClients, so a route
+// is only abandoned once its own retries are spent.
+type FallbackClient struct {
+	routes []Route
+	logger RetryLogger
+}
+
+func NewFallbackClient(routes []Route, logger RetryLogger) *FallbackClient {
+	return &FallbackClient{routes: routes, logger: logger}
+}
+
+func (client *FallbackClient) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
+	return client.do(ctx, request, func(route Route, routed CompletionRequest) (CompletionResponse, bool, error) {
+		response, err := route.Client.Complete(ctx, routed)
+		return response, false, err
+	})
+}
+
+// CompleteStream falls over only while nothing has been streamed yet.
+func (client *FallbackClient) CompleteStream(ctx context.Context, request CompletionRequest, onDelta StreamHandler) (CompletionResponse, error) {
+	return client.do(ctx, request, func(route Route, routed CompletionRequest) (CompletionResponse, bool, error) {
+		streamingClient, ok := route.Client.(StreamingClient)
+		if !ok {
+			response, err := route.Client.Complete(ctx, routed)
+			return response, false, err
+		}
+		streamed := false
+		response, err := streamingClient.CompleteStream(ctx, routed, func(delta StreamDelta) {
+			streamed = true
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		})
+		return response, streamed, err
+	})
+}
+
+func (client *FallbackClient) do(ctx context.Context, request CompletionRequest, attempt func(route Route, routed CompletionRequest) (CompletionResponse, bool, error)) (CompletionResponse, error) {
+	if len(client.routes) == 0 {
+		return CompletionResponse{}, errors.New("fallback client has no routes")
+	}
+
+	var lastErr error
+	for index, route := range client.routes {
+		routed := request
+		if route.Model != "" {
+			routed.Model = route.Model
+		}
+
+		response, streamed, err := attempt(route, routed)
+		if err == nil {
+			if response.Provider == "" {
+				response.Provider = route.Provider
+			}
+			if response.Model == "" {
+				response.Model = routed.Model
+			}
+			return response, nil
+		}
+		lastErr = err
+
+		apiErr := ClassifyError(err)
+		if apiErr == nil || apiErr.Kind == ErrorKindUnknown || streamed || index == len(client.routes)-1 {
+			return CompletionResponse{}, err
+		}
+
+		next := client.routes[index+1]
+		if client.logger != nil {
+			client.logger.Warnf("event=llm_fallback from_provider=%s from_model=%s to_provider=%s to_model=%s kind=%s status=%d",
+				route.Provider, routed.Model, next.Provider, next.Model, apiErr.Kind, apiErr.StatusCode)
+		}
+	}
+	return CompletionResponse{}, lastErr
+}
+
+type TurnKind string
+
+const (
+	// TurnKindUser is a request answering a new user message.
+	TurnKindUser TurnKind = "user"
+	// TurnKindToolResults is a request whose newest messages are tool results.
+	TurnKindToolResults TurnKind = "tool_results"
+)
+
+// ClassifyTurn reports what the request is answering, judged by its last
+// message that is not a Note.
+func ClassifyTurn(request CompletionRequest) TurnKind {
+	for index := len(request.Messages) - 1; index >= 0; index-- {
+		if request.Messages[index].Note {
+			continue
+		}
+		if request.Messages[index].Role == RoleTool {
+			return TurnKindToolResults
+		}
+		break
+	}
+	return TurnKindUser
+}
+
+// Router sends each request to the client registered for its TurnKind and to
+// the default client otherwise, e.g. a cheaper model for turns that only
+// carry tool results.
+type Router struct {
+	defaultClient Client
+	rules         map[TurnKind]Client
+}
+
+func NewRouter(defaultClient Client, rules map[TurnKind]Client) *Router {
+	return &Router{defaultClient: defaultClient, rules: rules}
+}
+
+func (router *Router) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
+	return router.route(request).Complete(ctx, request)
+}
+
+func (router *Router) CompleteStream(ctx context.Context, request CompletionRequest, onDelta StreamHandler) (CompletionResponse, error) {
+	client := router.route(request)
+	if streamingClient, ok := client.(StreamingClient); ok {
+		return streamingClient.CompleteStream(ctx, request, onDelta)
+	}
+	return client.Complete(ctx, request)
+}
+
+func (router *Router) route(request CompletionRequest) Client {
+	if client, ok := router.rules[ClassifyTurn(request)]; ok && client != nil {
+		return client
+	}
+	return router.defaultClient
+}
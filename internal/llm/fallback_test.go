@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type recordingClient struct {
+	err    error
+	models []string
+}
+
+func (client *recordingClient) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
+	client.models = append(client.models, request.Model)
+	if client.err != nil {
+		return CompletionResponse{}, client.err
+	}
+	return CompletionResponse{Choices: []Choice{{FinishReason: "stop", Message: Message{Role: RoleAssistant, Content: request.Model}}}}, nil
+}
+
+func TestFallbackClient_FallsOverOnClassifiedErrors(t *testing.T) {
+	primary := &recordingClient{err: NewHTTPError("openrouter", http.StatusTooManyRequests, nil, "slow down")}
+	secondary := &recordingClient{err: NewHTTPError("anthropic", http.StatusServiceUnavailable, nil, "down")}
+	tertiary := &recordingClient{}
+	logger := &recordingRetryLogger{}
+	client := NewFallbackClient([]Route{
+		{Provider: "openrouter", Model: "big", Client: primary},
+		{Provider: "anthropic", Model: "medium", Client: secondary},
+		{Provider: "ollama", Model: "local", Client: tertiary},
+	}, logger)
+
+	response, err := client.Complete(context.Background(), CompletionRequest{Model: "ignored"})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	if response.Provider != "ollama" || response.Model != "local" {
+		t.Fatalf("expected response served by ollama/local, got %s/%s", response.Provider, response.Model)
+	}
+	if len(primary.models) != 1 || primary.models[0] != "big" || tertiary.models[0] != "local" {
+		t.Fatalf("expected each route to receive its own model, got %v %v %v", primary.models, secondary.models, tertiary.models)
+	}
+	if len(logger.lines) != 2 || !strings.Contains(logger.lines[0], "event=llm_fallback") || !strings.Contains(logger.lines[0], "to_provider=anthropic") {
+		t.Fatalf("expected two llm_fallback events, got %v", logger.lines)
+	}
+}
+
+func TestFallbackClient_StopsOnUnclassifiedErrorsAndReturnsLastError(t *testing.T) {
+	local := errors.New("encoding failed")
+	secondary := &recordingClient{}
+	client := NewFallbackClient([]Route{
+		{Provider: "a", Model: "m1", Client: &recordingClient{err: local}},
+		{Provider: "b", Model: "m2", Client: secondary},
+	}, nil)
+	if _, err := client.Complete(context.Background(), CompletionRequest{}); !errors.Is(err, local) || len(secondary.models) != 0 {
+		t.Fatalf("expected unclassified error without fallback, got %v", err)
+	}
+
+	last := NewHTTPError("b", http.StatusUnauthorized, nil, "bad key")
+	client = NewFallbackClient([]Route{
+		{Provider: "a", Model: "m1", Client: &recordingClient{err: NewHTTPError("a", 529, nil, "busy")}},
+		{Provider: "b", Model: "m2", Client: &recordingClient{err: last}},
+	}, nil)
+	if _, err := client.Complete(context.Background(), CompletionRequest{}); !errors.Is(err, last) {
+		t.Fatalf("expected error from last route, got %v", err)
+	}
+}
+
+func TestRouter_RoutesByTurnKind(t *testing.T) {
+	strong := &recordingClient{}
+	cheap := &recordingClient{}
+	router := NewRouter(strong, map[TurnKind]Client{TurnKindToolResults: cheap})
+
+	userRequest := CompletionRequest{Model: "strong", Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+	toolRequest := CompletionRequest{Model: "strong", Messages: []Message{
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "Read"}}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: "{}"},
+	}}
+
+	if _, err := router.Complete(context.Background(), userRequest); err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	if _, err := router.Complete(context.Background(), toolRequest); err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	if len(strong.models) != 1 || len(cheap.models) != 1 {
+		t.Fatalf("expected one request per client, got strong=%d cheap=%d", len(strong.models), len(cheap.models))
+	}
+
+	toolRequest.Messages = append(toolRequest.Messages, Message{Role: RoleUser, Content: "System note: todo", Note: true})
+	if kind := ClassifyTurn(toolRequest); kind != TurnKindToolResults {
+		t.Fatalf("expected a trailing note to be looked past, got %s", kind)
+	}
+}
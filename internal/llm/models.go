@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ModelInfo describes one model offered by a provider. Fields the provider
+// does not report are left zero, and SupportsTools is nil when tool support
+// is unknown.
+type ModelInfo struct {
+	ID            string      `json:"id"`
+	Name          string      `json:"name,omitempty"`
+	ContextLength int         `json:"context_length,omitempty"`
+	Pricing       *ModelPrice `json:"pricing,omitempty"`
+	SupportsTools *bool       `json:"supports_tools,omitempty"`
+}
+
+// ModelLister is implemented by clients that can list the models their
+// provider serves.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
+
+// perTokenToPerMillion converts a USD-per-token price string, as OpenRouter
+// reports it, to USD per million tokens.
+func perTokenToPerMillion(value string) float64 {
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || parsed < 0 {
+		return 0
+	}
+	// Round away float noise such as 0.15000000000000002.
+	return math.Round(parsed*1e12) / 1e6
+}
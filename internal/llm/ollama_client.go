@@ -0,0 +1,414 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultOllamaBaseURL = "http://localhost:11434"
+
+type OllamaClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []ollamaTool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Format   map[string]any  `json:"format,omitempty"`
+	Think    bool            `json:"think,omitempty"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+// ollamaMessage.Thinking is only read from responses; reasoning is not sent
+// back to Ollama.
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	ID       string `json:"id,omitempty"`
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     string             `json:"type"`
+	Function ollamaToolFunction `json:"function"`
+}
+
+type ollamaToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+// NewOllamaClient talks to the native Ollama /api/chat endpoint. apiKey is
+// optional and only needed for hosted Ollama deployments.
+func NewOllamaClient(apiKey, baseURL string) *OllamaClient {
+	trimmedBaseURL := strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if trimmedBaseURL == "" {
+		trimmedBaseURL = DefaultOllamaBaseURL
+	}
+	return &OllamaClient{apiKey: strings.TrimSpace(apiKey), baseURL: trimmedBaseURL, httpClient: &http.Client{}}
+}
+
+func (client *OllamaClient) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
+	messages, err := toOllamaMessages(request.Messages)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+
+	payload := ollamaChatRequest{
+		Model:    request.Model,
+		Messages: messages,
+		Tools:    toOllamaTools(selectOllamaTools(request.Tools, request.ToolChoice)),
+		Stream:   false,
+		Think:    request.Reasoning != nil,
+		Options:  toOllamaOptions(request.RequestOptions),
+	}
+	if request.ResponseFormat != nil {
+		payload.Format = request.ResponseFormat.Schema
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return CompletionResponse{}, fmt.Errorf("error encoding ollama request: %w", err)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, client.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return CompletionResponse{}, fmt.Errorf("error creating ollama request: %w", err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if client.apiKey != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+client.apiKey)
+	}
+
+	httpResponse, err := client.httpClient.Do(httpRequest)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+	defer httpResponse.Body.Close()
+
+	responseBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return CompletionResponse{}, fmt.Errorf("error reading ollama response: %w", err)
+	}
+
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		message := strings.TrimSpace(string(responseBody))
+		var errorResponse struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(responseBody, &errorResponse) == nil && errorResponse.Error != "" {
+			message = errorResponse.Error
+		}
+		return CompletionResponse{}, NewHTTPError("ollama", httpResponse.StatusCode, httpResponse.Header, message)
+	}
+
+	var decoded ollamaChatResponse
+	if err := json.Unmarshal(responseBody, &decoded); err != nil {
+		return CompletionResponse{}, fmt.Errorf("error decoding ollama response: %w", err)
+	}
+
+	return fromOllamaResponse(decoded), nil
+}
+
+type ollamaTagList struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+type ollamaShowResponse struct {
+	Capabilities []string       `json:"capabilities"`
+	ModelInfo    map[string]any `json:"model_info"`
+}
+
+// ListModels lists the locally available models from /api/tags and asks
+// /api/show for each one's capabilities and context length. Models whose
+// details cannot be read are still listed, with unknown capabilities.
+func (client *OllamaClient) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var tags ollamaTagList
+	if err := client.doJSON(ctx, http.MethodGet, "/api/tags", nil, &tags); err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		info := ModelInfo{ID: model.Name}
+		var details ollamaShowResponse
+		if err := client.doJSON(ctx, http.MethodPost, "/api/show", map[string]string{"model": model.Name}, &details); err == nil {
+			info.ContextLength = ollamaContextLength(details.ModelInfo)
+			if details.Capabilities != nil {
+				supportsTools := false
+				for _, capability := range details.Capabilities {
+					if capability == "tools" {
+						supportsTools = true
+					}
+				}
+				info.SupportsTools = &supportsTools
+			}
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// ollamaContextLength reads "<architecture>.context_length" from model_info.
+func ollamaContextLength(modelInfo map[string]any) int {
+	for key, value := range modelInfo {
+		if length, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			return int(length)
+		}
+	}
+	return 0
+}
+
+func (client *OllamaClient) doJSON(ctx context.Context, method, path string, payload any, out any) error {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("error encoding ollama request: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, method, client.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating ollama request: %w", err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if client.apiKey != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+client.apiKey)
+	}
+
+	httpResponse, err := client.httpClient.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	responseBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return fmt.Errorf("error reading ollama response: %w", err)
+	}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		message := strings.TrimSpace(string(responseBody))
+		var errorResponse struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(responseBody, &errorResponse) == nil && errorResponse.Error != "" {
+			message = errorResponse.Error
+		}
+		return NewHTTPError("ollama", httpResponse.StatusCode, httpResponse.Header, message)
+	}
+	if err := json.Unmarshal(responseBody, out); err != nil {
+		return fmt.Errorf("error decoding ollama response: %w", err)
+	}
+	return nil
+}
+
+func toOllamaMessages(messages []Message) ([]ollamaMessage, error) {
+	toolNames := map[string]string{}
+	result := make([]ollamaMessage, 0, len(messages))
+	for _, message := range messages {
+		switch message.Role {
+		case RoleSystem, RoleUser:
+			content, images := toOllamaContent(message)
+			result = append(result, ollamaMessage{Role: string(message.Role), Content: content, Images: images})
+		case RoleAssistant:
+			converted := ollamaMessage{Role: string(RoleAssistant), Content: message.Content}
+			for _, toolCall := range message.ToolCalls {
+				toolNames[toolCall.ID] = toolCall.Name
+				arguments := strings.TrimSpace(toolCall.Arguments)
+				if arguments == "" || !json.Valid([]byte(arguments)) {
+					arguments = "{}"
+				}
+				ollamaCall := ollamaToolCall{ID: toolCall.ID}
+				ollamaCall.Function.Name = toolCall.Name
+				ollamaCall.Function.Arguments = json.RawMessage(arguments)
+				converted.ToolCalls = append(converted.ToolCalls, ollamaCall)
+			}
+			result = append(result, converted)
+		case RoleTool:
+			content, images := toOllamaContent(message)
+			result = append(result, ollamaMessage{
+				Role:     string(RoleTool),
+				Content:  content,
+				Images:   images,
+				ToolName: toolNames[message.ToolCallID],
+			})
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", message.Role)
+		}
+	}
+	return result, nil
+}
+
+// toOllamaContent flattens content parts into text plus base64 images.
+// Ollama only accepts inline images, so image URLs and files are described in
+// the text instead.
+func toOllamaContent(message Message) (string, []string) {
+	if len(message.Parts) == 0 {
+		return message.Content, nil
+	}
+	texts := make([]string, 0, len(message.Parts)+1)
+	images := make([]string, 0, len(message.Parts))
+	for _, part := range message.ContentParts() {
+		switch {
+		case part.Type == ContentPartImage && len(part.Data) > 0:
+			images = append(images, part.Base64())
+		case part.Type == ContentPartImage:
+			texts = append(texts, fmt.Sprintf("[image: %s]", part.URL))
+		case part.Type == ContentPartFile:
+			texts = append(texts, fmt.Sprintf("[file %s (%s) omitted: not supported by this provider]", part.Filename, part.MediaType))
+		default:
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), images
+}
+
+// selectOllamaTools approximates tool_choice, which Ollama lacks: "none"
+// sends no tools and a named tool is sent on its own. "required" and
+// parallel_tool_calls cannot be expressed and are ignored.
+func selectOllamaTools(definitions []ToolDefinition, choice *ToolChoice) []ToolDefinition {
+	if choice == nil {
+		return definitions
+	}
+	switch choice.Mode {
+	case ToolChoiceNone:
+		return nil
+	case ToolChoiceTool:
+		for _, definition := range definitions {
+			if definition.Name == choice.Name {
+				return []ToolDefinition{definition}
+			}
+		}
+	}
+	return definitions
+}
+
+func toOllamaOptions(options RequestOptions) *ollamaOptions {
+	converted := ollamaOptions{
+		Temperature: options.Temperature,
+		TopP:        options.TopP,
+		NumPredict:  options.MaxTokens,
+		Stop:        options.Stop,
+		Seed:        options.Seed,
+	}
+	if converted.Temperature == nil && converted.TopP == nil && converted.NumPredict == 0 && len(converted.Stop) == 0 && converted.Seed == nil {
+		return nil
+	}
+	return &converted
+}
+
+func toOllamaTools(definitions []ToolDefinition) []ollamaTool {
+	tools := make([]ollamaTool, 0, len(definitions))
+	for _, definition := range definitions {
+		tools = append(tools, ollamaTool{
+			Type: "function",
+			Function: ollamaToolFunction{
+				Name:        definition.Name,
+				Description: definition.Description,
+				Parameters:  definition.Parameters,
+			},
+		})
+	}
+	return tools
+}
+
+func fromOllamaResponse(response ollamaChatResponse) CompletionResponse {
+	toolCalls := make([]ToolCall, 0, len(response.Message.ToolCalls))
+	for _, toolCall := range response.Message.ToolCalls {
+		id := strings.TrimSpace(toolCall.ID)
+		if id == "" {
+			id = newOllamaToolCallID()
+		}
+		arguments := strings.TrimSpace(string(toolCall.Function.Arguments))
+		if arguments == "" || arguments == "null" {
+			arguments = "{}"
+		}
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        id,
+			Name:      toolCall.Function.Name,
+			Arguments: arguments,
+		})
+	}
+
+	return CompletionResponse{Choices: []Choice{{
+		FinishReason: ollamaFinishReason(response.DoneReason, len(toolCalls) > 0),
+		Message: Message{
+			Role:      RoleAssistant,
+			Content:   strings.TrimSpace(response.Message.Content),
+			Reasoning: strings.TrimSpace(response.Message.Thinking),
+			ToolCalls: toolCalls,
+		},
+	}}, Usage: Usage{
+		PromptTokens:     response.PromptEvalCount,
+		CompletionTokens: response.EvalCount,
+		TotalTokens:      response.PromptEvalCount + response.EvalCount,
+	}}
+}
+
+// ollamaFinishReason maps done_reason onto OpenAI-style finish reasons.
+// Ollama reports "stop" even when the message carries tool calls, so those
+// are surfaced as "tool_calls" to keep the agent loop running.
+func ollamaFinishReason(doneReason string, hasToolCalls bool) string {
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	switch doneReason {
+	case "", "stop":
+		return "stop"
+	default:
+		return doneReason
+	}
+}
+
+// newOllamaToolCallID synthesizes an id because Ollama does not always assign
+// one, while the rest of the program pairs tool results to calls by id.
+func newOllamaToolCallID() string {
+	bytes := make([]byte, 6)
+	if _, err := rand.Read(bytes); err != nil {
+		return fmt.Sprintf("call_%d", time.Now().UnixNano())
+	}
+	return "call_" + hex.EncodeToString(bytes)
+}
@@ -0,0 +1,184 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestToOllamaMessages_AttachesToolNames(t *testing.T) {
+	messages := []Message{
+		{Role: RoleSystem, Content: "system prompt"},
+		{Role: RoleUser, Content: "user prompt"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "ListDir", Arguments: ""}}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: `{"entries":[]}`},
+	}
+
+	converted, err := toOllamaMessages(messages)
+	if err != nil {
+		t.Fatalf("toOllamaMessages returned error: %v", err)
+	}
+	if len(converted) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(converted))
+	}
+	if len(converted[2].ToolCalls) != 1 || string(converted[2].ToolCalls[0].Function.Arguments) != "{}" {
+		t.Fatalf("expected tool call with object arguments, got %+v", converted[2].ToolCalls)
+	}
+	if converted[3].Role != "tool" || converted[3].ToolName != "ListDir" {
+		t.Fatalf("expected tool result tagged with tool name, got %+v", converted[3])
+	}
+}
+
+func TestOllamaFinishReason(t *testing.T) {
+	if got := ollamaFinishReason("stop", true); got != "tool_calls" {
+		t.Fatalf("expected tool_calls when tool calls present, got %q", got)
+	}
+	if got := ollamaFinishReason("stop", false); got != "stop" {
+		t.Fatalf("expected stop, got %q", got)
+	}
+	if got := ollamaFinishReason("length", false); got != "length" {
+		t.Fatalf("expected length, got %q", got)
+	}
+}
+
+func TestOllamaClientComplete_ParsesToolCalls(t *testing.T) {
+	var captured ollamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("expected no authorization header without api key")
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &captured); err != nil {
+			t.Errorf("failed decoding request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"model":"llama3.1","message":{"role":"assistant","content":"",` +
+			`"tool_calls":[{"function":{"name":"Read","arguments":{"file_path":"README.md"}}}]},` +
+			`"done":true,"done_reason":"stop"}`))
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient("", server.URL)
+	response, err := client.Complete(context.Background(), CompletionRequest{
+		Model:    "llama3.1",
+		Messages: []Message{{Role: RoleUser, Content: "read it"}},
+		Tools:    []ToolDefinition{{Name: "Read", Parameters: map[string]any{"type": "object"}}},
+	})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+
+	if captured.Stream || len(captured.Tools) != 1 || captured.Tools[0].Type != "function" {
+		t.Fatalf("expected non-streaming request with function tool, got %+v", captured)
+	}
+
+	choice := response.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Fatalf("expected finish reason tool_calls, got %q", choice.FinishReason)
+	}
+	if len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("expected one tool call, got %d", len(choice.Message.ToolCalls))
+	}
+	toolCall := choice.Message.ToolCalls[0]
+	if !strings.HasPrefix(toolCall.ID, "call_") || toolCall.Name != "Read" {
+		t.Fatalf("expected synthesized id and Read tool, got %+v", toolCall)
+	}
+	if toolCall.Arguments != `{"file_path":"README.md"}` {
+		t.Fatalf("expected arguments preserved, got %q", toolCall.Arguments)
+	}
+}
+
+func TestOllamaRequestOptions(t *testing.T) {
+	temperature := 0.3
+	options := toOllamaOptions(RequestOptions{Temperature: &temperature, MaxTokens: 64, Stop: []string{"END"}})
+	if options == nil || *options.Temperature != 0.3 || options.NumPredict != 64 || options.Stop[0] != "END" {
+		t.Fatalf("expected options mapped, got %+v", options)
+	}
+	if toOllamaOptions(RequestOptions{}) != nil {
+		t.Fatal("expected no options block without settings")
+	}
+
+	definitions := []ToolDefinition{{Name: "Read"}, {Name: "Write"}}
+	if selected := selectOllamaTools(definitions, &ToolChoice{Mode: ToolChoiceTool, Name: "Write"}); len(selected) != 1 || selected[0].Name != "Write" {
+		t.Fatalf("expected only the forced tool, got %+v", selected)
+	}
+	if selected := selectOllamaTools(definitions, &ToolChoice{Mode: ToolChoiceNone}); len(selected) != 0 {
+		t.Fatalf("expected no tools for none, got %+v", selected)
+	}
+}
+
+func TestOllamaClientComplete_SendsFormatAndThink(t *testing.T) {
+	var captured map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &captured); err != nil {
+			t.Errorf("failed decoding request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"model":"llama3.1","message":{"role":"assistant","content":"{\"ok\":true}","thinking":"easy"},"done":true,"done_reason":"stop"}`))
+	}))
+	defer server.Close()
+
+	schema := map[string]any{"type": "object", "required": []any{"ok"}}
+	response, err := NewOllamaClient("", server.URL).Complete(context.Background(), CompletionRequest{
+		Model:    "llama3.1",
+		Messages: []Message{{Role: RoleUser, Content: "answer"}},
+		RequestOptions: RequestOptions{
+			ResponseFormat: &ResponseFormat{Name: "response", Schema: schema},
+			Reasoning:      &ReasoningOptions{Effort: ReasoningEffortLow},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	format, _ := captured["format"].(map[string]any)
+	if format["type"] != "object" {
+		t.Fatalf("expected schema sent as format, got %+v", captured["format"])
+	}
+	if captured["think"] != true || response.Choices[0].Message.Reasoning != "easy" {
+		t.Fatalf("expected think enabled and thinking captured, got %+v %+v", captured["think"], response.Choices[0].Message)
+	}
+}
+
+func TestOllamaClientListModels_ReadsCapabilities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			_, _ = w.Write([]byte(`{"models":[{"name":"llama3.1:latest"},{"name":"phi3:latest"},{"name":"broken:latest"}]}`))
+		case "/api/show":
+			var request map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			switch request["model"] {
+			case "llama3.1:latest":
+				_, _ = w.Write([]byte(`{"capabilities":["completion","tools"],"model_info":{"llama.context_length":131072}}`))
+			case "phi3:latest":
+				_, _ = w.Write([]byte(`{"capabilities":["completion"],"model_info":{"phi3.context_length":4096}}`))
+			default:
+				http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			}
+		}
+	}))
+	defer server.Close()
+
+	models, err := NewOllamaClient("", server.URL).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels returned error: %v", err)
+	}
+	if len(models) != 3 {
+		t.Fatalf("expected 3 models, got %d", len(models))
+	}
+	if llama := models[0]; llama.ContextLength != 131072 || llama.SupportsTools == nil || !*llama.SupportsTools {
+		t.Fatalf("unexpected llama info %+v", llama)
+	}
+	if phi := models[1]; phi.ContextLength != 4096 || phi.SupportsTools == nil || *phi.SupportsTools {
+		t.Fatalf("unexpected phi info %+v", phi)
+	}
+	if broken := models[2]; broken.SupportsTools != nil {
+		t.Fatalf("expected unknown capabilities, got %+v", broken)
+	}
+}
@@ -2,42 +2,327 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
+	"github.com/openai/openai-go/v3/packages/respjson"
 )
 
 type OpenAIClient struct {
 	client openai.Client
 }
 
+// NewOpenAIClient disables the SDK's own retries; wrap the client in a
+// RetryingClient to retry failed requests.
 func NewOpenAIClient(apiKey, baseURL string) *OpenAIClient {
-	return &OpenAIClient{client: openai.NewClient(option.WithAPIKey(apiKey), option.WithBaseURL(baseURL))}
+	return &OpenAIClient{client: openai.NewClient(option.WithAPIKey(apiKey), option.WithBaseURL(baseURL), option.WithMaxRetries(0))}
 }
 
 func (client *OpenAIClient) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
-	messageParams, err := toOpenAIMessages(request.Messages)
+	params, err := toOpenAIParams(request)
 	if err != nil {
 		return CompletionResponse{}, err
 	}
 
-	toolDefinitions := toOpenAIToolDefinitions(request.Tools)
-	response, err := client.client.Chat.Completions.New(ctx,
-		openai.ChatCompletionNewParams{
-			Model:    request.Model,
-			Messages: messageParams,
-			Tools:    toolDefinitions,
-		},
-	)
+	response, err := client.client.Chat.Completions.New(ctx, params)
 	if err != nil {
-		return CompletionResponse{}, err
+		return CompletionResponse{}, fromOpenAIError(err)
 	}
 
 	return fromOpenAIResponse(response), nil
 }
 
+func (client *OpenAIClient) CompleteStream(ctx context.Context, request CompletionRequest, onDelta StreamHandler) (CompletionResponse, error) {
+	params, err := toOpenAIParams(request)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	stream := client.client.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	accumulator := openai.ChatCompletionAccumulator{}
+	var streamUsage openai.CompletionUsage
+	var reasoning strings.Builder
+	var reasoningDetails reasoningDetailsAccumulator
+	for stream.Next() {
+		chunk := stream.Current()
+		accumulator.AddChunk(chunk)
+		if chunk.JSON.Usage.Valid() {
+			streamUsage = chunk.Usage
+		}
+		if len(chunk.Choices) > 0 {
+			reasoning.WriteString(openAIReasoning(chunk.Choices[0].Delta.JSON.ExtraFields))
+			reasoningDetails.add(chunk.Choices[0].Delta.JSON.ExtraFields)
+		}
+		if onDelta == nil {
+			continue
+		}
+		if delta, ok := streamDeltaFromChunk(chunk, &accumulator.ChatCompletion); ok {
+			onDelta(delta)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return CompletionResponse{}, fromOpenAIError(err)
+	}
+
+	response := fromOpenAIResponse(&accumulator.ChatCompletion)
+	response.Usage = fromOpenAIUsage(streamUsage)
+	// The accumulator drops fields the SDK does not model, such as reasoning.
+	if len(response.Choices) > 0 && response.Choices[0].Message.Reasoning == "" {
+		response.Choices[0].Message.Reasoning = strings.TrimSpace(reasoning.String())
+	}
+	if len(response.Choices) > 0 && len(response.Choices[0].Message.ReasoningBlocks) == 0 {
+		response.Choices[0].Message.ReasoningBlocks = reasoningDetails.blocks()
+	}
+	return response, nil
+}
+
+// openAIModelList is the /models response. The context length, pricing and
+// supported parameters are OpenRouter extensions; plain OpenAI-compatible
+// servers only report ids.
+type openAIModelList struct {
+	Data []struct {
+		ID            string `json:"id"`
+		Name          string `json:"name"`
+		ContextLength int    `json:"context_length"`
+		Pricing       *struct {
+			Prompt          string `json:"prompt"`
+			Completion      string `json:"completion"`
+			InputCacheRead  string `json:"input_cache_read"`
+			InputCacheWrite string `json:"input_cache_write"`
+		} `json:"pricing"`
+		SupportedParameters []string `json:"supported_parameters"`
+	} `json:"data"`
+}
+
+func (client *OpenAIClient) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var list openAIModelList
+	if err := client.client.Get(ctx, "models", nil, &list); err != nil {
+		return nil, fromOpenAIError(err)
+	}
+	return fromOpenAIModelList(list), nil
+}
+
+func fromOpenAIModelList(list openAIModelList) []ModelInfo {
+	models := make([]ModelInfo, 0, len(list.Data))
+	for _, model := range list.Data {
+		info := ModelInfo{ID: model.ID, Name: model.Name, ContextLength: model.ContextLength}
+		if model.Pricing != nil {
+			info.Pricing = &ModelPrice{
+				PromptPerMillion:       perTokenToPerMillion(model.Pricing.Prompt),
+				CompletionPerMillion:   perTokenToPerMillion(model.Pricing.Completion),
+				CachedPromptPerMillion: perTokenToPerMillion(model.Pricing.InputCacheRead),
+				CacheWritePerMillion:   perTokenToPerMillion(model.Pricing.InputCacheWrite),
+			}
+		}
+		if model.SupportedParameters != nil {
+			supportsTools := false
+			for _, parameter := range model.SupportedParameters {
+				if parameter == "tools" {
+					supportsTools = true
+				}
+			}
+			info.SupportsTools = &supportsTools
+		}
+		models = append(models, info)
+	}
+	return models
+}
+
+// fromOpenAIError converts SDK status errors into an *APIError and leaves
+// every other error untouched.
+func fromOpenAIError(err error) error {
+	var openAIErr *openai.Error
+	if !errors.As(err, &openAIErr) {
+		return err
+	}
+
+	var header http.Header
+	if openAIErr.Response != nil {
+		header = openAIErr.Response.Header
+	}
+	message := strings.TrimSpace(openAIErr.Message)
+	if message == "" {
+		message = strings.TrimSpace(openAIErr.RawJSON())
+	}
+	apiErr := NewHTTPError("openai", openAIErr.StatusCode, header, message)
+	if openAIErr.Code == "context_length_exceeded" {
+		apiErr.Kind = ErrorKindContextLength
+	}
+	apiErr.Err = err
+	return apiErr
+}
+
+func toOpenAIParams(request CompletionRequest) (openai.ChatCompletionNewParams, error) {
+	messageParams, err := toOpenAIMessages(request.Messages)
+	if err != nil {
+		return openai.ChatCompletionNewParams{}, err
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Model:    request.Model,
+		Messages: messageParams,
+		Tools:    toOpenAIToolDefinitions(request.Tools),
+	}
+	applyOpenAIOptions(&params, request.RequestOptions, len(request.Tools) > 0)
+	if !request.DisablePromptCache && needsCacheControl(request.Model) {
+		markOpenAICacheBreakpoints(params.Messages)
+	}
+	return params, nil
+}
+
+// needsCacheControl reports whether an OpenRouter model only caches prompts
+// at explicit cache_control breakpoints. OpenAI, DeepSeek and similar models
+// cache automatically.
+func needsCacheControl(model string) bool {
+	return strings.HasPrefix(model, "anthropic/") || strings.HasPrefix(model, "google/gemini")
+}
+
+// markOpenAICacheBreakpoints marks the system prompt, which follows the tool
+// definitions in the cached prefix, and the latest message, so the next turn
+// reads the whole history from the cache. Only text parts can carry
+// cache_control, so string contents are turned into a single text part.
+func markOpenAICacheBreakpoints(messages []openai.ChatCompletionMessageParamUnion) {
+	for _, message := range messages {
+		if system := message.OfSystem; system != nil {
+			if text := system.Content.OfString; text.Valid() && strings.TrimSpace(text.Value) != "" {
+				system.Content = openai.ChatCompletionSystemMessageParamContentUnion{
+					OfArrayOfContentParts: []openai.ChatCompletionContentPartTextParam{cacheableTextPart(text.Value)},
+				}
+			}
+			break
+		}
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	last := messages[len(messages)-1]
+	switch {
+	case last.OfUser != nil:
+		content := &last.OfUser.Content
+		if text := content.OfString; text.Valid() && strings.TrimSpace(text.Value) != "" {
+			part := cacheableTextPart(text.Value)
+			*content = openai.ChatCompletionUserMessageParamContentUnion{
+				OfArrayOfContentParts: []openai.ChatCompletionContentPartUnionParam{{OfText: &part}},
+			}
+			return
+		}
+		for index := len(content.OfArrayOfContentParts) - 1; index >= 0; index-- {
+			if textPart := content.OfArrayOfContentParts[index].OfText; textPart != nil && strings.TrimSpace(textPart.Text) != "" {
+				*textPart = cacheableTextPart(textPart.Text)
+				return
+			}
+		}
+	case last.OfTool != nil:
+		if text := last.OfTool.Content.OfString; text.Valid() && strings.TrimSpace(text.Value) != "" {
+			last.OfTool.Content = openai.ChatCompletionToolMessageParamContentUnion{
+				OfArrayOfContentParts: []openai.ChatCompletionContentPartTextParam{cacheableTextPart(text.Value)},
+			}
+		}
+	}
+}
+
+func cacheableTextPart(text string) openai.ChatCompletionContentPartTextParam {
+	part := openai.ChatCompletionContentPartTextParam{Text: text}
+	part.SetExtraFields(map[string]any{"cache_control": map[string]any{"type": "ephemeral"}})
+	return part
+}
+
+// applyOpenAIOptions sets the optional request fields. Tool settings are only
+// sent alongside tools, since the API rejects them otherwise.
+func applyOpenAIOptions(params *openai.ChatCompletionNewParams, options RequestOptions, hasTools bool) {
+	if options.Temperature != nil {
+		params.Temperature = openai.Float(*options.Temperature)
+	}
+	if options.TopP != nil {
+		params.TopP = openai.Float(*options.TopP)
+	}
+	if options.MaxTokens > 0 {
+		params.MaxTokens = openai.Int(int64(options.MaxTokens))
+	}
+	if len(options.Stop) > 0 {
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: options.Stop}
+	}
+	if options.Seed != nil {
+		params.Seed = openai.Int(*options.Seed)
+	}
+	if options.Reasoning != nil {
+		// OpenRouter takes either an effort or a token budget.
+		if options.Reasoning.BudgetTokens > 0 {
+			params.SetExtraFields(map[string]any{"reasoning": map[string]any{"max_tokens": options.Reasoning.BudgetTokens}})
+		} else {
+			params.ReasoningEffort = openai.ReasoningEffort(options.Reasoning.Effort)
+		}
+	}
+	if options.ResponseFormat != nil {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+				JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   options.ResponseFormat.Name,
+					Schema: options.ResponseFormat.Schema,
+				},
+			},
+		}
+	}
+	if !hasTools {
+		return
+	}
+	if options.ParallelToolCalls != nil {
+		params.ParallelToolCalls = openai.Bool(*options.ParallelToolCalls)
+	}
+	if options.ToolChoice != nil {
+		switch options.ToolChoice.Mode {
+		case ToolChoiceTool:
+			params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{
+				OfFunctionToolChoice: &openai.ChatCompletionNamedToolChoiceParam{
+					Function: openai.ChatCompletionNamedToolChoiceFunctionParam{Name: options.ToolChoice.Name},
+				},
+			}
+		default:
+			params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String(string(options.ToolChoice.Mode))}
+		}
+	}
+}
+
+func streamDeltaFromChunk(chunk openai.ChatCompletionChunk, assembled *openai.ChatCompletion) (StreamDelta, bool) {
+	if len(chunk.Choices) == 0 {
+		return StreamDelta{}, false
+	}
+
+	choiceDelta := chunk.Choices[0].Delta
+	delta := StreamDelta{Content: choiceDelta.Content, Reasoning: openAIReasoning(choiceDelta.JSON.ExtraFields)}
+	for _, toolCall := range choiceDelta.ToolCalls {
+		index := int(toolCall.Index)
+		toolCallDelta := ToolCallDelta{
+			Index:     index,
+			ID:        toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		}
+		if assembled != nil && len(assembled.Choices) > 0 && index < len(assembled.Choices[0].Message.ToolCalls) {
+			assembledCall := assembled.Choices[0].Message.ToolCalls[index]
+			toolCallDelta.ID = assembledCall.ID
+			toolCallDelta.Name = assembledCall.Function.Name
+			toolCallDelta.Arguments = assembledCall.Function.Arguments
+		}
+		delta.ToolCalls = append(delta.ToolCalls, toolCallDelta)
+	}
+
+	if delta.Content == "" && delta.Reasoning == "" && len(delta.ToolCalls) == 0 {
+		return StreamDelta{}, false
+	}
+	return delta, true
+}
+
 func toOpenAIToolDefinitions(definitions []ToolDefinition) []openai.ChatCompletionToolUnionParam {
 	tools := make([]openai.ChatCompletionToolUnionParam, 0, len(definitions))
 	for _, definition := range definitions {
@@ -57,7 +342,25 @@ func toOpenAIToolDefinitions(definitions []ToolDefinition) []openai.ChatCompleti
 
 func toOpenAIMessages(messages []Message) ([]openai.ChatCompletionMessageParamUnion, error) {
 	result := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages))
+	// Tool messages only accept text, so media returned by tools is sent in
+	// a user message right after the tool results.
+	pendingToolMedia := make([]openai.ChatCompletionContentPartUnionParam, 0)
+	flushToolMedia := func() {
+		if len(pendingToolMedia) == 0 {
+			return
+		}
+		result = append(result, openai.ChatCompletionMessageParamUnion{
+			OfUser: &openai.ChatCompletionUserMessageParam{
+				Content: openai.ChatCompletionUserMessageParamContentUnion{OfArrayOfContentParts: pendingToolMedia},
+			},
+		})
+		pendingToolMedia = make([]openai.ChatCompletionContentPartUnionParam, 0)
+	}
+
 	for _, message := range messages {
+		if message.Role != RoleTool {
+			flushToolMedia()
+		}
 		switch message.Role {
 		case RoleSystem:
 			result = append(result, openai.ChatCompletionMessageParamUnion{
@@ -66,13 +369,21 @@ func toOpenAIMessages(messages []Message) ([]openai.ChatCompletionMessageParamUn
 				},
 			})
 		case RoleUser:
+			content := openai.ChatCompletionUserMessageParamContentUnion{OfString: openai.String(message.Content)}
+			if len(message.Parts) > 0 {
+				content = openai.ChatCompletionUserMessageParamContentUnion{OfArrayOfContentParts: toOpenAIContentParts(message.ContentParts())}
+			}
 			result = append(result, openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{OfString: openai.String(message.Content)},
-				},
+				OfUser: &openai.ChatCompletionUserMessageParam{Content: content},
 			})
 		case RoleAssistant:
+			// Only OpenRouter's reasoning details are sent back, which models
+			// such as Claude need to verify their reasoning during tool use;
+			// OpenAI-compatible APIs reject reasoning text.
 			assistant := openai.ChatCompletionAssistantMessageParam{}
+			if details := toOpenAIReasoningDetails(message.ReasoningBlocks); len(details) > 0 {
+				assistant.SetExtraFields(map[string]any{"reasoning_details": details})
+			}
 			if strings.TrimSpace(message.Content) != "" {
 				assistant.Content = openai.ChatCompletionAssistantMessageParamContentUnion{OfString: openai.String(message.Content)}
 			}
@@ -101,13 +412,37 @@ func toOpenAIMessages(messages []Message) ([]openai.ChatCompletionMessageParamUn
 					},
 				},
 			})
+			if message.HasMedia() {
+				pendingToolMedia = append(pendingToolMedia, openai.TextContentPart(fmt.Sprintf("Content returned by tool call %s:", message.ToolCallID)))
+				pendingToolMedia = append(pendingToolMedia, toOpenAIContentParts(message.Parts)...)
+			}
 		default:
 			return nil, fmt.Errorf("unsupported message role %q", message.Role)
 		}
 	}
+	flushToolMedia()
 	return result, nil
 }
 
+func toOpenAIContentParts(parts []ContentPart) []openai.ChatCompletionContentPartUnionParam {
+	converted := make([]openai.ChatCompletionContentPartUnionParam, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case ContentPartImage:
+			converted = append(converted, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: part.DataURL()}))
+		case ContentPartFile:
+			file := openai.ChatCompletionContentPartFileFileParam{FileData: openai.String(part.DataURL())}
+			if part.Filename != "" {
+				file.Filename = openai.String(part.Filename)
+			}
+			converted = append(converted, openai.FileContentPart(file))
+		default:
+			converted = append(converted, openai.TextContentPart(part.Text))
+		}
+	}
+	return converted
+}
+
 func fromOpenAIResponse(response *openai.ChatCompletion) CompletionResponse {
 	if response == nil {
 		return CompletionResponse{}
@@ -120,7 +455,29 @@ func fromOpenAIResponse(response *openai.ChatCompletion) CompletionResponse {
 			Message:      fromOpenAIMessage(choice.Message),
 		})
 	}
-	return CompletionResponse{Choices: choices}
+	return CompletionResponse{Choices: choices, Usage: fromOpenAIUsage(response.Usage)}
+}
+
+func fromOpenAIUsage(usage openai.CompletionUsage) Usage {
+	converted := Usage{
+		PromptTokens:     int(usage.PromptTokens),
+		CompletionTokens: int(usage.CompletionTokens),
+		CachedTokens:     int(usage.PromptTokensDetails.CachedTokens),
+		TotalTokens:      int(usage.TotalTokens),
+	}
+	// OpenRouter reports the billed cost alongside the token counts.
+	if field, ok := usage.JSON.ExtraFields["cost"]; ok {
+		if cost, err := strconv.ParseFloat(field.Raw(), 64); err == nil {
+			converted.Cost = cost
+		}
+	}
+	// It also reports prompt cache writes for providers that bill them.
+	if field, ok := usage.PromptTokensDetails.JSON.ExtraFields["cache_write_tokens"]; ok {
+		if tokens, err := strconv.Atoi(field.Raw()); err == nil {
+			converted.CacheWriteTokens = tokens
+		}
+	}
+	return converted
 }
 
 func fromOpenAIMessage(message openai.ChatCompletionMessage) Message {
@@ -139,8 +496,125 @@ func fromOpenAIMessage(message openai.ChatCompletionMessage) Message {
 	}
 
 	return Message{
-		Role:      RoleAssistant,
-		Content:   content,
-		ToolCalls: toolCalls,
+		Role:            RoleAssistant,
+		Content:         content,
+		Reasoning:       strings.TrimSpace(openAIReasoning(message.JSON.ExtraFields)),
+		ReasoningBlocks: openAIReasoningDetails(message.JSON.ExtraFields),
+		ToolCalls:       toolCalls,
+	}
+}
+
+// openAIReasoning reads the reasoning text OpenRouter adds to messages and
+// stream deltas; the SDK only exposes it as an extra field.
+func openAIReasoning(extraFields map[string]respjson.Field) string {
+	field, ok := extraFields["reasoning"]
+	if !ok {
+		return ""
+	}
+	var reasoning string
+	if err := json.Unmarshal([]byte(field.Raw()), &reasoning); err != nil {
+		return ""
+	}
+	return reasoning
+}
+
+// openAIReasoningDetails reads the reasoning_details OpenRouter adds to
+// messages: typed reasoning blocks, possibly signed or encrypted.
+func openAIReasoningDetails(extraFields map[string]respjson.Field) []ReasoningBlock {
+	field, ok := extraFields["reasoning_details"]
+	if !ok {
+		return nil
+	}
+	var details []json.RawMessage
+	if err := json.Unmarshal([]byte(field.Raw()), &details); err != nil {
+		return nil
+	}
+	var blocks []ReasoningBlock
+	for _, detail := range details {
+		if block, ok := reasoningDetailBlock(detail); ok {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func reasoningDetailBlock(detail json.RawMessage) (ReasoningBlock, bool) {
+	var fields struct {
+		Type      string `json:"type"`
+		Text      string `json:"text"`
+		Signature string `json:"signature"`
+		Data      string `json:"data"`
+	}
+	if err := json.Unmarshal(detail, &fields); err != nil || fields.Type == "" {
+		return ReasoningBlock{}, false
+	}
+	return ReasoningBlock{Type: fields.Type, Text: fields.Text, Signature: fields.Signature, Data: fields.Data, Raw: detail}, true
+}
+
+func toOpenAIReasoningDetails(blocks []ReasoningBlock) []json.RawMessage {
+	details := make([]json.RawMessage, 0, len(blocks))
+	for _, block := range blocks {
+		if len(block.Raw) > 0 {
+			details = append(details, block.Raw)
+		}
+	}
+	return details
+}
+
+// reasoningDetailsAccumulator joins the reasoning_details of stream deltas,
+// which send the text of a detail in pieces under the same index.
+type reasoningDetailsAccumulator struct {
+	details []map[string]any
+	byIndex map[float64]int
+}
+
+func (accumulator *reasoningDetailsAccumulator) add(extraFields map[string]respjson.Field) {
+	field, ok := extraFields["reasoning_details"]
+	if !ok {
+		return
+	}
+	var details []map[string]any
+	if err := json.Unmarshal([]byte(field.Raw()), &details); err != nil {
+		return
+	}
+	if accumulator.byIndex == nil {
+		accumulator.byIndex = map[float64]int{}
+	}
+	for _, detail := range details {
+		index, hasIndex := detail["index"].(float64)
+		position, seen := accumulator.byIndex[index]
+		if !hasIndex || !seen {
+			if hasIndex {
+				accumulator.byIndex[index] = len(accumulator.details)
+			}
+			accumulator.details = append(accumulator.details, detail)
+			continue
+		}
+		merged := accumulator.details[position]
+		for key, value := range detail {
+			piece, isString := value.(string)
+			previous, hadString := merged[key].(string)
+			switch {
+			case isString && hadString && (key == "text" || key == "summary"):
+				merged[key] = previous + piece
+			case isString && piece == "" && hadString:
+			default:
+				merged[key] = value
+			}
+		}
+	}
+}
+
+func (accumulator *reasoningDetailsAccumulator) blocks() []ReasoningBlock {
+	var blocks []ReasoningBlock
+	for _, detail := range accumulator.details {
+		raw, err := json.Marshal(detail)
+		if err != nil {
+			continue
+		}
+		if block, ok := reasoningDetailBlock(raw); ok {
+			blocks = append(blocks, block)
+		}
 	}
+	return blocks
 }
@@ -1,6 +1,12 @@
 package llm
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/openai/openai-go/v3"
@@ -92,3 +98,347 @@ func TestToOpenAIToolDefinitions(t *testing.T) {
 		t.Fatalf("expected tool description List entries, got %q", function.Function.Description.Value)
 	}
 }
+
+func TestOpenAIClientCompleteStream_ForwardsDeltasAndAssemblesToolCalls(t *testing.T) {
+	chunks := []string{
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{"role":"assistant","content":"Let me "}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{"content":"look."}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"Read","arguments":""}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"file_path\":"}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"README.md\"}"}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient("test-key", server.URL)
+	streamedText := ""
+	lastArguments := ""
+	response, err := client.CompleteStream(context.Background(), CompletionRequest{
+		Model:    "m",
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+	}, func(delta StreamDelta) {
+		streamedText += delta.Content
+		for _, toolCall := range delta.ToolCalls {
+			lastArguments = toolCall.Arguments
+		}
+	})
+	if err != nil {
+		t.Fatalf("CompleteStream returned error: %v", err)
+	}
+	if streamedText != "Let me look." {
+		t.Fatalf("expected streamed text %q, got %q", "Let me look.", streamedText)
+	}
+	if lastArguments != `{"file_path":"README.md"}` {
+		t.Fatalf("expected assembled arguments in last delta, got %q", lastArguments)
+	}
+	if len(response.Choices) != 1 {
+		t.Fatalf("expected one choice, got %d", len(response.Choices))
+	}
+	choice := response.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Fatalf("expected finish reason tool_calls, got %q", choice.FinishReason)
+	}
+	if choice.Message.Content != "Let me look." {
+		t.Fatalf("expected assembled content, got %q", choice.Message.Content)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].ID != "call_1" || choice.Message.ToolCalls[0].Name != "Read" {
+		t.Fatalf("expected assembled Read tool call, got %+v", choice.Message.ToolCalls)
+	}
+	if choice.Message.ToolCalls[0].Arguments != `{"file_path":"README.md"}` {
+		t.Fatalf("expected assembled tool arguments, got %q", choice.Message.ToolCalls[0].Arguments)
+	}
+}
+
+func TestFromOpenAIUsage(t *testing.T) {
+	usage := fromOpenAIUsage(openai.CompletionUsage{
+		PromptTokens:        120,
+		CompletionTokens:    30,
+		TotalTokens:         150,
+		PromptTokensDetails: openai.CompletionUsagePromptTokensDetails{CachedTokens: 100},
+	})
+
+	expected := Usage{PromptTokens: 120, CompletionTokens: 30, CachedTokens: 100, TotalTokens: 150}
+	if usage != expected {
+		t.Fatalf("expected %+v, got %+v", expected, usage)
+	}
+}
+
+func TestToOpenAIParams_MapsRequestOptions(t *testing.T) {
+	temperature := 0.2
+	seed := int64(7)
+	parallel := false
+	request := CompletionRequest{
+		Model:    "m",
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+		Tools:    []ToolDefinition{{Name: "Read", Parameters: map[string]any{"type": "object"}}},
+		RequestOptions: RequestOptions{
+			Temperature:       &temperature,
+			MaxTokens:         100,
+			Stop:              []string{"END"},
+			Seed:              &seed,
+			ToolChoice:        &ToolChoice{Mode: ToolChoiceTool, Name: "Read"},
+			ParallelToolCalls: &parallel,
+		},
+	}
+
+	params, err := toOpenAIParams(request)
+	if err != nil {
+		t.Fatalf("toOpenAIParams returned error: %v", err)
+	}
+	payload, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("marshal params: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("unmarshal params: %v", err)
+	}
+	if decoded["temperature"] != 0.2 || decoded["max_tokens"] != float64(100) || decoded["seed"] != float64(7) || decoded["parallel_tool_calls"] != false {
+		t.Fatalf("expected sampling options in payload, got %s", payload)
+	}
+	toolChoice, _ := decoded["tool_choice"].(map[string]any)
+	function, _ := toolChoice["function"].(map[string]any)
+	if function["name"] != "Read" {
+		t.Fatalf("expected forced Read tool choice, got %s", payload)
+	}
+
+	request.ResponseFormat = &ResponseFormat{Name: "report", Schema: map[string]any{"type": "object"}}
+	params, _ = toOpenAIParams(request)
+	payload, _ = json.Marshal(params)
+	decoded = nil
+	_ = json.Unmarshal(payload, &decoded)
+	responseFormat, _ := decoded["response_format"].(map[string]any)
+	jsonSchema, _ := responseFormat["json_schema"].(map[string]any)
+	if responseFormat["type"] != "json_schema" || jsonSchema["name"] != "report" || jsonSchema["schema"] == nil {
+		t.Fatalf("expected json_schema response format, got %s", payload)
+	}
+
+	request.Tools = nil
+	request.ResponseFormat = nil
+	params, _ = toOpenAIParams(request)
+	payload, _ = json.Marshal(params)
+	if strings.Contains(string(payload), "tool_choice") || strings.Contains(string(payload), "parallel_tool_calls") {
+		t.Fatalf("expected tool options dropped without tools, got %s", payload)
+	}
+}
+
+func TestToOpenAIMessages_ContentParts(t *testing.T) {
+	converted, err := toOpenAIMessages([]Message{
+		{Role: RoleUser, Content: "what is this?", Parts: []ContentPart{ImagePart("image/png", []byte("png"))}},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "Read", Arguments: "{}"}}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: `{"ok":true}`, Parts: []ContentPart{ImagePart("image/png", []byte("png"))}},
+		{Role: RoleAssistant, Content: "a screenshot"},
+	})
+	if err != nil {
+		t.Fatalf("toOpenAIMessages returned error: %v", err)
+	}
+	if len(converted) != 5 {
+		t.Fatalf("expected tool media to be forwarded in an extra user message, got %d messages", len(converted))
+	}
+
+	userParts := converted[0].OfUser.Content.OfArrayOfContentParts
+	if len(userParts) != 2 || userParts[1].OfImageURL == nil || userParts[1].OfImageURL.ImageURL.URL != "data:image/png;base64,cG5n" {
+		t.Fatalf("expected text and image parts, got %+v", userParts)
+	}
+	if converted[2].OfTool == nil || converted[3].OfUser == nil || converted[4].OfAssistant == nil {
+		t.Fatalf("expected tool, user media and assistant messages in order, got %+v", converted)
+	}
+	if len(converted[3].OfUser.Content.OfArrayOfContentParts) != 2 {
+		t.Fatalf("expected caption and image for tool media, got %+v", converted[3].OfUser.Content)
+	}
+}
+
+func TestFromOpenAIResponse_CapturesReasoning(t *testing.T) {
+	var completion openai.ChatCompletion
+	if err := json.Unmarshal([]byte(`{"id":"c1","choices":[{"index":0,"finish_reason":"stop",`+
+		`"message":{"role":"assistant","content":"4","reasoning":"2 plus 2 is 4"}}]}`), &completion); err != nil {
+		t.Fatalf("unmarshal completion: %v", err)
+	}
+
+	response := fromOpenAIResponse(&completion)
+	if len(response.Choices) != 1 || response.Choices[0].Message.Reasoning != "2 plus 2 is 4" {
+		t.Fatalf("expected reasoning captured, got %+v", response.Choices)
+	}
+
+	converted, err := toOpenAIMessages([]Message{response.Choices[0].Message})
+	if err != nil {
+		t.Fatalf("toOpenAIMessages returned error: %v", err)
+	}
+	payload, _ := json.Marshal(converted)
+	if strings.Contains(string(payload), "reasoning") {
+		t.Fatalf("expected reasoning not to be sent back, got %s", payload)
+	}
+}
+
+func TestToOpenAIParams_MapsReasoning(t *testing.T) {
+	request := CompletionRequest{
+		Model:          "m",
+		Messages:       []Message{{Role: RoleUser, Content: "hi"}},
+		RequestOptions: RequestOptions{Reasoning: &ReasoningOptions{Effort: ReasoningEffortHigh}},
+	}
+	params, _ := toOpenAIParams(request)
+	payload, _ := json.Marshal(params)
+	if !strings.Contains(string(payload), `"reasoning_effort":"high"`) {
+		t.Fatalf("expected reasoning effort, got %s", payload)
+	}
+
+	request.Reasoning = &ReasoningOptions{BudgetTokens: 2048}
+	params, _ = toOpenAIParams(request)
+	payload, _ = json.Marshal(params)
+	if !strings.Contains(string(payload), `"reasoning":{"max_tokens":2048}`) || strings.Contains(string(payload), "reasoning_effort") {
+		t.Fatalf("expected reasoning token budget only, got %s", payload)
+	}
+}
+
+func TestToOpenAIParams_MarksCacheBreakpointsForAnthropicModels(t *testing.T) {
+	request := CompletionRequest{
+		Model: "anthropic/claude-haiku-4.5",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "system"},
+			{Role: RoleUser, Content: "read it"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "Read", Arguments: "{}"}}},
+			{Role: RoleTool, ToolCallID: "call_1", Content: "contents"},
+		},
+	}
+
+	params, err := toOpenAIParams(request)
+	if err != nil {
+		t.Fatalf("toOpenAIParams returned error: %v", err)
+	}
+	payload, _ := json.Marshal(params)
+	var decoded struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("unmarshal params: %v", err)
+	}
+	breakpoint := `"cache_control":{"type":"ephemeral"}`
+	if !strings.Contains(string(decoded.Messages[0].Content), breakpoint) || !strings.Contains(string(decoded.Messages[3].Content), breakpoint) {
+		t.Fatalf("expected breakpoints on the system prompt and latest message, got %s", payload)
+	}
+	if string(decoded.Messages[1].Content) != `"read it"` {
+		t.Fatalf("expected earlier messages unchanged, got %s", decoded.Messages[1].Content)
+	}
+
+	request.Model = "openai/gpt-4o-mini"
+	params, _ = toOpenAIParams(request)
+	payload, _ = json.Marshal(params)
+	if strings.Contains(string(payload), "cache_control") {
+		t.Fatalf("expected no cache_control for automatically cached models, got %s", payload)
+	}
+}
+
+func TestFromOpenAIUsage_ReportsCacheWrites(t *testing.T) {
+	var usage openai.CompletionUsage
+	if err := json.Unmarshal([]byte(`{"prompt_tokens":1000,"completion_tokens":10,"total_tokens":1010,`+
+		`"prompt_tokens_details":{"cached_tokens":600,"cache_write_tokens":300}}`), &usage); err != nil {
+		t.Fatalf("unmarshal usage: %v", err)
+	}
+
+	converted := fromOpenAIUsage(usage)
+	if converted.CachedTokens != 600 || converted.CacheWriteTokens != 300 {
+		t.Fatalf("expected cache reads and writes, got %+v", converted)
+	}
+}
+
+func TestOpenAIClientListModels_ReadsOpenRouterMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[` +
+			`{"id":"anthropic/claude-haiku-4.5","name":"Claude Haiku 4.5","context_length":200000,"pricing":{"prompt":"0.000001","completion":"0.000005","input_cache_read":"0.0000001"},"supported_parameters":["tools","temperature"]},` +
+			`{"id":"gpt-4o","object":"model"}]}`))
+	}))
+	defer server.Close()
+
+	models, err := NewOpenAIClient("test-key", server.URL).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels returned error: %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("expected 2 models, got %d", len(models))
+	}
+	haiku := models[0]
+	if haiku.ContextLength != 200000 || haiku.SupportsTools == nil || !*haiku.SupportsTools {
+		t.Fatalf("unexpected model info %+v", haiku)
+	}
+	if haiku.Pricing == nil || haiku.Pricing.PromptPerMillion != 1 || haiku.Pricing.CompletionPerMillion != 5 || haiku.Pricing.CachedPromptPerMillion < 0.099 {
+		t.Fatalf("unexpected pricing %+v", haiku.Pricing)
+	}
+	if plain := models[1]; plain.Pricing != nil || plain.SupportsTools != nil || plain.ContextLength != 0 {
+		t.Fatalf("expected unknown metadata for plain model, got %+v", plain)
+	}
+}
+
+func TestOpenAIClient_RoundTripsReasoningDetailsThroughToolTurn(t *testing.T) {
+	details := `[{"type":"reasoning.text","text":"read it first","signature":"sig-1","format":"anthropic-claude-v1","index":0},` +
+		`{"type":"reasoning.encrypted","data":"opaque","format":"anthropic-claude-v1","index":1}]`
+	requests := []map[string]any{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			fmt.Fprintf(w, `{"id":"c1","object":"chat.completion","created":1,"model":"m","choices":[{"index":0,"finish_reason":"tool_calls",`+
+				`"message":{"role":"assistant","content":"","reasoning":"read it first","reasoning_details":%s,`+
+				`"tool_calls":[{"id":"call_1","type":"function","function":{"name":"Read","arguments":"{}"}}]}}]}`, details)
+			return
+		}
+		fmt.Fprint(w, `{"id":"c2","object":"chat.completion","created":1,"model":"m","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"done"}}]}`)
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient("test-key", server.URL)
+	history := []Message{{Role: RoleUser, Content: "read it"}}
+	response, err := client.Complete(context.Background(), CompletionRequest{Model: "m", Messages: history})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	assistant := response.Choices[0].Message
+	if len(assistant.ReasoningBlocks) != 2 || assistant.ReasoningBlocks[0].Signature != "sig-1" || assistant.ReasoningBlocks[1].Data != "opaque" {
+		t.Fatalf("expected both reasoning details captured, got %+v", assistant.ReasoningBlocks)
+	}
+
+	history = append(history, assistant, Message{Role: RoleTool, ToolCallID: "call_1", Content: "{}"})
+	if _, err := client.Complete(context.Background(), CompletionRequest{Model: "m", Messages: history}); err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	var expected []any
+	_ = json.Unmarshal([]byte(details), &expected)
+	replayed := requests[1]["messages"].([]any)[1].(map[string]any)
+	if fmt.Sprint(replayed["reasoning_details"]) != fmt.Sprint(expected) || replayed["reasoning"] != nil {
+		t.Fatalf("expected the reasoning details sent back unchanged, got %+v", replayed)
+	}
+}
+
+func TestReasoningDetailsAccumulator_JoinsStreamedPieces(t *testing.T) {
+	var accumulator reasoningDetailsAccumulator
+	for _, chunk := range []string{
+		`{"index":0,"delta":{"reasoning_details":[{"type":"reasoning.text","text":"read ","index":0}]}}`,
+		`{"index":0,"delta":{"reasoning_details":[{"type":"reasoning.text","text":"it","index":0}]}}`,
+		`{"index":0,"delta":{"reasoning_details":[{"type":"reasoning.text","text":"","signature":"sig-1","index":0}]}}`,
+	} {
+		var choice openai.ChatCompletionChunkChoice
+		if err := json.Unmarshal([]byte(chunk), &choice); err != nil {
+			t.Fatalf("unmarshal chunk: %v", err)
+		}
+		accumulator.add(choice.Delta.JSON.ExtraFields)
+	}
+	blocks := accumulator.blocks()
+	if len(blocks) != 1 || blocks[0].Text != "read it" || blocks[0].Signature != "sig-1" {
+		t.Fatalf("expected one signed detail with the joined text, got %+v", blocks)
+	}
+}
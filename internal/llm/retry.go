@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	DefaultRetryBaseDelay = time.Second
+	DefaultRetryMaxDelay  = 30 * time.Second
+)
+
+// RetryPolicy bounds how a RetryingClient retries. MaxRetries counts retries
+// after the first attempt; zero delays fall back to the defaults.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+type RetryLogger interface {
+	Warnf(format string, args ...interface{})
+}
+
+// RetryingClient retries rate-limited, overloaded and transport failures with
+// jittered exponential backoff, honouring Retry-After when the provider sends
+// it. It never waits longer than MaxDelay or past the request context's
+// deadline, returning the error instead.
+type RetryingClient struct {
+	client Client
+	policy RetryPolicy
+	logger RetryLogger
+	sleep  func(ctx context.Context, delay time.Duration) error
+	jitter func(delay time.Duration) time.Duration
+}
+
+func NewRetryingClient(client Client, policy RetryPolicy, logger RetryLogger) *RetryingClient {
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultRetryBaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryMaxDelay
+	}
+	return &RetryingClient{
+		client: client,
+		policy: policy,
+		logger: logger,
+		sleep:  sleepContext,
+		jitter: equalJitter,
+	}
+}
+
+func (client *RetryingClient) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
+	return client.do(ctx, request.Model, func() (CompletionResponse, bool, error) {
+		response, err := client.client.Complete(ctx, request)
+		return response, false, err
+	})
+}
+
+// CompleteStream only retries while nothing has been streamed yet, so callers
+// never see the same text twice. Clients without streaming support fall back
+// to Complete.
+func (client *RetryingClient) CompleteStream(ctx context.Context, request CompletionRequest, onDelta StreamHandler) (CompletionResponse, error) {
+	streamingClient, ok := client.client.(StreamingClient)
+	if !ok {
+		return client.Complete(ctx, request)
+	}
+
+	return client.do(ctx, request.Model, func() (CompletionResponse, bool, error) {
+		streamed := false
+		response, err := streamingClient.CompleteStream(ctx, request, func(delta StreamDelta) {
+			streamed = true
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		})
+		return response, streamed, err
+	})
+}
+
+func (client *RetryingClient) do(ctx context.Context, model string, attempt func() (CompletionResponse, bool, error)) (CompletionResponse, error) {
+	for retry := 0; ; retry++ {
+		response, streamed, err := attempt()
+		if err == nil {
+			return response, nil
+		}
+
+		apiErr := ClassifyError(err)
+		if apiErr == nil || !apiErr.Retryable() || streamed || retry >= client.policy.MaxRetries {
+			return CompletionResponse{}, err
+		}
+
+		// A retry before Retry-After would be rejected again, so a provider
+		// asking for more than MaxDelay gets the error returned instead.
+		if apiErr.RetryAfter > client.policy.MaxDelay {
+			return CompletionResponse{}, err
+		}
+		delay := client.delay(retry, apiErr)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return CompletionResponse{}, err
+		}
+
+		if client.logger != nil {
+			client.logger.Warnf("event=llm_retry model=%s attempt=%d max_retries=%d kind=%s status=%d delay_ms=%d err=%q",
+				model, retry+1, client.policy.MaxRetries, apiErr.Kind, apiErr.StatusCode, delay.Milliseconds(), apiErr.Message)
+		}
+		if sleepErr := client.sleep(ctx, delay); sleepErr != nil {
+			return CompletionResponse{}, err
+		}
+	}
+}
+
+func (client *RetryingClient) delay(retry int, apiErr *APIError) time.Duration {
+	if apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+	delay := client.policy.BaseDelay << retry
+	if delay <= 0 || delay > client.policy.MaxDelay {
+		delay = client.policy.MaxDelay
+	}
+	return client.jitter(delay)
+}
+
+// equalJitter picks a delay between half and all of delay so that clients
+// backing off together spread out without retrying immediately.
+func equalJitter(delay time.Duration) time.Duration {
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + rand.N(half+1)
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
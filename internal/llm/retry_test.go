@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingClient struct {
+	errs  []error
+	calls int
+}
+
+func (client *failingClient) Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error) {
+	client.calls++
+	if client.calls <= len(client.errs) {
+		return CompletionResponse{}, client.errs[client.calls-1]
+	}
+	return CompletionResponse{Choices: []Choice{{FinishReason: "stop", Message: Message{Role: RoleAssistant, Content: "ok"}}}}, nil
+}
+
+type failingStreamClient struct {
+	failingClient
+	emitBeforeError bool
+}
+
+func (client *failingStreamClient) CompleteStream(ctx context.Context, request CompletionRequest, onDelta StreamHandler) (CompletionResponse, error) {
+	if client.emitBeforeError {
+		onDelta(StreamDelta{Content: "partial"})
+	}
+	return client.Complete(ctx, request)
+}
+
+type recordingRetryLogger struct {
+	lines []string
+}
+
+func (logger *recordingRetryLogger) Warnf(format string, args ...interface{}) {
+	logger.lines = append(logger.lines, fmt.Sprintf(format, args...))
+}
+
+func newTestRetryingClient(client Client, maxRetries int, logger RetryLogger) (*RetryingClient, *[]time.Duration) {
+	retrying := NewRetryingClient(client, RetryPolicy{MaxRetries: maxRetries, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, logger)
+	slept := []time.Duration{}
+	retrying.sleep = func(ctx context.Context, delay time.Duration) error {
+		slept = append(slept, delay)
+		return nil
+	}
+	retrying.jitter = func(delay time.Duration) time.Duration { return delay }
+	return retrying, &slept
+}
+
+func TestRetryingClient_RetriesRetryableErrorsWithBackoff(t *testing.T) {
+	inner := &failingClient{errs: []error{
+		NewHTTPError("test", http.StatusServiceUnavailable, nil, "unavailable"),
+		NewHTTPError("test", http.StatusTooManyRequests, http.Header{"Retry-After": []string{"1"}}, "slow down"),
+		NewHTTPError("test", 529, nil, "overloaded"),
+	}}
+	logger := &recordingRetryLogger{}
+	client, slept := newTestRetryingClient(inner, 3, logger)
+
+	response, err := client.Complete(context.Background(), CompletionRequest{Model: "m"})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	if response.Choices[0].Message.Content != "ok" || inner.calls != 4 {
+		t.Fatalf("expected success on fourth call, got %d calls and %+v", inner.calls, response)
+	}
+
+	expected := []time.Duration{100 * time.Millisecond, time.Second, 400 * time.Millisecond}
+	if fmt.Sprint(*slept) != fmt.Sprint(expected) {
+		t.Fatalf("expected delays %v, got %v", expected, *slept)
+	}
+	if len(logger.lines) != 3 || !strings.Contains(logger.lines[1], "event=llm_retry") || !strings.Contains(logger.lines[1], "kind=rate_limit") {
+		t.Fatalf("expected three llm_retry events, got %v", logger.lines)
+	}
+}
+
+func TestRetryingClient_DoesNotRetryNonRetryableErrors(t *testing.T) {
+	inner := &failingClient{errs: []error{NewHTTPError("test", http.StatusUnauthorized, nil, "bad key")}}
+	client, _ := newTestRetryingClient(inner, 3, nil)
+
+	_, err := client.Complete(context.Background(), CompletionRequest{Model: "m"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrorKindAuth {
+		t.Fatalf("expected auth APIError, got %v", err)
+	}
+	if inner.calls != 1 {
+		t.Fatalf("expected a single call, got %d", inner.calls)
+	}
+}
+
+func TestRetryingClient_GivesUpAfterMaxRetries(t *testing.T) {
+	overloaded := NewHTTPError("test", http.StatusBadGateway, nil, "bad gateway")
+	inner := &failingClient{errs: []error{overloaded, overloaded, overloaded}}
+	client, _ := newTestRetryingClient(inner, 2, nil)
+
+	_, err := client.Complete(context.Background(), CompletionRequest{Model: "m"})
+	if !errors.Is(err, overloaded) || inner.calls != 3 {
+		t.Fatalf("expected last error after 3 calls, got %v after %d calls", err, inner.calls)
+	}
+}
+
+func TestRetryingClient_StopsWhenDelayExceedsDeadline(t *testing.T) {
+	inner := &failingClient{errs: []error{NewHTTPError("test", http.StatusTooManyRequests, http.Header{"Retry-After": []string{"60"}}, "slow down")}}
+	client, slept := newTestRetryingClient(inner, 3, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := client.Complete(ctx, CompletionRequest{Model: "m"})
+	if err == nil || inner.calls != 1 || len(*slept) != 0 {
+		t.Fatalf("expected no retry past deadline, got err=%v calls=%d slept=%v", err, inner.calls, *slept)
+	}
+}
+
+func TestRetryingClient_GivesUpWhenRetryAfterExceedsMaxDelay(t *testing.T) {
+	limited := NewHTTPError("test", http.StatusTooManyRequests, http.Header{"Retry-After": []string{"3600"}}, "slow down")
+	inner := &failingClient{errs: []error{limited}}
+	client, slept := newTestRetryingClient(inner, 3, nil)
+
+	_, err := client.Complete(context.Background(), CompletionRequest{Model: "m"})
+	if !errors.Is(err, limited) || inner.calls != 1 || len(*slept) != 0 {
+		t.Fatalf("expected the error without waiting an hour, got err=%v calls=%d slept=%v", err, inner.calls, *slept)
+	}
+}
+
+func TestRetryingClient_DoesNotRetryAfterStreamingStarted(t *testing.T) {
+	overloaded := NewHTTPError("test", http.StatusServiceUnavailable, nil, "unavailable")
+	inner := &failingStreamClient{failingClient: failingClient{errs: []error{overloaded}}, emitBeforeError: true}
+	client, _ := newTestRetryingClient(inner, 3, nil)
+
+	_, err := client.CompleteStream(context.Background(), CompletionRequest{Model: "m"}, func(StreamDelta) {})
+	if err == nil || inner.calls != 1 {
+		t.Fatalf("expected streamed failure not to be retried, got err=%v calls=%d", err, inner.calls)
+	}
+
+	inner = &failingStreamClient{failingClient: failingClient{errs: []error{overloaded}}}
+	client, _ = newTestRetryingClient(inner, 3, nil)
+	if _, err := client.CompleteStream(context.Background(), CompletionRequest{Model: "m"}, func(StreamDelta) {}); err != nil || inner.calls != 2 {
+		t.Fatalf("expected retry before any delta, got err=%v calls=%d", err, inner.calls)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		kind      ErrorKind
+		retryable bool
+	}{
+		{"rate limit", NewHTTPError("p", 429, nil, "too many"), ErrorKindRateLimit, true},
+		{"overloaded", NewHTTPError("p", 529, nil, "overloaded_error: busy"), ErrorKindOverloaded, true},
+		{"auth", NewHTTPError("p", 401, nil, "invalid x-api-key"), ErrorKindAuth, false},
+		{"context length", NewHTTPError("p", 400, nil, "prompt is too long: 210000 tokens > 200000 maximum"), ErrorKindContextLength, false},
+		{"invalid request", NewHTTPError("p", 400, nil, "messages: field required"), ErrorKindInvalidRequest, false},
+		{"transport", fmt.Errorf("post: %w", &timeoutError{}), ErrorKindTransport, true},
+		{"unknown", errors.New("boom"), ErrorKindUnknown, false},
+	}
+
+	for _, test := range tests {
+		apiErr := ClassifyError(test.err)
+		if apiErr == nil || apiErr.Kind != test.kind || apiErr.Retryable() != test.retryable {
+			t.Fatalf("%s: expected kind %s retryable=%t, got %+v", test.name, test.kind, test.retryable, apiErr)
+		}
+	}
+
+	if ClassifyError(fmt.Errorf("wrapped: %w", context.Canceled)) != nil {
+		t.Fatal("expected cancellation to stay unclassified")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	if delay := parseRetryAfter(http.Header{"Retry-After": []string{"2"}}, now); delay != 2*time.Second {
+		t.Fatalf("expected 2s, got %v", delay)
+	}
+	if delay := parseRetryAfter(http.Header{"Retry-After-Ms": []string{"1500"}}, now); delay != 1500*time.Millisecond {
+		t.Fatalf("expected 1.5s, got %v", delay)
+	}
+	date := now.Add(10 * time.Second).Format(http.TimeFormat)
+	if delay := parseRetryAfter(http.Header{"Retry-After": []string{date}}, now); delay != 10*time.Second {
+		t.Fatalf("expected 10s from http date, got %v", delay)
+	}
+	if delay := parseRetryAfter(http.Header{"Retry-After": []string{"soon"}}, now); delay != 0 {
+		t.Fatalf("expected unparsable value to be ignored, got %v", delay)
+	}
+}
+
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "i/o timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
@@ -1,6 +1,10 @@
 package llm
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
 
 type Role string
 
@@ -23,28 +27,183 @@ type ToolCall struct {
 	Arguments string `json:"arguments"`
 }
 
+// Message is one entry of the conversation. Content holds its text; Parts
+// adds typed content such as images and follows Content when both are set.
+// Reasoning is the model's thinking for an assistant message, for display.
+// ReasoningBlocks keeps it as the provider returned it; adapters only send
+// those back to providers that require it.
 type Message struct {
-	Role       Role       `json:"role"`
-	Content    string     `json:"content,omitempty"`
-	ToolCallID string     `json:"tool_call_id,omitempty"`
-	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	Role            Role             `json:"role"`
+	Content         string           `json:"content,omitempty"`
+	Parts           []ContentPart    `json:"parts,omitempty"`
+	Reasoning       string           `json:"reasoning,omitempty"`
+	ReasoningBlocks []ReasoningBlock `json:"reasoning_blocks,omitempty"`
+	ToolCallID      string           `json:"tool_call_id,omitempty"`
+	ToolCalls       []ToolCall       `json:"tool_calls,omitempty"`
+
+	// Note marks a message added to a single request, such as a reminder,
+	// that is never part of the history. ClassifyTurn looks past notes.
+	Note bool `json:"-"`
+}
+
+// ReasoningBlock is one block of reasoning with what the provider needs to
+// verify it. Providers that check replayed reasoning, such as Anthropic with
+// thinking during tool use, need every block back unchanged and in order.
+type ReasoningBlock struct {
+	// Type is the provider's block type, such as "thinking",
+	// "redacted_thinking" or OpenRouter's "reasoning.text".
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// Data holds reasoning the provider returned encrypted.
+	Data string `json:"data,omitempty"`
+	// Raw is an OpenRouter reasoning detail exactly as received, which is
+	// sent back unchanged.
+	Raw json.RawMessage `json:"raw,omitempty"`
 }
 
 type CompletionRequest struct {
-	Model    string
-	Messages []Message
-	Tools    []ToolDefinition
+	Model    string           `json:"model"`
+	Messages []Message        `json:"messages"`
+	Tools    []ToolDefinition `json:"tools,omitempty"`
+	RequestOptions
+}
+
+// RequestOptions are optional sampling and tool-use settings. Nil and zero
+// values leave the provider default in place. Adapters drop settings their
+// provider does not support.
+type RequestOptions struct {
+	Temperature       *float64    `json:"temperature,omitempty"`
+	TopP              *float64    `json:"top_p,omitempty"`
+	MaxTokens         int         `json:"max_tokens,omitempty"`
+	Stop              []string    `json:"stop,omitempty"`
+	Seed              *int64      `json:"seed,omitempty"`
+	ToolChoice        *ToolChoice `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool       `json:"parallel_tool_calls,omitempty"`
+	// ResponseFormat asks for a final answer that is a JSON document matching
+	// a schema. Providers without native support are told so in the system
+	// prompt, so callers still need to validate the answer.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	// Reasoning enables thinking on models that support it.
+	Reasoning *ReasoningOptions `json:"reasoning,omitempty"`
+	// DisablePromptCache stops adapters from marking the system prompt, tool
+	// definitions and history as cacheable on providers that need explicit
+	// cache breakpoints.
+	DisablePromptCache bool `json:"disable_prompt_cache,omitempty"`
+}
+
+type ResponseFormat struct {
+	Name   string         `json:"name"`
+	Schema map[string]any `json:"schema"`
+}
+
+type ReasoningEffort string
+
+const (
+	ReasoningEffortLow    ReasoningEffort = "low"
+	ReasoningEffortMedium ReasoningEffort = "medium"
+	ReasoningEffortHigh   ReasoningEffort = "high"
+)
+
+// ReasoningOptions sets how much a model may think. Providers that take a
+// token budget use BudgetTokens, or one derived from Effort; providers that
+// take an effort level use Effort.
+type ReasoningOptions struct {
+	Effort       ReasoningEffort `json:"effort,omitempty"`
+	BudgetTokens int             `json:"budget_tokens,omitempty"`
+}
+
+var reasoningEffortBudgets = map[ReasoningEffort]int{
+	ReasoningEffortLow:    1024,
+	ReasoningEffortMedium: 4096,
+	ReasoningEffortHigh:   16384,
+}
+
+// Budget returns BudgetTokens, or the budget for Effort when it is not set.
+func (options *ReasoningOptions) Budget() int {
+	if options.BudgetTokens > 0 {
+		return options.BudgetTokens
+	}
+	if budget, ok := reasoningEffortBudgets[options.Effort]; ok {
+		return budget
+	}
+	return reasoningEffortBudgets[ReasoningEffortMedium]
+}
+
+type ToolChoiceMode string
+
+const (
+	ToolChoiceAuto     ToolChoiceMode = "auto"
+	ToolChoiceNone     ToolChoiceMode = "none"
+	ToolChoiceRequired ToolChoiceMode = "required"
+	// ToolChoiceTool forces the tool named in ToolChoice.Name.
+	ToolChoiceTool ToolChoiceMode = "tool"
+)
+
+type ToolChoice struct {
+	Mode ToolChoiceMode `json:"mode"`
+	Name string         `json:"name,omitempty"`
+}
+
+// ParseToolChoice accepts auto, none, required or a tool name. An empty value
+// yields nil.
+func ParseToolChoice(value string) *ToolChoice {
+	trimmed := strings.TrimSpace(value)
+	switch ToolChoiceMode(strings.ToLower(trimmed)) {
+	case "":
+		return nil
+	case ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+		return &ToolChoice{Mode: ToolChoiceMode(strings.ToLower(trimmed))}
+	default:
+		return &ToolChoice{Mode: ToolChoiceTool, Name: trimmed}
+	}
+}
+
+// Forces reports whether the choice makes the model call a tool.
+func (choice *ToolChoice) Forces() bool {
+	return choice != nil && (choice.Mode == ToolChoiceRequired || choice.Mode == ToolChoiceTool)
 }
 
 type Choice struct {
-	FinishReason string
-	Message      Message
+	FinishReason string  `json:"finish_reason"`
+	Message      Message `json:"message"`
 }
 
 type CompletionResponse struct {
-	Choices []Choice
+	Choices []Choice `json:"choices"`
+	Usage   Usage    `json:"usage"`
+	// Provider and Model identify the route that served the request when a
+	// FallbackClient or Router chose it; single-provider clients leave them
+	// empty.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
 }
 
 type Client interface {
 	Complete(ctx context.Context, request CompletionRequest) (CompletionResponse, error)
 }
+
+// ToolCallDelta reports the state of a streamed tool call. Arguments holds the
+// arguments assembled so far, not only the latest fragment.
+type ToolCallDelta struct {
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+type StreamDelta struct {
+	Content   string
+	Reasoning string
+	ToolCalls []ToolCallDelta
+}
+
+type StreamHandler func(delta StreamDelta)
+
+// StreamingClient is implemented by clients that can report partial output
+// while a completion is in flight. The returned response is the same fully
+// assembled response Complete would have produced.
+type StreamingClient interface {
+	Client
+	CompleteStream(ctx context.Context, request CompletionRequest, onDelta StreamHandler) (CompletionResponse, error)
+}
@@ -0,0 +1,65 @@
+package llm
+
+// Usage is the token accounting reported for one or more completions.
+// PromptTokens includes CachedTokens, which were read from the provider's
+// prompt cache, and CacheWriteTokens, which were written to it. Cost is in
+// USD and is either reported by the provider or estimated from a PriceTable.
+type Usage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens,omitempty"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost,omitempty"`
+}
+
+func (usage Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     usage.PromptTokens + other.PromptTokens,
+		CompletionTokens: usage.CompletionTokens + other.CompletionTokens,
+		CachedTokens:     usage.CachedTokens + other.CachedTokens,
+		CacheWriteTokens: usage.CacheWriteTokens + other.CacheWriteTokens,
+		TotalTokens:      usage.TotalTokens + other.TotalTokens,
+		Cost:             usage.Cost + other.Cost,
+	}
+}
+
+// ModelPrice holds USD prices per million tokens. CachedPromptPerMillion
+// and CacheWritePerMillion fall back to PromptPerMillion when zero.
+type ModelPrice struct {
+	PromptPerMillion       float64 `json:"prompt"`
+	CompletionPerMillion   float64 `json:"completion"`
+	CachedPromptPerMillion float64 `json:"cached_prompt,omitempty"`
+	CacheWritePerMillion   float64 `json:"cache_write,omitempty"`
+}
+
+// PriceTable maps model names to prices.
+type PriceTable map[string]ModelPrice
+
+// Cost estimates the USD cost of usage for model. It reports false when the
+// model has no entry in the table.
+func (table PriceTable) Cost(model string, usage Usage) (float64, bool) {
+	price, ok := table[model]
+	if !ok {
+		return 0, false
+	}
+
+	cachedPrice := price.CachedPromptPerMillion
+	if cachedPrice == 0 {
+		cachedPrice = price.PromptPerMillion
+	}
+	cacheWritePrice := price.CacheWritePerMillion
+	if cacheWritePrice == 0 {
+		cacheWritePrice = price.PromptPerMillion
+	}
+	uncachedPromptTokens := usage.PromptTokens - usage.CachedTokens - usage.CacheWriteTokens
+	if uncachedPromptTokens < 0 {
+		uncachedPromptTokens = 0
+	}
+
+	cost := float64(uncachedPromptTokens)*price.PromptPerMillion +
+		float64(usage.CachedTokens)*cachedPrice +
+		float64(usage.CacheWriteTokens)*cacheWritePrice +
+		float64(usage.CompletionTokens)*price.CompletionPerMillion
+	return cost / 1_000_000, true
+}
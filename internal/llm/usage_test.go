@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUsageAdd(t *testing.T) {
+	total := Usage{PromptTokens: 10, CompletionTokens: 5, CachedTokens: 2, TotalTokens: 15, Cost: 0.5}.
+		Add(Usage{PromptTokens: 20, CompletionTokens: 1, CacheWriteTokens: 8, TotalTokens: 21, Cost: 0.25})
+
+	expected := Usage{PromptTokens: 30, CompletionTokens: 6, CachedTokens: 2, CacheWriteTokens: 8, TotalTokens: 36, Cost: 0.75}
+	if total != expected {
+		t.Fatalf("expected %+v, got %+v", expected, total)
+	}
+}
+
+func TestPriceTableCost(t *testing.T) {
+	table := PriceTable{
+		"priced":   {PromptPerMillion: 1, CompletionPerMillion: 5, CachedPromptPerMillion: 0.1},
+		"uncached": {PromptPerMillion: 2, CompletionPerMillion: 4},
+	}
+
+	cost, ok := table.Cost("priced", Usage{PromptTokens: 1_000_000, CachedTokens: 500_000, CompletionTokens: 200_000})
+	if !ok {
+		t.Fatal("expected priced model to have a cost")
+	}
+	if math.Abs(cost-(0.5+0.05+1.0)) > 1e-9 {
+		t.Fatalf("expected cost 1.55, got %f", cost)
+	}
+
+	cost, ok = table.Cost("uncached", Usage{PromptTokens: 500_000, CachedTokens: 500_000})
+	if !ok || math.Abs(cost-1.0) > 1e-9 {
+		t.Fatalf("expected cached tokens billed at prompt price, got %f ok=%t", cost, ok)
+	}
+
+	table["written"] = ModelPrice{PromptPerMillion: 1, CachedPromptPerMillion: 0.1, CacheWritePerMillion: 1.25}
+	cost, _ = table.Cost("written", Usage{PromptTokens: 1_000_000, CachedTokens: 200_000, CacheWriteTokens: 400_000})
+	if math.Abs(cost-(0.4+0.02+0.5)) > 1e-9 {
+		t.Fatalf("expected cache writes billed at the write price, got %f", cost)
+	}
+
+	if _, ok := table.Cost("unknown", Usage{PromptTokens: 1}); ok {
+		t.Fatal("expected unknown model to have no cost")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
 )
 
 const defaultSessionsDir = ".shimibot/sessions"
@@ -20,6 +21,27 @@ var validSessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,127}
 type Store interface {
 	Load(sessionID string) ([]llm.Message, error)
 	Save(sessionID string, history []llm.Message) error
+	LoadMetadata(sessionID string) (Metadata, error)
+	SaveMetadata(sessionID string, metadata Metadata) error
+	// SaveSession writes history and metadata in a single write, without
+	// reading the session first, for saves after each turn and checkpoints
+	// while a run is in progress.
+	SaveSession(sessionID string, history []llm.Message, metadata Metadata) error
+}
+
+// Metadata is session state kept alongside the message history.
+type Metadata struct {
+	Usage llm.Usage `json:"usage"`
+	// Provider and Model record which route served the most recent turn.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Todos is the model's todo list and PlanMode whether the session is
+	// still waiting for the user to accept a plan.
+	Todos    []tools.TodoItem `json:"todos,omitempty"`
+	PlanMode bool             `json:"plan_mode,omitempty"`
+	// Interrupted is set while a run is checkpointed but has not finished,
+	// so a crash or kill leaves it set and the run can be resumed.
+	Interrupted bool `json:"interrupted,omitempty"`
 }
 
 type JSONFileStore struct {
@@ -29,6 +51,7 @@ type JSONFileStore struct {
 type sessionData struct {
 	SessionID string        `json:"session_id"`
 	Messages  []llm.Message `json:"messages"`
+	Metadata  Metadata      `json:"metadata"`
 }
 
 func DefaultSessionID(now time.Time) string {
@@ -69,37 +92,81 @@ func (store *JSONFileStore) sessionFilePath(sessionID string) (string, error) {
 }
 
 func (store *JSONFileStore) Load(sessionID string) ([]llm.Message, error) {
-	normalizedSessionID, err := normalizeSessionID(sessionID)
+	stored, err := store.read(sessionID)
 	if err != nil {
 		return nil, err
 	}
+	if stored.Messages == nil {
+		return []llm.Message{}, nil
+	}
+	return stored.Messages, nil
+}
 
+func (store *JSONFileStore) Save(sessionID string, history []llm.Message) error {
+	return store.update(sessionID, func(stored *sessionData) {
+		stored.Messages = history
+	})
+}
+
+func (store *JSONFileStore) LoadMetadata(sessionID string) (Metadata, error) {
+	stored, err := store.read(sessionID)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return stored.Metadata, nil
+}
+
+func (store *JSONFileStore) SaveMetadata(sessionID string, metadata Metadata) error {
+	return store.update(sessionID, func(stored *sessionData) {
+		stored.Metadata = metadata
+	})
+}
+
+func (store *JSONFileStore) SaveSession(sessionID string, history []llm.Message, metadata Metadata) error {
+	normalizedSessionID, err := normalizeSessionID(sessionID)
+	if err != nil {
+		return err
+	}
 	if normalizedSessionID == "" {
-		return []llm.Message{}, nil
+		return nil
+	}
+	return store.write(sessionData{SessionID: normalizedSessionID, Messages: history, Metadata: metadata})
+}
+
+func (store *JSONFileStore) read(sessionID string) (sessionData, error) {
+	normalizedSessionID, err := normalizeSessionID(sessionID)
+	if err != nil {
+		return sessionData{}, err
+	}
+
+	if normalizedSessionID == "" {
+		return sessionData{}, nil
 	}
 
 	path, err := store.sessionFilePath(normalizedSessionID)
 	if err != nil {
-		return nil, err
+		return sessionData{}, err
 	}
 
 	bytes, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return []llm.Message{}, nil
+			return sessionData{SessionID: normalizedSessionID}, nil
 		}
-		return nil, err
+		return sessionData{}, err
 	}
 
 	var stored sessionData
 	if err := json.Unmarshal(bytes, &stored); err != nil {
-		return nil, err
+		return sessionData{}, err
 	}
 
-	return stored.Messages, nil
+	return stored, nil
 }
 
-func (store *JSONFileStore) Save(sessionID string, history []llm.Message) error {
+// update rewrites the session file after applying mutate, so saving history
+// keeps metadata intact and vice versa.
+func (store *JSONFileStore) update(sessionID string, mutate func(stored *sessionData)) error {
 	normalizedSessionID, err := normalizeSessionID(sessionID)
 	if err != nil {
 		return err
@@ -109,12 +176,24 @@ func (store *JSONFileStore) Save(sessionID string, history []llm.Message) error
 		return nil
 	}
 
-	payload, err := json.MarshalIndent(sessionData{SessionID: normalizedSessionID, Messages: history}, "", "  ")
+	stored, err := store.read(normalizedSessionID)
 	if err != nil {
 		return err
 	}
+	mutate(&stored)
+	stored.SessionID = normalizedSessionID
+	return store.write(stored)
+}
 
-	path, err := store.sessionFilePath(normalizedSessionID)
+// write replaces the session file by renaming a fully written temporary
+// file, so a crash never leaves it half written.
+func (store *JSONFileStore) write(stored sessionData) error {
+	payload, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path, err := store.sessionFilePath(stored.SessionID)
 	if err != nil {
 		return err
 	}
@@ -123,5 +202,21 @@ func (store *JSONFileStore) Save(sessionID string, history []llm.Message) error
 		return err
 	}
 
-	return os.WriteFile(path, payload, 0o600)
+	temporary, err := os.CreateTemp(filepath.Dir(path), "."+stored.SessionID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	if _, err := temporary.Write(payload); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := temporary.Sync(); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), path)
 }
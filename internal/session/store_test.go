@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
 )
 
 func TestDefaultSessionID(t *testing.T) {
@@ -79,6 +80,105 @@ func TestSaveAndLoad_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestSaveMetadata_PreservedAcrossHistorySaves(t *testing.T) {
+	store := NewJSONFileStoreWithDir(t.TempDir())
+	usage := llm.Usage{PromptTokens: 120, CompletionTokens: 30, CachedTokens: 20, TotalTokens: 150, Cost: 0.0042}
+
+	if err := store.SaveMetadata("meta", Metadata{Usage: usage}); err != nil {
+		t.Fatalf("SaveMetadata returned error: %v", err)
+	}
+	if err := store.Save("meta", sampleHistory()); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	metadata, err := store.LoadMetadata("meta")
+	if err != nil {
+		t.Fatalf("LoadMetadata returned error: %v", err)
+	}
+	if metadata.Usage != usage {
+		t.Fatalf("expected usage %+v preserved, got %+v", usage, metadata.Usage)
+	}
+
+	loaded, err := store.Load("meta")
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(loaded) != 5 {
+		t.Fatalf("expected history preserved alongside metadata, got %d messages", len(loaded))
+	}
+}
+
+func TestSaveMetadata_RoundTripsTodosAndPlanMode(t *testing.T) {
+	store := NewJSONFileStoreWithDir(t.TempDir())
+	todos := []tools.TodoItem{
+		{Content: "read the handlers", Status: tools.TodoDone},
+		{Content: "rename the config field", Status: tools.TodoInProgress},
+	}
+
+	if err := store.SaveMetadata("todos", Metadata{Todos: todos, PlanMode: true}); err != nil {
+		t.Fatalf("SaveMetadata returned error: %v", err)
+	}
+	metadata, err := store.LoadMetadata("todos")
+	if err != nil {
+		t.Fatalf("LoadMetadata returned error: %v", err)
+	}
+	if len(metadata.Todos) != 2 || metadata.Todos[1] != todos[1] || !metadata.PlanMode {
+		t.Fatalf("expected todos and plan mode preserved, got %+v", metadata)
+	}
+}
+
+func TestSaveSession_WritesHistoryAndMetadataTogether(t *testing.T) {
+	dir := t.TempDir()
+	store := NewJSONFileStoreWithDir(dir)
+	if err := store.SaveSession("run", sampleHistory()[:3], Metadata{Model: "test-model", Interrupted: true}); err != nil {
+		t.Fatalf("SaveSession returned error: %v", err)
+	}
+	metadata, err := store.LoadMetadata("run")
+	if err != nil {
+		t.Fatalf("LoadMetadata returned error: %v", err)
+	}
+	if !metadata.Interrupted || metadata.Model != "test-model" {
+		t.Fatalf("expected the session marked interrupted with its metadata kept, got %+v", metadata)
+	}
+	history, err := store.Load("run")
+	if err != nil || len(history) != 3 {
+		t.Fatalf("expected the checkpointed history, got %d messages err=%v", len(history), err)
+	}
+
+	metadata.Interrupted = false
+	if err := store.SaveMetadata("run", metadata); err != nil {
+		t.Fatalf("SaveMetadata returned error: %v", err)
+	}
+	if metadata, _ := store.LoadMetadata("run"); metadata.Interrupted {
+		t.Fatal("expected saving metadata after the run to clear the mark")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected only the session file in the directory, got %d entries err=%v", len(entries), err)
+	}
+}
+
+func TestLoadMetadata_LegacySessionWithoutMetadata(t *testing.T) {
+	dir := t.TempDir()
+	store := NewJSONFileStoreWithDir(dir)
+	legacy := `{"session_id":"legacy","messages":[{"role":"user","content":"hi"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "legacy.json"), []byte(legacy), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+
+	metadata, err := store.LoadMetadata("legacy")
+	if err != nil {
+		t.Fatalf("LoadMetadata returned error: %v", err)
+	}
+	if metadata.Usage != (llm.Usage{}) {
+		t.Fatalf("expected zero usage for legacy session, got %+v", metadata.Usage)
+	}
+	history, err := store.Load("legacy")
+	if err != nil || len(history) != 1 {
+		t.Fatalf("expected legacy history to load, got %d messages err=%v", len(history), err)
+	}
+}
+
 func TestSave_EmptySessionIDNoop(t *testing.T) {
 	dir := t.TempDir()
 	store := NewJSONFileStoreWithDir(dir)
@@ -0,0 +1,325 @@
+// Package texttools lets models without native function calling use tools.
+// Tool definitions are rendered into the system prompt, tool calls are parsed
+// out of tagged JSON blocks in the model's text, and tool results are sent
+// back as user messages.
+package texttools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+	"github.com/adriankopytko/ShimiBot/internal/tools"
+)
+
+const (
+	callOpenTag  = "<tool_call>"
+	callCloseTag = "</tool_call>"
+)
+
+const instructionHeader = `# Tools
+
+You can call the tools listed below. To call a tool, reply with a block of this exact form:
+
+<tool_call>
+{"name": "<tool name>", "arguments": {<arguments as a JSON object>}}
+</tool_call>
+
+Emit one block per call; several blocks call several tools. After your tool calls, stop and wait: the results come back in a user message as <tool_result> blocks. When no tool is needed, answer normally without any block.`
+
+// Client wraps a client whose model has no native tool calling. Requests and
+// responses keep the usual llm shape, so the agent loop does not know the
+// difference.
+type Client struct {
+	inner llm.Client
+}
+
+func NewClient(inner llm.Client) *Client {
+	return &Client{inner: inner}
+}
+
+func (client *Client) Complete(ctx context.Context, request llm.CompletionRequest) (llm.CompletionResponse, error) {
+	response, err := client.inner.Complete(ctx, toTextRequest(request))
+	if err != nil {
+		return llm.CompletionResponse{}, err
+	}
+	return fromTextResponse(response), nil
+}
+
+// CompleteStream streams the answer text but holds back everything from the
+// first tool call block on, so raw protocol is never shown to the user.
+func (client *Client) CompleteStream(ctx context.Context, request llm.CompletionRequest, onDelta llm.StreamHandler) (llm.CompletionResponse, error) {
+	streamingClient, ok := client.inner.(llm.StreamingClient)
+	if !ok {
+		return client.Complete(ctx, request)
+	}
+	filter := &streamFilter{onDelta: onDelta}
+	response, err := streamingClient.CompleteStream(ctx, toTextRequest(request), filter.write)
+	filter.flush()
+	if err != nil {
+		return llm.CompletionResponse{}, err
+	}
+	return fromTextResponse(response), nil
+}
+
+// toTextRequest moves the tool definitions into the system prompt and
+// rewrites tool calls and results in the history as plain text.
+func toTextRequest(request llm.CompletionRequest) llm.CompletionRequest {
+	definitions := selectTools(request.Tools, request.ToolChoice)
+	instructions := renderInstructions(definitions, request.ToolChoice)
+
+	converted := request
+	converted.Tools = nil
+	converted.ToolChoice = nil
+	converted.ParallelToolCalls = nil
+	converted.Messages = toTextMessages(request.Messages)
+	if instructions == "" {
+		return converted
+	}
+	if len(converted.Messages) > 0 && converted.Messages[0].Role == llm.RoleSystem {
+		converted.Messages[0].Content = strings.TrimSpace(converted.Messages[0].Content + "\n\n" + instructions)
+	} else {
+		converted.Messages = append([]llm.Message{{Role: llm.RoleSystem, Content: instructions}}, converted.Messages...)
+	}
+	return converted
+}
+
+// selectTools applies tool_choice: "none" offers no tools and a named tool is
+// offered on its own.
+func selectTools(definitions []llm.ToolDefinition, choice *llm.ToolChoice) []llm.ToolDefinition {
+	if choice == nil {
+		return definitions
+	}
+	switch choice.Mode {
+	case llm.ToolChoiceNone:
+		return nil
+	case llm.ToolChoiceTool:
+		for _, definition := range definitions {
+			if definition.Name == choice.Name {
+				return []llm.ToolDefinition{definition}
+			}
+		}
+	}
+	return definitions
+}
+
+func renderInstructions(definitions []llm.ToolDefinition, choice *llm.ToolChoice) string {
+	if len(definitions) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteString(instructionHeader)
+	if choice.Forces() {
+		builder.WriteString("\n\nYou must call a tool in your next reply.")
+	}
+	builder.WriteString("\n\nAvailable tools:")
+	for _, definition := range definitions {
+		fmt.Fprintf(&builder, "\n\n## %s\n", definition.Name)
+		if description := strings.TrimSpace(definition.Description); description != "" {
+			builder.WriteString(description + "\n")
+		}
+		parameters, err := json.Marshal(definition.Parameters)
+		if err != nil || definition.Parameters == nil {
+			parameters = []byte(`{"type":"object"}`)
+		}
+		fmt.Fprintf(&builder, "Arguments (JSON Schema): %s", parameters)
+	}
+	return builder.String()
+}
+
+// toTextMessages renders assistant tool calls as tool call blocks and turns
+// each run of tool results into one user message.
+func toTextMessages(messages []llm.Message) []llm.Message {
+	toolNames := map[string]string{}
+	result := make([]llm.Message, 0, len(messages))
+	resultsIndex := -1
+	for _, message := range messages {
+		switch message.Role {
+		case llm.RoleAssistant:
+			if len(message.ToolCalls) == 0 {
+				result = append(result, message)
+				continue
+			}
+			blocks := make([]string, 0, len(message.ToolCalls)+1)
+			if text := strings.TrimSpace(message.Content); text != "" {
+				blocks = append(blocks, text)
+			}
+			for _, toolCall := range message.ToolCalls {
+				toolNames[toolCall.ID] = toolCall.Name
+				blocks = append(blocks, renderToolCall(toolCall))
+			}
+			converted := message
+			converted.Content = strings.Join(blocks, "\n")
+			converted.ToolCalls = nil
+			result = append(result, converted)
+		case llm.RoleTool:
+			rendered := fmt.Sprintf("<tool_result name=%q id=%q>\n%s\n</tool_result>", toolNames[message.ToolCallID], message.ToolCallID, message.Content)
+			if resultsIndex == len(result)-1 && resultsIndex >= 0 {
+				result[resultsIndex].Content += "\n" + rendered
+				result[resultsIndex].Parts = append(result[resultsIndex].Parts, message.Parts...)
+				continue
+			}
+			resultsIndex = len(result)
+			result = append(result, llm.Message{
+				Role:    llm.RoleUser,
+				Content: rendered,
+				Parts:   append([]llm.ContentPart(nil), message.Parts...),
+			})
+		default:
+			result = append(result, message)
+		}
+	}
+	return result
+}
+
+func renderToolCall(toolCall llm.ToolCall) string {
+	arguments, valid := tools.NormalizeJSONArguments(toolCall.Arguments)
+	if !valid {
+		arguments = "{}"
+	}
+	name, _ := json.Marshal(toolCall.Name)
+	return fmt.Sprintf("%s\n{\"name\": %s, \"arguments\": %s}\n%s", callOpenTag, name, arguments, callCloseTag)
+}
+
+// fromTextResponse turns tool call blocks in each choice's text into tool
+// calls.
+func fromTextResponse(response llm.CompletionResponse) llm.CompletionResponse {
+	choices := make([]llm.Choice, 0, len(response.Choices))
+	for _, choice := range response.Choices {
+		text, toolCalls := ParseToolCalls(choice.Message.Content)
+		if len(toolCalls) > 0 {
+			choice.Message.Content = text
+			choice.Message.ToolCalls = append(choice.Message.ToolCalls, toolCalls...)
+			choice.FinishReason = "tool_calls"
+		}
+		choices = append(choices, choice)
+	}
+	response.Choices = choices
+	return response
+}
+
+// ParseToolCalls extracts the tool call blocks from text and returns the
+// remaining text with the calls. An unterminated last block is accepted, since
+// models often stop right after it. Blocks without a recognizable tool name
+// are left in the text.
+func ParseToolCalls(text string) (string, []llm.ToolCall) {
+	var remaining strings.Builder
+	toolCalls := make([]llm.ToolCall, 0)
+	rest := text
+	for {
+		start := strings.Index(rest, callOpenTag)
+		if start < 0 {
+			remaining.WriteString(rest)
+			break
+		}
+		remaining.WriteString(rest[:start])
+		body := rest[start+len(callOpenTag):]
+		block := rest[start:]
+		rest = ""
+		if end := strings.Index(body, callCloseTag); end >= 0 {
+			rest = body[end+len(callCloseTag):]
+			block = block[:len(callOpenTag)+end+len(callCloseTag)]
+			body = body[:end]
+		}
+
+		toolCall, ok := parseToolCall(body)
+		if !ok {
+			remaining.WriteString(block)
+			continue
+		}
+		toolCalls = append(toolCalls, toolCall)
+	}
+	return strings.TrimSpace(remaining.String()), toolCalls
+}
+
+func parseToolCall(body string) (llm.ToolCall, bool) {
+	normalized, valid := tools.NormalizeJSONArguments(body)
+	if !valid {
+		return llm.ToolCall{}, false
+	}
+	var decoded struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal([]byte(normalized), &decoded); err != nil || strings.TrimSpace(decoded.Name) == "" {
+		return llm.ToolCall{}, false
+	}
+
+	// Some models send the arguments as a JSON string; the runner repairs
+	// or rejects whatever is left.
+	arguments := strings.TrimSpace(string(decoded.Arguments))
+	var quoted string
+	if json.Unmarshal(decoded.Arguments, &quoted) == nil {
+		arguments = quoted
+	}
+	if arguments == "" || arguments == "null" {
+		arguments = "{}"
+	}
+	return llm.ToolCall{ID: newToolCallID(), Name: strings.TrimSpace(decoded.Name), Arguments: arguments}, true
+}
+
+// newToolCallID assigns the ids the rest of the program pairs tool results
+// by; text tool calls have none.
+func newToolCallID() string {
+	bytes := make([]byte, 6)
+	if _, err := rand.Read(bytes); err != nil {
+		return fmt.Sprintf("call_%d", time.Now().UnixNano())
+	}
+	return "call_" + hex.EncodeToString(bytes)
+}
+
+// streamFilter forwards streamed text until a tool call block starts. Text
+// that could be the start of the opening tag is held back until it is known
+// not to be.
+type streamFilter struct {
+	onDelta llm.StreamHandler
+	pending string
+	inCall  bool
+}
+
+func (filter *streamFilter) write(delta llm.StreamDelta) {
+	if filter.onDelta == nil {
+		return
+	}
+	if delta.Reasoning != "" {
+		filter.onDelta(llm.StreamDelta{Reasoning: delta.Reasoning})
+	}
+	if delta.Content == "" || filter.inCall {
+		return
+	}
+
+	text := filter.pending + delta.Content
+	filter.pending = ""
+	if start := strings.Index(text, callOpenTag); start >= 0 {
+		filter.inCall = true
+		filter.emit(text[:start])
+		return
+	}
+	held := 0
+	for length := min(len(text), len(callOpenTag)-1); length > 0; length-- {
+		if strings.HasSuffix(text, callOpenTag[:length]) {
+			held = length
+			break
+		}
+	}
+	filter.pending = text[len(text)-held:]
+	filter.emit(text[:len(text)-held])
+}
+
+func (filter *streamFilter) flush() {
+	if !filter.inCall {
+		filter.emit(filter.pending)
+	}
+	filter.pending = ""
+}
+
+func (filter *streamFilter) emit(text string) {
+	if text != "" && filter.onDelta != nil {
+		filter.onDelta(llm.StreamDelta{Content: text})
+	}
+}
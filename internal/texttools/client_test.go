@@ -0,0 +1,124 @@
+package texttools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+type scriptedClient struct {
+	replies  []string
+	requests []llm.CompletionRequest
+}
+
+func (client *scriptedClient) Complete(ctx context.Context, request llm.CompletionRequest) (llm.CompletionResponse, error) {
+	client.requests = append(client.requests, request)
+	reply := client.replies[0]
+	client.replies = client.replies[1:]
+	return llm.CompletionResponse{Choices: []llm.Choice{{
+		FinishReason: "stop",
+		Message:      llm.Message{Role: llm.RoleAssistant, Content: reply},
+	}}}, nil
+}
+
+func (client *scriptedClient) CompleteStream(ctx context.Context, request llm.CompletionRequest, onDelta llm.StreamHandler) (llm.CompletionResponse, error) {
+	for _, chunk := range strings.SplitAfter(client.replies[0], "<") {
+		onDelta(llm.StreamDelta{Content: chunk})
+	}
+	return client.Complete(ctx, request)
+}
+
+var readTool = llm.ToolDefinition{
+	Name:        "Read",
+	Description: "Read a file",
+	Parameters:  map[string]any{"type": "object", "properties": map[string]any{"file_path": map[string]any{"type": "string"}}},
+}
+
+func TestClient_RendersToolsAndHistoryAsText(t *testing.T) {
+	inner := &scriptedClient{replies: []string{"done"}}
+	request := llm.CompletionRequest{
+		Model: "phi3",
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: "system"},
+			{Role: llm.RoleUser, Content: "read both"},
+			{Role: llm.RoleAssistant, Content: "Reading.", ToolCalls: []llm.ToolCall{
+				{ID: "call_1", Name: "Read", Arguments: `{"file_path":"a.go"}`},
+				{ID: "call_2", Name: "Read", Arguments: `{"file_path":"b.go"}`},
+			}},
+			{Role: llm.RoleTool, ToolCallID: "call_1", Content: "package a"},
+			{Role: llm.RoleTool, ToolCallID: "call_2", Content: "package b"},
+		},
+		Tools:          []llm.ToolDefinition{readTool},
+		RequestOptions: llm.RequestOptions{ToolChoice: &llm.ToolChoice{Mode: llm.ToolChoiceRequired}},
+	}
+
+	if _, err := NewClient(inner).Complete(context.Background(), request); err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	sent := inner.requests[0]
+	if len(sent.Tools) != 0 || sent.ToolChoice != nil {
+		t.Fatalf("expected native tools removed, got %+v", sent.Tools)
+	}
+	if len(sent.Messages) != 4 {
+		t.Fatalf("expected tool results merged into one user message, got %d messages", len(sent.Messages))
+	}
+	system := sent.Messages[0].Content
+	if !strings.HasPrefix(system, "system\n\n# Tools") || !strings.Contains(system, "## Read\nRead a file") || !strings.Contains(system, "You must call a tool") {
+		t.Fatalf("unexpected system prompt %q", system)
+	}
+	if assistant := sent.Messages[2]; len(assistant.ToolCalls) != 0 || !strings.Contains(assistant.Content, `{"name": "Read", "arguments": {"file_path":"b.go"}}`) {
+		t.Fatalf("expected tool calls rendered as text, got %+v", assistant)
+	}
+	results := sent.Messages[3]
+	if results.Role != llm.RoleUser || !strings.Contains(results.Content, `<tool_result name="Read" id="call_2">`+"\npackage b\n") {
+		t.Fatalf("expected tool results as user message, got %+v", results)
+	}
+	if len(request.Messages[2].ToolCalls) != 2 || request.Messages[0].Content != "system" {
+		t.Fatal("expected the caller's messages left untouched")
+	}
+}
+
+func TestClient_ParsesToolCallsFromText(t *testing.T) {
+	inner := &scriptedClient{replies: []string{"Let me look.\n<tool_call>\n```json\n{\"name\": \"Read\", \"arguments\": {\"file_path\": \"a.go\"}}\n```\n</tool_call>\n" +
+		"<tool_call>{\"name\": \"Read\", \"arguments\": \"{\\\"file_path\\\": \\\"b.go\\\"}\"}"}}
+
+	response, err := NewClient(inner).Complete(context.Background(), llm.CompletionRequest{Tools: []llm.ToolDefinition{readTool}})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	choice := response.Choices[0]
+	if choice.FinishReason != "tool_calls" || choice.Message.Content != "Let me look." {
+		t.Fatalf("unexpected choice %+v", choice)
+	}
+	calls := choice.Message.ToolCalls
+	if len(calls) != 2 || calls[0].Name != "Read" || calls[1].Arguments != `{"file_path": "b.go"}` || calls[0].ID == "" || calls[0].ID == calls[1].ID {
+		t.Fatalf("unexpected tool calls %+v", calls)
+	}
+}
+
+func TestParseToolCalls_LeavesUnrecognizedBlocksInText(t *testing.T) {
+	text, calls := ParseToolCalls("Use <tool_call>not json</tool_call> like this.")
+	if len(calls) != 0 || text != "Use <tool_call>not json</tool_call> like this." {
+		t.Fatalf("expected text unchanged, got %q %+v", text, calls)
+	}
+}
+
+func TestClient_StreamHidesToolCallBlocks(t *testing.T) {
+	inner := &scriptedClient{replies: []string{"Checking a < b first. <tool_call>{\"name\": \"Read\"}</tool_call>"}}
+	streamed := ""
+
+	response, err := NewClient(inner).CompleteStream(context.Background(), llm.CompletionRequest{}, func(delta llm.StreamDelta) {
+		streamed += delta.Content
+	})
+	if err != nil {
+		t.Fatalf("CompleteStream returned error: %v", err)
+	}
+	if streamed != "Checking a < b first. " {
+		t.Fatalf("unexpected streamed text %q", streamed)
+	}
+	if calls := response.Choices[0].Message.ToolCalls; len(calls) != 1 || calls[0].Arguments != "{}" {
+		t.Fatalf("unexpected tool calls %+v", calls)
+	}
+}
@@ -37,6 +37,12 @@ func (BashTool) Name() string {
 	return "Bash"
 }
 
+// ConcurrencyUnsafe reports true because a command may change any file the
+// other calls of the turn are working with.
+func (BashTool) ConcurrencyUnsafe() bool {
+	return true
+}
+
 func (tool BashTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        tool.Name(),
@@ -80,11 +86,17 @@ func (BashTool) Execute(ctx ToolContext, arguments string) (any, error) {
 	if strings.TrimSpace(ctx.CWD) != "" {
 		cmd.Dir = ctx.CWD
 	}
+	// Background processes the command started can hold its output open
+	// after it is killed; stop waiting for them so a cancel returns promptly.
+	cmd.WaitDelay = time.Second
 
 	output, err := cmd.CombinedOutput()
 	if commandCtx.Err() == context.DeadlineExceeded {
 		return "", fmt.Errorf("bash command timed out after %s", timeout)
 	}
+	if commandCtx.Err() == context.Canceled {
+		return "", fmt.Errorf("bash command cancelled")
+	}
 	if err != nil {
 		return "", fmt.Errorf("error executing bash command: %w", err)
 	}
@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// diffContextLines is how many unchanged lines surround each hunk.
+	diffContextLines = 3
+	// maxDiffCells bounds the line comparison table; larger changes are
+	// shown as a full replacement.
+	maxDiffCells = 4_000_000
+)
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// UnifiedDiff renders the change from before to after as a unified diff of
+// path. It returns "" when the contents are equal.
+func UnifiedDiff(path, before, after string) string {
+	if before == after {
+		return ""
+	}
+	lines := diffLines(splitLines(before), splitLines(after))
+
+	// oldLine and newLine hold the 1-based line numbers at each position.
+	oldLine := make([]int, len(lines)+1)
+	newLine := make([]int, len(lines)+1)
+	oldLine[0], newLine[0] = 1, 1
+	for index, line := range lines {
+		oldLine[index+1], newLine[index+1] = oldLine[index], newLine[index]
+		if line.kind != '+' {
+			oldLine[index+1]++
+		}
+		if line.kind != '-' {
+			newLine[index+1]++
+		}
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "--- a/%s\n+++ b/%s\n", path, path)
+	for index := 0; index < len(lines); {
+		if lines[index].kind == ' ' {
+			index++
+			continue
+		}
+		lastChange := index
+		for next := index; next < len(lines) && next-lastChange <= 2*diffContextLines; next++ {
+			if lines[next].kind != ' ' {
+				lastChange = next
+			}
+		}
+		start := max(index-diffContextLines, 0)
+		end := min(lastChange+diffContextLines+1, len(lines))
+		fmt.Fprintf(&builder, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[end]-oldLine[start]), hunkRange(newLine[start], newLine[end]-newLine[start]))
+		for _, line := range lines[start:end] {
+			builder.WriteByte(line.kind)
+			builder.WriteString(line.text)
+			builder.WriteByte('\n')
+		}
+		index = end
+	}
+	return builder.String()
+}
+
+// hunkRange formats a hunk's "start,count"; an empty range names the line
+// before it, as in "-0,0" for a new file.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines aligns before and after on their longest common subsequence of
+// lines, after setting aside the common prefix and suffix.
+func diffLines(before, after []string) []diffLine {
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(before)+len(after))
+	for _, text := range before[:prefix] {
+		lines = append(lines, diffLine{' ', text})
+	}
+	lines = append(lines, diffMiddle(before[prefix:len(before)-suffix], after[prefix:len(after)-suffix])...)
+	for _, text := range before[len(before)-suffix:] {
+		lines = append(lines, diffLine{' ', text})
+	}
+	return lines
+}
+
+func diffMiddle(before, after []string) []diffLine {
+	lines := make([]diffLine, 0, len(before)+len(after))
+	if len(before)*len(after) > maxDiffCells {
+		for _, text := range before {
+			lines = append(lines, diffLine{'-', text})
+		}
+		for _, text := range after {
+			lines = append(lines, diffLine{'+', text})
+		}
+		return lines
+	}
+
+	// common[i][j] is the length of the longest common subsequence of
+	// before[i:] and after[j:].
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			lines = append(lines, diffLine{' ', before[i]})
+			i++
+			j++
+		case j < len(after) && (i == len(before) || common[i][j+1] > common[i+1][j]):
+			lines = append(lines, diffLine{'+', after[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', before[i]})
+			i++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,18 @@
+package tools
+
+import "testing"
+
+func TestUnifiedDiff_GroupsChangesIntoHunks(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\no\n"
+
+	expected := "--- a/letters.txt\n+++ b/letters.txt\n" +
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+		"@@ -12,3 +12,4 @@\n l\n m\n n\n+o\n"
+	if diff := UnifiedDiff("letters.txt", before, after); diff != expected {
+		t.Fatalf("unexpected diff:\n%s", diff)
+	}
+	if diff := UnifiedDiff("letters.txt", before, before); diff != "" {
+		t.Fatalf("expected no diff for equal content, got %q", diff)
+	}
+}
@@ -22,6 +22,11 @@ func (EditPatchTool) Name() string {
 	return "EditPatch"
 }
 
+// ConcurrencyUnsafe keeps edits from racing reads of the same file.
+func (EditPatchTool) ConcurrencyUnsafe() bool {
+	return true
+}
+
 func (tool EditPatchTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        tool.Name(),
@@ -52,51 +57,89 @@ func (tool EditPatchTool) Definition() llm.ToolDefinition {
 }
 
 func (EditPatchTool) Execute(ctx ToolContext, arguments string) (any, error) {
+	args, resolvedPath, err := parseEditPatchArgs(ctx, arguments)
+	if err != nil {
+		return "", err
+	}
+	edit, err := applyEditPatch(args, resolvedPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(resolvedPath, []byte(edit.newContent), 0644); err != nil {
+		return "", fmt.Errorf("error writing file: %w", err)
+	}
+
+	return map[string]interface{}{
+		"file_path":     args.FilePath,
+		"replacements":  edit.replacements,
+		"replace_all":   args.ReplaceAll,
+		"total_matches": edit.occurrences,
+	}, nil
+}
+
+// Preview shows the edit as a diff without writing the file.
+func (EditPatchTool) Preview(ctx ToolContext, arguments string) (string, error) {
+	args, resolvedPath, err := parseEditPatchArgs(ctx, arguments)
+	if err != nil {
+		return "", err
+	}
+	edit, err := applyEditPatch(args, resolvedPath)
+	if err != nil {
+		return "", err
+	}
+	if diff := UnifiedDiff(args.FilePath, edit.content, edit.newContent); diff != "" {
+		return diff, nil
+	}
+	return "no changes to " + args.FilePath, nil
+}
+
+type editPatchResult struct {
+	content      string
+	newContent   string
+	occurrences  int
+	replacements int
+}
+
+func parseEditPatchArgs(ctx ToolContext, arguments string) (editPatchArgs, string, error) {
 	var args editPatchArgs
 	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
-		return "", fmt.Errorf("error parsing arguments: %w", err)
+		return editPatchArgs{}, "", fmt.Errorf("error parsing arguments: %w", err)
 	}
 
 	args.FilePath = strings.TrimSpace(args.FilePath)
 	if args.FilePath == "" {
-		return "", fmt.Errorf("file_path must be a non-empty string")
+		return editPatchArgs{}, "", fmt.Errorf("file_path must be a non-empty string")
 	}
 	if args.OldString == "" {
-		return "", fmt.Errorf("old_string must be a non-empty string")
+		return editPatchArgs{}, "", fmt.Errorf("old_string must be a non-empty string")
 	}
 	resolvedPath := ResolvePath(ctx, args.FilePath)
 	if err := EnsurePathAllowed(ctx, resolvedPath); err != nil {
-		return "", fmt.Errorf("path policy violation: %w", err)
+		return editPatchArgs{}, "", fmt.Errorf("path policy violation: %w", err)
 	}
+	return args, resolvedPath, nil
+}
 
+// applyEditPatch reads the file and computes its content after the edit.
+func applyEditPatch(args editPatchArgs, resolvedPath string) (editPatchResult, error) {
 	contentBytes, err := os.ReadFile(resolvedPath)
 	if err != nil {
-		return "", fmt.Errorf("error reading file: %w", err)
+		return editPatchResult{}, fmt.Errorf("error reading file: %w", err)
 	}
 
 	content := string(contentBytes)
 	occurrences := strings.Count(content, args.OldString)
 	if occurrences == 0 {
-		return "", fmt.Errorf("old_string not found in file")
+		return editPatchResult{}, fmt.Errorf("old_string not found in file")
 	}
 
-	newContent := content
-	replacements := 1
+	edit := editPatchResult{content: content, occurrences: occurrences, replacements: 1}
 	if args.ReplaceAll {
-		newContent = strings.ReplaceAll(content, args.OldString, args.NewString)
-		replacements = occurrences
+		edit.newContent = strings.ReplaceAll(content, args.OldString, args.NewString)
+		edit.replacements = occurrences
 	} else {
-		newContent = strings.Replace(content, args.OldString, args.NewString, 1)
+		edit.newContent = strings.Replace(content, args.OldString, args.NewString, 1)
 	}
-
-	if err := os.WriteFile(resolvedPath, []byte(newContent), 0644); err != nil {
-		return "", fmt.Errorf("error writing file: %w", err)
-	}
-
-	return map[string]interface{}{
-		"file_path":     args.FilePath,
-		"replacements":  replacements,
-		"replace_all":   args.ReplaceAll,
-		"total_matches": occurrences,
-	}, nil
+	return edit, nil
 }
@@ -31,6 +31,10 @@ func (FetchWebPageTool) Name() string {
 	return "FetchWebPage"
 }
 
+func (FetchWebPageTool) ReadOnly() bool {
+	return true
+}
+
 func (tool FetchWebPageTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        tool.Name(),
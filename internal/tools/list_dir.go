@@ -24,6 +24,10 @@ func (ListDirTool) Name() string {
 	return "ListDir"
 }
 
+func (ListDirTool) ReadOnly() bool {
+	return true
+}
+
 func (tool ListDirTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        tool.Name(),
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/adriankopytko/ShimiBot/internal/llm"
@@ -11,6 +12,34 @@ import (
 
 type ReadTool struct{}
 
+// maxReadMediaBytes keeps attachments within the image size limits the
+// providers accept.
+const maxReadMediaBytes = 5 << 20
+
+// readMediaTypes lists the files Read returns as content parts instead of
+// text.
+var readMediaTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+}
+
+// readMediaResult describes an image or document in the envelope and hands
+// the file itself to the model as a content part.
+type readMediaResult struct {
+	FilePath  string `json:"file_path"`
+	MediaType string `json:"media_type"`
+	Bytes     int    `json:"bytes"`
+	part      llm.ContentPart
+}
+
+func (result readMediaResult) ContentParts() []llm.ContentPart {
+	return []llm.ContentPart{result.part}
+}
+
 type readArgs struct {
 	FilePath string `json:"file_path"`
 }
@@ -19,10 +48,14 @@ func (ReadTool) Name() string {
 	return "Read"
 }
 
+func (ReadTool) ReadOnly() bool {
+	return true
+}
+
 func (tool ReadTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        tool.Name(),
-		Description: "Read and return the contents of a file",
+		Description: "Read and return the contents of a file. Images (png, jpg, gif, webp) and PDFs are attached for the model to view",
 		Parameters: map[string]any{
 			"type": "object",
 			"properties": map[string]any{
@@ -56,5 +89,17 @@ func (ReadTool) Execute(ctx ToolContext, arguments string) (any, error) {
 		return "", fmt.Errorf("error reading file: %w", err)
 	}
 
-	return string(content), nil
+	mediaType, isMedia := readMediaTypes[strings.ToLower(filepath.Ext(resolvedPath))]
+	if !isMedia {
+		return string(content), nil
+	}
+	if len(content) > maxReadMediaBytes {
+		return "", fmt.Errorf("file is %d bytes; attachments are limited to %d bytes", len(content), maxReadMediaBytes)
+	}
+
+	part := llm.ImagePart(mediaType, content)
+	if !strings.HasPrefix(mediaType, "image/") {
+		part = llm.FilePart(filepath.Base(resolvedPath), mediaType, content)
+	}
+	return readMediaResult{FilePath: args.FilePath, MediaType: mediaType, Bytes: len(content), part: part}, nil
 }
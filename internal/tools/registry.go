@@ -15,6 +15,33 @@ type Tool interface {
 	Execute(ctx ToolContext, arguments string) (any, error)
 }
 
+// ContentResult is implemented by tool results that carry content the model
+// should see directly, such as an image read from the workspace. The result
+// itself is still encoded into the envelope as usual.
+type ContentResult interface {
+	ContentParts() []llm.ContentPart
+}
+
+// ConcurrencyUnsafe is implemented by tools that must not run at the same
+// time as other tool calls, such as tools that change the workspace. Tools
+// without it may run concurrently.
+type ConcurrencyUnsafe interface {
+	ConcurrencyUnsafe() bool
+}
+
+// ReadOnly is implemented by tools that never change the workspace, such as
+// reading files or searching the web, so an approval policy and plan mode
+// may run them without asking. Tools without it are treated as mutating.
+type ReadOnly interface {
+	ReadOnly() bool
+}
+
+// Previewer is implemented by tools that can describe what a call would
+// change before it runs, such as a diff of a file edit.
+type Previewer interface {
+	Preview(ctx ToolContext, arguments string) (string, error)
+}
+
 type Registry struct {
 	tools map[string]Tool
 }
@@ -39,13 +66,36 @@ func DefaultRegistry() *Registry {
 	)
 }
 
-func (registry *Registry) Definitions() []llm.ToolDefinition {
+// Register adds tool, replacing any tool with the same name.
+func (registry *Registry) Register(tool Tool) {
+	registry.tools[tool.Name()] = tool
+}
+
+// Subset returns a registry with only the named tools.
+func (registry *Registry) Subset(names ...string) (*Registry, error) {
+	subset := make([]Tool, 0, len(names))
+	for _, name := range names {
+		tool, ok := registry.tools[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q (available: %s)", name, strings.Join(registry.Names(), ", "))
+		}
+		subset = append(subset, tool)
+	}
+	return NewRegistry(subset...), nil
+}
+
+// Names returns the registered tool names in sorted order.
+func (registry *Registry) Names() []string {
 	names := make([]string, 0, len(registry.tools))
 	for name := range registry.tools {
 		names = append(names, name)
 	}
 	sort.Strings(names)
+	return names
+}
 
+func (registry *Registry) Definitions() []llm.ToolDefinition {
+	names := registry.Names()
 	defs := make([]llm.ToolDefinition, 0, len(names))
 	for _, name := range names {
 		defs = append(defs, registry.tools[name].Definition())
@@ -53,10 +103,49 @@ func (registry *Registry) Definitions() []llm.ToolDefinition {
 	return defs
 }
 
+// ConcurrencySafe reports whether calls to the named tool may run alongside
+// other tool calls. Unknown tools only produce an error and are safe.
+func (registry *Registry) ConcurrencySafe(name string) bool {
+	unsafe, ok := registry.tools[name].(ConcurrencyUnsafe)
+	return !ok || !unsafe.ConcurrencyUnsafe()
+}
+
+// ReadOnly reports whether name is a tool known not to change the
+// workspace. Unknown tools are not read-only.
+func (registry *Registry) ReadOnly(name string) bool {
+	readOnly, ok := registry.tools[name].(ReadOnly)
+	return ok && readOnly.ReadOnly()
+}
+
+// Preview describes what toolCall would change. It reports false when the
+// tool has no preview or the arguments cannot be previewed.
+func (registry *Registry) Preview(toolCall llm.ToolCall, toolContext ToolContext) (string, bool) {
+	previewer, ok := registry.tools[toolCall.Name].(Previewer)
+	if !ok {
+		return "", false
+	}
+	normalizedArguments, valid := NormalizeJSONArguments(toolCall.Arguments)
+	if !valid {
+		return "", false
+	}
+	preview, err := previewer.Preview(toolContext, normalizedArguments)
+	if err != nil {
+		return "", false
+	}
+	return preview, true
+}
+
 func (registry *Registry) Execute(toolCall llm.ToolCall, toolContext ToolContext) (string, bool) {
+	output, _, matched := registry.ExecuteWithParts(toolCall, toolContext)
+	return output, matched
+}
+
+// ExecuteWithParts is Execute for callers that can forward content parts
+// returned by a ContentResult.
+func (registry *Registry) ExecuteWithParts(toolCall llm.ToolCall, toolContext ToolContext) (string, []llm.ContentPart, bool) {
 	tool, ok := registry.tools[toolCall.Name]
 	if !ok {
-		return "", false
+		return "", nil, false
 	}
 
 	meta := map[string]any{"tool": tool.Name()}
@@ -74,27 +163,31 @@ func (registry *Registry) Execute(toolCall llm.ToolCall, toolContext ToolContext
 	}
 
 	if strings.TrimSpace(toolContext.CWD) == "" || strings.TrimSpace(toolContext.AllowedRoot) == "" {
-		return ErrorEnvelope("invalid tool context: cwd and allowed_root are required", meta), true
+		return ErrorEnvelope("invalid tool context: cwd and allowed_root are required", meta), nil, true
 	}
 
 	if toolContext.Context != nil {
 		if err := toolContext.Context.Err(); err != nil {
 			if err == context.Canceled {
-				return ErrorEnvelope("tool execution cancelled", meta), true
+				return ErrorEnvelope("tool execution cancelled", meta), nil, true
 			}
-			return ErrorEnvelope(fmt.Sprintf("tool execution context error: %v", err), meta), true
+			return ErrorEnvelope(fmt.Sprintf("tool execution context error: %v", err), meta), nil, true
 		}
 	}
 
 	normalizedArguments, valid := NormalizeJSONArguments(toolCall.Arguments)
 	if !valid {
-		return ErrorEnvelope(fmt.Sprintf("%s: invalid JSON arguments", tool.Name()), meta), true
+		return ErrorEnvelope(fmt.Sprintf("%s: invalid JSON arguments", tool.Name()), meta), nil, true
 	}
 
 	result, err := tool.Execute(toolContext, normalizedArguments)
 	if err != nil {
-		return ErrorEnvelope(fmt.Sprintf("%s: %v", tool.Name(), err), meta), true
+		return ErrorEnvelope(fmt.Sprintf("%s: %v", tool.Name(), err), meta), nil, true
 	}
 
-	return SuccessEnvelope(result, meta), true
+	var parts []llm.ContentPart
+	if contentResult, ok := result.(ContentResult); ok {
+		parts = contentResult.ContentParts()
+	}
+	return SuccessEnvelope(result, meta), parts, true
 }
@@ -3,6 +3,9 @@ package tools
 import (
 	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -67,6 +70,40 @@ func TestRegistryExecute_UsesEnvelopeAndContext(t *testing.T) {
 	}
 }
 
+func TestRegistryExecuteWithParts_ReadReturnsImagePart(t *testing.T) {
+	root := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\nfake")
+	if err := os.WriteFile(filepath.Join(root, "shot.png"), png, 0o600); err != nil {
+		t.Fatalf("write png: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("hello"), 0o600); err != nil {
+		t.Fatalf("write txt: %v", err)
+	}
+	registry := NewRegistry(ReadTool{})
+	ctx := ToolContext{CWD: root, AllowedRoot: root}
+
+	output, parts, matched := registry.ExecuteWithParts(llm.ToolCall{Name: "Read", Arguments: `{"file_path":"shot.png"}`}, ctx)
+	if !matched {
+		t.Fatal("expected matched tool")
+	}
+	if len(parts) != 1 || parts[0].Type != llm.ContentPartImage || parts[0].MediaType != "image/png" || string(parts[0].Data) != string(png) {
+		t.Fatalf("expected png image part, got %+v", parts)
+	}
+	var envelope ResponseEnvelope
+	if err := json.Unmarshal([]byte(output), &envelope); err != nil || !envelope.OK {
+		t.Fatalf("expected ok envelope, got %q (%v)", output, err)
+	}
+	data, _ := envelope.Data.(map[string]any)
+	if data["media_type"] != "image/png" || data["bytes"] != float64(len(png)) {
+		t.Fatalf("expected media description in envelope, got %+v", envelope.Data)
+	}
+
+	_, parts, _ = registry.ExecuteWithParts(llm.ToolCall{Name: "Read", Arguments: `{"file_path":"notes.txt"}`}, ctx)
+	if len(parts) != 0 {
+		t.Fatalf("expected no parts for text files, got %+v", parts)
+	}
+}
+
 func TestRegistryExecute_ErrorEnvelopeOnToolFailure(t *testing.T) {
 	stub := &fakeTool{name: "Fake", err: errors.New("boom")}
 	registry := NewRegistry(stub)
@@ -109,3 +146,55 @@ func TestRegistryExecute_ErrorEnvelopeOnInvalidContext(t *testing.T) {
 		t.Fatalf("expected error envelope for invalid context")
 	}
 }
+
+func TestRegistryConcurrencySafe(t *testing.T) {
+	registry := DefaultRegistry()
+	for _, name := range []string{"Read", "ListDir", "FetchWebPage", "Unknown"} {
+		if !registry.ConcurrencySafe(name) {
+			t.Fatalf("expected %s to be concurrency safe", name)
+		}
+	}
+	for _, name := range []string{"Bash", "Write", "EditPatch"} {
+		if registry.ConcurrencySafe(name) {
+			t.Fatalf("expected %s to be serialized", name)
+		}
+	}
+}
+
+func TestRegistryReadOnly(t *testing.T) {
+	registry := DefaultRegistry()
+	for _, name := range []string{"Read", "ListDir", "FetchWebPage", "WebSearchOllama"} {
+		if !registry.ReadOnly(name) {
+			t.Fatalf("expected %s to be read-only", name)
+		}
+	}
+	for _, name := range []string{"Bash", "Write", "EditPatch", "Unknown"} {
+		if registry.ReadOnly(name) {
+			t.Fatalf("expected %s to be treated as mutating", name)
+		}
+	}
+}
+
+func TestRegistryPreview_DiffsFileEdits(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatalf("failed writing fixture: %v", err)
+	}
+	registry := DefaultRegistry()
+	ctx := ToolContext{CWD: root, AllowedRoot: root}
+
+	preview, ok := registry.Preview(llm.ToolCall{Name: "EditPatch", Arguments: `{"file_path":"notes.txt","old_string":"two","new_string":"2"}`}, ctx)
+	if !ok || !strings.Contains(preview, "-two\n+2\n") {
+		t.Fatalf("expected edit diff, got %q", preview)
+	}
+	preview, ok = registry.Preview(llm.ToolCall{Name: "Write", Arguments: `{"file_path":"new.txt","content":"hello\n"}`}, ctx)
+	if !ok || !strings.Contains(preview, "@@ -0,0 +1,1 @@\n+hello\n") {
+		t.Fatalf("expected new file diff, got %q", preview)
+	}
+	if content, err := os.ReadFile(filepath.Join(root, "notes.txt")); err != nil || string(content) != "one\ntwo\nthree\n" {
+		t.Fatalf("expected preview to leave the file unchanged, got %q", content)
+	}
+	if _, ok := registry.Preview(llm.ToolCall{Name: "Bash", Arguments: `{"command":"ls"}`}, ctx); ok {
+		t.Fatal("expected no preview for Bash")
+	}
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// TaskRequest is a task delegated to a sub-agent. Tools, when set, narrows
+// the tools the sub-agent may use.
+type TaskRequest struct {
+	Description string   `json:"description"`
+	Prompt      string   `json:"prompt"`
+	Tools       []string `json:"tools,omitempty"`
+}
+
+// TaskRunner runs a delegated task to completion with a fresh conversation
+// and returns the sub-agent's final answer.
+type TaskRunner interface {
+	RunTask(ctx ToolContext, task TaskRequest) (string, error)
+}
+
+// TaskTool delegates a self-contained task to a sub-agent so its exploratory
+// tool output stays out of the caller's conversation. Tools lists the tools
+// sub-agents may be given.
+type TaskTool struct {
+	Runner TaskRunner
+	Tools  []string
+}
+
+func (TaskTool) Name() string {
+	return "Task"
+}
+
+// ReadOnly reports true because each tool call the sub-agent makes is
+// approved on its own.
+func (TaskTool) ReadOnly() bool {
+	return true
+}
+
+func (tool TaskTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name: tool.Name(),
+		Description: "Delegate a self-contained task, such as exploring the codebase or researching a question, to a sub-agent. " +
+			"The sub-agent starts with a fresh conversation, works with its own tools and returns only its final answer, " +
+			"so give it every detail it needs and say exactly what the answer should contain.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"description": map[string]any{
+					"type":        "string",
+					"description": "A short (3-5 word) summary of the task",
+				},
+				"prompt": map[string]any{
+					"type":        "string",
+					"description": "The complete instructions for the sub-agent",
+				},
+				"tools": map[string]any{
+					"type":        "array",
+					"description": "Tools the sub-agent may use. Defaults to all of them.",
+					"items":       map[string]any{"type": "string", "enum": tool.Tools},
+				},
+			},
+			"required": []string{"description", "prompt"},
+		},
+	}
+}
+
+func (tool TaskTool) Execute(ctx ToolContext, arguments string) (any, error) {
+	var task TaskRequest
+	if err := json.Unmarshal([]byte(arguments), &task); err != nil {
+		return "", fmt.Errorf("error parsing arguments: %w", err)
+	}
+
+	task.Description = strings.TrimSpace(task.Description)
+	task.Prompt = strings.TrimSpace(task.Prompt)
+	if task.Prompt == "" {
+		return "", fmt.Errorf("prompt must be a non-empty string")
+	}
+	for _, name := range task.Tools {
+		if !slices.Contains(tool.Tools, name) {
+			return "", fmt.Errorf("tool %q is not available to sub-agents (use: %s)", name, strings.Join(tool.Tools, ", "))
+		}
+	}
+	if tool.Runner == nil {
+		return "", fmt.Errorf("sub-agents are not configured")
+	}
+
+	answer, err := tool.Runner.RunTask(ctx, task)
+	if err != nil {
+		return "", err
+	}
+	return map[string]any{
+		"description": task.Description,
+		"answer":      answer,
+	}, nil
+}
@@ -0,0 +1,38 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+type fakeTaskRunner struct {
+	task TaskRequest
+}
+
+func (runner *fakeTaskRunner) RunTask(ctx ToolContext, task TaskRequest) (string, error) {
+	runner.task = task
+	return "found 3 handlers", nil
+}
+
+func TestTaskTool_DelegatesToRunner(t *testing.T) {
+	runner := &fakeTaskRunner{}
+	tool := TaskTool{Runner: runner, Tools: []string{"ListDir", "Read"}}
+
+	result, err := tool.Execute(ToolContext{}, `{"description":"find handlers","prompt":" List the HTTP handlers ","tools":["Read"]}`)
+	if err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	if answer := result.(map[string]any)["answer"]; answer != "found 3 handlers" {
+		t.Fatalf("expected the sub-agent's answer, got %v", answer)
+	}
+	if runner.task.Prompt != "List the HTTP handlers" || len(runner.task.Tools) != 1 {
+		t.Fatalf("unexpected task %+v", runner.task)
+	}
+
+	if _, err := tool.Execute(ToolContext{}, `{"description":"x","prompt":"y","tools":["Bash"]}`); err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Fatalf("expected unavailable tool to be rejected, got %v", err)
+	}
+	if _, err := tool.Execute(ToolContext{}, `{"description":"x","prompt":" "}`); err == nil {
+		t.Fatal("expected empty prompt to be rejected")
+	}
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/adriankopytko/ShimiBot/internal/llm"
+)
+
+// TodoStatus is the state of one todo item.
+type TodoStatus string
+
+const (
+	TodoPending    TodoStatus = "pending"
+	TodoInProgress TodoStatus = "in_progress"
+	TodoDone       TodoStatus = "done"
+)
+
+// TodoItem is one step of the model's task list.
+type TodoItem struct {
+	Content string     `json:"content"`
+	Status  TodoStatus `json:"status"`
+}
+
+// TodoList holds the session's todo items. It is shared by pointer between
+// the TodoWrite tool, the shell that renders it and the session store.
+type TodoList struct {
+	mu    sync.Mutex
+	items []TodoItem
+}
+
+// Items returns a copy of the current items.
+func (list *TodoList) Items() []TodoItem {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	return append([]TodoItem(nil), list.items...)
+}
+
+// Set replaces the items.
+func (list *TodoList) Set(items []TodoItem) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	list.items = append([]TodoItem(nil), items...)
+}
+
+// FormatTodos renders items as a checklist with a done count, or "" when
+// there are none.
+func FormatTodos(items []TodoItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	done := 0
+	lines := make([]string, 0, len(items)+1)
+	for _, item := range items {
+		mark := " "
+		switch item.Status {
+		case TodoDone:
+			mark = "x"
+			done++
+		case TodoInProgress:
+			mark = ">"
+		}
+		lines = append(lines, fmt.Sprintf("  [%s] %s", mark, item.Content))
+	}
+	header := fmt.Sprintf("%d/%d done", done, len(items))
+	return strings.Join(append([]string{header}, lines...), "\n")
+}
+
+// TodoWriteTool lets the model keep a structured task list for multi-step
+// work. Each call replaces the whole list.
+type TodoWriteTool struct {
+	List *TodoList
+}
+
+func (TodoWriteTool) Name() string {
+	return "TodoWrite"
+}
+
+// ReadOnly reports true because the list is the agent's own notes, not part
+// of the workspace, so it stays available in plan mode.
+func (TodoWriteTool) ReadOnly() bool {
+	return true
+}
+
+// ConcurrencyUnsafe keeps several updates in one turn applied in call order.
+func (TodoWriteTool) ConcurrencyUnsafe() bool {
+	return true
+}
+
+func (TodoWriteTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name: "TodoWrite",
+		Description: "Create or update your todo list for multi-step tasks. Send the complete list every time; it replaces the previous one. " +
+			"Mark a step in_progress before starting it and done as soon as it is finished, with at most one step in_progress.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"todos": map[string]any{
+					"type":        "array",
+					"description": "The complete todo list",
+					"items": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"content": map[string]any{
+								"type":        "string",
+								"description": "What the step does",
+							},
+							"status": map[string]any{
+								"type": "string",
+								"enum": []string{string(TodoPending), string(TodoInProgress), string(TodoDone)},
+							},
+						},
+						"required": []string{"content", "status"},
+					},
+				},
+			},
+			"required": []string{"todos"},
+		},
+	}
+}
+
+func (tool TodoWriteTool) Execute(ctx ToolContext, arguments string) (any, error) {
+	var args struct {
+		Todos []TodoItem `json:"todos"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("error parsing arguments: %w", err)
+	}
+	if tool.List == nil {
+		return "", fmt.Errorf("no todo list is configured")
+	}
+
+	inProgress := 0
+	for index := range args.Todos {
+		item := &args.Todos[index]
+		item.Content = strings.TrimSpace(item.Content)
+		if item.Content == "" {
+			return "", fmt.Errorf("todos[%d].content must be a non-empty string", index)
+		}
+		switch item.Status {
+		case TodoPending, TodoDone:
+		case TodoInProgress:
+			inProgress++
+		default:
+			return "", fmt.Errorf("todos[%d].status must be pending, in_progress or done, got %q", index, item.Status)
+		}
+	}
+	if inProgress > 1 {
+		return "", fmt.Errorf("only one todo may be in_progress, got %d", inProgress)
+	}
+
+	tool.List.Set(args.Todos)
+	return map[string]any{
+		"todos":   args.Todos,
+		"summary": strings.SplitN(FormatTodos(args.Todos), "\n", 2)[0],
+	}, nil
+}
@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTodoWriteTool_ReplacesList(t *testing.T) {
+	list := &TodoList{}
+	tool := TodoWriteTool{List: list}
+
+	_, err := tool.Execute(ToolContext{}, `{"todos":[{"content":" read config ","status":"done"},{"content":"update handlers","status":"in_progress"},{"content":"run tests","status":"pending"}]}`)
+	if err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	items := list.Items()
+	if len(items) != 3 || items[0].Content != "read config" || items[1].Status != TodoInProgress {
+		t.Fatalf("unexpected todo list %+v", items)
+	}
+
+	expected := "1/3 done\n  [x] read config\n  [>] update handlers\n  [ ] run tests"
+	if text := FormatTodos(items); text != expected {
+		t.Fatalf("expected %q, got %q", expected, text)
+	}
+
+	if _, err := tool.Execute(ToolContext{}, `{"todos":[{"content":"a","status":"in_progress"},{"content":"b","status":"in_progress"}]}`); err == nil || !strings.Contains(err.Error(), "only one") {
+		t.Fatalf("expected two in-progress todos to be rejected, got %v", err)
+	}
+	if _, err := tool.Execute(ToolContext{}, `{"todos":[{"content":"a","status":"blocked"}]}`); err == nil {
+		t.Fatal("expected unknown status to be rejected")
+	}
+	if len(list.Items()) != 3 {
+		t.Fatalf("expected rejected updates to leave the list alone, got %+v", list.Items())
+	}
+}
@@ -31,6 +31,10 @@ func (WebSearchOllamaTool) Name() string {
 	return "WebSearchOllama"
 }
 
+func (WebSearchOllamaTool) ReadOnly() bool {
+	return true
+}
+
 func (tool WebSearchOllamaTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        tool.Name(),
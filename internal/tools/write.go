@@ -2,7 +2,9 @@ package tools
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"strings"
 
@@ -20,6 +22,11 @@ func (WriteTool) Name() string {
 	return "Write"
 }
 
+// ConcurrencyUnsafe keeps writes ordered with the calls around them.
+func (WriteTool) ConcurrencyUnsafe() bool {
+	return true
+}
+
 func (tool WriteTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        tool.Name(),
@@ -42,18 +49,9 @@ func (tool WriteTool) Definition() llm.ToolDefinition {
 }
 
 func (WriteTool) Execute(ctx ToolContext, arguments string) (any, error) {
-	var args writeArgs
-	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
-		return "", fmt.Errorf("error parsing arguments: %w", err)
-	}
-
-	args.FilePath = strings.TrimSpace(args.FilePath)
-	if args.FilePath == "" {
-		return "", fmt.Errorf("file_path must be a non-empty string")
-	}
-	resolvedPath := ResolvePath(ctx, args.FilePath)
-	if err := EnsurePathAllowed(ctx, resolvedPath); err != nil {
-		return "", fmt.Errorf("path policy violation: %w", err)
+	args, resolvedPath, err := parseWriteArgs(ctx, arguments)
+	if err != nil {
+		return "", err
 	}
 
 	if err := os.WriteFile(resolvedPath, []byte(args.Content), 0644); err != nil {
@@ -65,3 +63,36 @@ func (WriteTool) Execute(ctx ToolContext, arguments string) (any, error) {
 		"content":   args.Content,
 	}, nil
 }
+
+// Preview shows the write as a diff against the file's current content.
+func (WriteTool) Preview(ctx ToolContext, arguments string) (string, error) {
+	args, resolvedPath, err := parseWriteArgs(ctx, arguments)
+	if err != nil {
+		return "", err
+	}
+	current, err := os.ReadFile(resolvedPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	if diff := UnifiedDiff(args.FilePath, string(current), args.Content); diff != "" {
+		return diff, nil
+	}
+	return "no changes to " + args.FilePath, nil
+}
+
+func parseWriteArgs(ctx ToolContext, arguments string) (writeArgs, string, error) {
+	var args writeArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return writeArgs{}, "", fmt.Errorf("error parsing arguments: %w", err)
+	}
+
+	args.FilePath = strings.TrimSpace(args.FilePath)
+	if args.FilePath == "" {
+		return writeArgs{}, "", fmt.Errorf("file_path must be a non-empty string")
+	}
+	resolvedPath := ResolvePath(ctx, args.FilePath)
+	if err := EnsurePathAllowed(ctx, resolvedPath); err != nil {
+		return writeArgs{}, "", fmt.Errorf("path policy violation: %w", err)
+	}
+	return args, resolvedPath, nil
+}